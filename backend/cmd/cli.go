@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/accounts"
+	"hack4good/internal/export"
+	"hack4good/internal/fieldcrypt"
+	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
+)
+
+const cliUsage = `usage:
+  server users list [-q text] [-role role] [-active true|false]
+  server users deactivate <userId>
+  server users reactivate <userId>
+  server users reset-password <userId>
+  server users set-role <userId> <caregiver|recipient|guardian|admin>
+  server users merge <sourceUserId> <targetUserId>
+  server users delete <userId>
+  server integrity
+  server reencrypt
+  server worker [-concurrency n]
+  server export <userId> [-o file.zip]
+  server webhooks listen [-addr :9999] [-secret s] [-fail n]`
+
+// runCLI executes an admin subcommand and returns the process exit code.
+func runCLI(db *gorm.DB, args []string) int {
+	var err error
+	switch {
+	case len(args) >= 2 && args[0] == "users":
+		err = runUsersCommand(db, args[1], args[2:])
+	case len(args) >= 2 && args[0] == "export":
+		err = runExportCommand(db, args[1:])
+	case len(args) == 1 && args[0] == "integrity":
+		err = runIntegrityCommand(db)
+	case len(args) == 1 && args[0] == "reencrypt":
+		err = runReencryptCommand(db)
+	case len(args) >= 1 && args[0] == "worker":
+		err = runWorkerCommand(db, args[1:])
+	case len(args) >= 2 && args[0] == "webhooks" && args[1] == "listen":
+		err = runWebhookListenCommand(args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, cliUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func runUsersCommand(db *gorm.DB, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+		query := fs.String("q", "", "match username or name")
+		role := fs.String("role", "", "filter by role")
+		active := fs.String("active", "", "filter by active (true or false)")
+		limit := fs.Int("limit", 50, "maximum number of users")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		filter := accounts.Filter{Query: *query, Role: models.UserRole(*role), Limit: *limit}
+		if *active != "" {
+			v, err := strconv.ParseBool(*active)
+			if err != nil {
+				return fmt.Errorf("invalid -active value %q", *active)
+			}
+			filter.Active = &v
+		}
+
+		users, total, err := accounts.List(db, filter)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tNAME\tROLE\tACTIVE")
+		for _, u := range users {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\n", u.ID, u.Username, u.Name, u.Role, u.Active)
+		}
+		w.Flush()
+		fmt.Printf("%d of %d users\n", len(users), total)
+		return nil
+
+	case "deactivate", "reactivate":
+		id, err := userIDArg(args, 0)
+		if err != nil {
+			return err
+		}
+		u, err := accounts.SetActive(db, id, cmd == "reactivate")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("user %d (%s) active=%t\n", u.ID, u.Username, u.Active)
+		return nil
+
+	case "reset-password":
+		id, err := userIDArg(args, 0)
+		if err != nil {
+			return err
+		}
+		temp, err := accounts.ResetPassword(db, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("temporary password for user %d: %s\n", id, temp)
+		return nil
+
+	case "set-role":
+		id, err := userIDArg(args, 0)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("missing role")
+		}
+		u, err := accounts.ChangeRole(db, id, models.UserRole(args[1]))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("user %d (%s) role=%s\n", u.ID, u.Username, u.Role)
+		return nil
+
+	case "merge":
+		source, err := userIDArg(args, 0)
+		if err != nil {
+			return err
+		}
+		target, err := userIDArg(args, 1)
+		if err != nil {
+			return err
+		}
+		u, err := accounts.Merge(db, source, target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("merged user %d into %d (%s)\n", source, u.ID, u.Username)
+		return nil
+
+	case "delete":
+		id, err := userIDArg(args, 0)
+		if err != nil {
+			return err
+		}
+		if err := accounts.Delete(db, id); err != nil {
+			return err
+		}
+		fmt.Printf("deleted user %d\n", id)
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", cmd, cliUsage)
+}
+
+// runIntegrityCommand reports orphaned rows and fails if there are any.
+func runIntegrityCommand(db *gorm.DB) error {
+	issues, err := accounts.CheckIntegrity(db)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s.%s: %d rows reference missing %s\n", issue.Table, issue.Column, issue.Count, issue.References)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("found %d integrity problems", len(issues))
+	}
+	fmt.Println("no orphaned rows")
+	return nil
+}
+
+// runReencryptCommand moves every encrypted field onto the current key, e.g.
+// before removing a retired key from FIELD_ENCRYPTION_KEYS.
+func runReencryptCommand(db *gorm.DB) error {
+	n, err := fieldcrypt.Reencrypt(db, encryptedModels...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("re-encrypted %d fields\n", n)
+	return nil
+}
+
+// runWorkerCommand processes background jobs without serving HTTP, until it
+// is interrupted. Running jobs are allowed to finish.
+func runWorkerCommand(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	concurrency := fs.Int("concurrency", 4, "jobs to run at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	worker, err := newWorker(db, *concurrency)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("running jobs with %d workers, press Ctrl+C to stop\n", *concurrency)
+	return worker.Run(ctx)
+}
+
+// runExportCommand writes a user's data archive to a file, synchronously.
+func runExportCommand(db *gorm.DB, args []string) error {
+	id, err := userIDArg(args, 0)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", fmt.Sprintf("export-user-%d.zip", id), "output file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := export.Write(db, id, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", *out)
+	return nil
+}
+
+// runWebhookListenCommand runs a local endpoint to point subscriptions at
+// while developing an integration.
+func runWebhookListenCommand(args []string) error {
+	fs := flag.NewFlagSet("webhooks listen", flag.ContinueOnError)
+	addr := fs.String("addr", ":9999", "address to listen on")
+	secret := fs.String("secret", "", "subscription secret to verify signatures with")
+	fail := fs.Int("fail", 0, "answer the first n deliveries with 500")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Printf("listening for webhook deliveries on %s, press Ctrl+C to stop\n", *addr)
+	return http.ListenAndServe(*addr, &webhooks.Listener{Secret: *secret, Out: os.Stdout, FailFirst: *fail})
+}
+
+func userIDArg(args []string, i int) (uint, error) {
+	if len(args) <= i {
+		return 0, fmt.Errorf("missing user id")
+	}
+	id, err := strconv.ParseUint(args[i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id %q", args[i])
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/accounts"
+	"hack4good/internal/export"
+	"hack4good/internal/fieldcrypt"
+	"hack4good/internal/handlers"
+	"hack4good/internal/jobs"
+	"hack4good/internal/mailer"
+	"hack4good/internal/models"
+	"hack4good/internal/reminders"
+	"hack4good/internal/transcribe"
+	"hack4good/internal/webhooks"
+)
+
+// Recurring maintenance jobs; each schedule is named after its kind.
+const (
+	jobPurgeExports   = "exports.purge"
+	jobDeleteAccounts = "accounts.delete_due"
+	jobReencrypt      = "fieldcrypt.reencrypt"
+	jobCleanupJobs    = "jobs.cleanup"
+)
+
+// succeededJobRetention is how long finished jobs stay visible to admins.
+const succeededJobRetention = 7 * 24 * time.Hour
+
+type noPayload struct{}
+
+// newJobRegistry wires every background job this server knows about.
+func newJobRegistry(db *gorm.DB) (*jobs.Registry, error) {
+	r := jobs.NewRegistry()
+
+	jobs.Register(r, export.JobKind, func(ctx context.Context, p export.JobPayload) error {
+		return export.Generate(db, p.ExportID)
+	})
+
+	// Without a transcriber, audio entries stay queued until one is configured
+	transcriber, err := transcribe.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("transcriber: %w", err)
+	}
+	if transcriber != nil {
+		jobs.Register(r, transcribe.JobKind, func(ctx context.Context, p transcribe.JobPayload) error {
+			return transcribe.Process(ctx, db, transcriber, p.EntryID)
+		})
+	} else {
+		log.Println("TRANSCRIBER not set; audio entries stay queued for transcription")
+	}
+
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	jobs.Register(r, handlers.PasswordResetJobKind, func(ctx context.Context, p handlers.PasswordResetPayload) error {
+		return handlers.SendPasswordReset(ctx, db, mail, p.Login)
+	})
+
+	// Webhooks may only reach public addresses, unless a developer is
+	// receiving them on their own machine
+	webhookClient := webhooks.NewClient(os.Getenv("WEBHOOKS_ALLOW_INTERNAL") == "true")
+
+	escalateAfter := time.Hour
+	if s := os.Getenv("REMINDER_ESCALATE_AFTER"); s != "" {
+		if escalateAfter, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("REMINDER_ESCALATE_AFTER: %w", err)
+		}
+	}
+	reminderService := reminders.Service{
+		DB: db,
+		Channels: map[models.ReminderChannel]reminders.Channel{
+			models.ChannelInApp:   reminders.InApp{DB: db},
+			models.ChannelEmail:   reminders.Email{Mailer: mail},
+			models.ChannelWebhook: reminders.Webhook{Client: webhookClient},
+		},
+		EscalateAfter: escalateAfter,
+	}
+	jobs.Register(r, reminders.ScanJobKind, func(ctx context.Context, _ noPayload) error {
+		return reminderService.Scan(ctx, time.Now())
+	})
+	jobs.Register(r, reminders.DeliverJobKind, func(ctx context.Context, p reminders.DeliverPayload) error {
+		return reminderService.Deliver(ctx, p.ReminderID)
+	})
+
+	jobs.Register(r, webhooks.PublishJobKind, func(ctx context.Context, p webhooks.PublishPayload) error {
+		return webhooks.Fanout(ctx, db, p)
+	})
+	jobs.RegisterWithTimeout(r, webhooks.DeliverJobKind, time.Minute, func(ctx context.Context, p webhooks.DeliverPayload) error {
+		return webhooks.Deliver(ctx, db, webhookClient, p.DeliveryID)
+	})
+
+	jobs.Register(r, jobPurgeExports, func(ctx context.Context, _ noPayload) error {
+		return export.PurgeExpired(db)
+	})
+	jobs.Register(r, jobDeleteAccounts, func(ctx context.Context, _ noPayload) error {
+		n, err := accounts.DeleteDue(db)
+		if n > 0 {
+			log.Printf("deleted %d accounts after their grace period", n)
+		}
+		return err
+	})
+	jobs.Register(r, jobCleanupJobs, func(ctx context.Context, _ noPayload) error {
+		_, err := jobs.Cleanup(db, time.Now().Add(-succeededJobRetention))
+		return err
+	})
+	schedules := map[string]string{
+		reminders.ScanJobKind: "* * * * *",
+		jobPurgeExports:       "@hourly",
+		jobDeleteAccounts:     "@hourly",
+		jobCleanupJobs:        "@daily",
+	}
+
+	if fieldcrypt.Enabled() {
+		jobs.Register(r, jobReencrypt, func(ctx context.Context, _ noPayload) error {
+			n, err := fieldcrypt.Reencrypt(db, encryptedModels...)
+			if n > 0 {
+				log.Printf("re-encrypted %d fields with the current key", n)
+			}
+			return err
+		})
+		schedules[jobReencrypt] = "@hourly"
+	}
+
+	for kind, spec := range schedules {
+		if err := r.Schedule(kind, spec, kind, noPayload{}); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// newWorker builds a worker pool that runs every registered job.
+func newWorker(db *gorm.DB, concurrency int) (*jobs.Worker, error) {
+	registry, err := newJobRegistry(db)
+	if err != nil {
+		return nil, err
+	}
+	return &jobs.Worker{DB: db, Registry: registry, Concurrency: concurrency}, nil
+}
+
+// jobWorkers reads JOB_WORKERS; 0 means the server leaves jobs to a separate
+// `server worker` process.
+func jobWorkers() (int, error) {
+	s := os.Getenv("JOB_WORKERS")
+	if s == "" {
+		return 4, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("JOB_WORKERS must be a non-negative number")
+	}
+	return n, nil
+}
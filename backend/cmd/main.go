@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"hack4good/internal/auth"
 	"hack4good/internal/db"
+	"hack4good/internal/fieldcrypt"
 	"hack4good/internal/handlers"
+	"hack4good/internal/loginguard"
+	"hack4good/internal/mailer"
 	"hack4good/internal/models"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -14,27 +23,72 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// encryptedModels have columns tagged serializer:encrypted, which the
+// re-encryption job moves onto the current key.
+var encryptedModels = []any{
+	&models.Recipient{},
+	&models.JournalEntry{},
+	&models.JournalEntryRevision{},
+	&models.Comment{},
+	&models.CommentRevision{},
+	&models.TwoFactor{},
+	&models.WebhookSubscription{},
+	&models.ReminderSettings{},
+}
+
 func main() {
 	_ = godotenv.Load()
 
+	keys, err := fieldcrypt.FromEnv()
+	if err != nil {
+		log.Fatalf("field encryption keys: %v", err)
+	}
+	if keys != nil {
+		fieldcrypt.SetProvider(keys)
+	} else {
+		log.Println("FIELD_ENCRYPTION_KEYS not set; sensitive fields are stored unencrypted")
+	}
+
 	DB := db.Connect()
+	if err := fieldcrypt.Register(DB); err != nil {
+		log.Fatalf("field encryption: %v", err)
+	}
 
-	if err := DB.AutoMigrate(
-		&models.User{},
-		&models.Caregiver{},
-		&models.Recipient{},
-		&models.CaregiverRecipient{},
-		&models.CareRequest{},
-		&models.JournalEntry{},
-		&models.Comment{},
-		&models.Todo{},
-	); err != nil {
+	if err := DB.AutoMigrate(models.Tables...); err != nil {
 		log.Fatalf("migrate failed: %v", err)
 	}
+	if err := models.EnforceAuditLogAppendOnly(DB); err != nil {
+		log.Fatalf("audit log trigger: %v", err)
+	}
+	// Webhook response bodies used to be logged, with whatever the endpoint sent
+	if DB.Migrator().HasColumn(&models.WebhookDelivery{}, "response_body") {
+		if err := DB.Migrator().DropColumn(&models.WebhookDelivery{}, "response_body"); err != nil {
+			log.Fatalf("migrate failed: %v", err)
+		}
+	}
+
+	auth.UseDB(DB)
+
+	// Anything after the binary name is an admin subcommand, e.g. `server users list`
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(DB, os.Args[1:]))
+	}
 
 	r := gin.New()
 	r.Use(gin.Logger(), gin.Recovery())
 
+	// Client IPs feed the login limiter, so X-Forwarded-For is only believed
+	// from the proxies listed in TRUSTED_PROXIES
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
+
 	origins := strings.Split(os.Getenv("CORS_ORIGINS"), ",")
 	for i := range origins {
 		origins[i] = strings.TrimSpace(origins[i])
@@ -44,58 +98,262 @@ func main() {
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	authHandler := handlers.AuthHandler{DB: DB}
+	// Failed logins are tracked in Postgres so every instance sees them;
+	// LOGIN_LIMITER_STORE=memory keeps them in process instead.
+	var loginStore loginguard.Store = loginguard.PostgresStore{DB: DB}
+	if os.Getenv("LOGIN_LIMITER_STORE") == "memory" {
+		loginStore = loginguard.NewMemoryStore()
+	}
+
+	// Mail goes out from jobs, but a bad setup should stop the server too
+	if _, err := mailer.FromEnv(); err != nil {
+		log.Fatalf("mailer: %v", err)
+	}
+
+	limiter := loginguard.New(loginStore)
+	authHandler := handlers.AuthHandler{
+		DB:      DB,
+		Limiter: limiter,
+	}
 	r.POST("/login", authHandler.Login)
 	r.POST("/signup", authHandler.Signup)
+	r.POST("/password-reset/request", authHandler.RequestPasswordReset)
+	r.POST("/password-reset/confirm", authHandler.ResetPassword)
+	r.PUT("/me/password", auth.AllowPendingReset(), auth.Middleware(), authHandler.ChangePassword)
+	r.PUT("/me/email", auth.Middleware(), authHandler.UpdateEmail)
+	r.POST("/me/deletion", auth.Middleware(), authHandler.ScheduleDeletion)
+	r.DELETE("/me/deletion", auth.Middleware(), authHandler.CancelDeletion)
+	r.POST("/login/2fa", authHandler.LoginTwoFactor)
+	r.POST("/login/2fa/enroll", authHandler.LoginEnroll)
+	r.POST("/login/2fa/enroll/verify", authHandler.LoginEnrollVerify)
+	r.POST("/login/code", authHandler.LoginWithCode)
+	r.POST("/recipients/:id/login-codes", auth.Middleware(), authHandler.CreateLoginCode)
+	r.GET("/recipients/:id/device-sessions", auth.Middleware(), authHandler.ListDeviceSessions)
+	r.DELETE("/recipients/:id/device-sessions/:sessionId", auth.Middleware(), authHandler.RevokeDeviceSession)
+	twoFactor := r.Group("/me/2fa", auth.Middleware())
+	twoFactor.GET("", authHandler.TwoFactorStatus)
+	twoFactor.POST("/enroll", authHandler.EnrollTwoFactor)
+	twoFactor.POST("/verify", authHandler.VerifyTwoFactor)
+	twoFactor.DELETE("", authHandler.DisableTwoFactor)
+	twoFactor.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
 
-	recipientHandler := handlers.RecipientHandler{DB: DB}
-	r.GET("/recipients", recipientHandler.List)
-	r.GET("/caregivers/:id/recipients", recipientHandler.ListByCaregiver)
-	r.GET("/recipients/:id", recipientHandler.GetByID)
-	r.PUT("/recipients/:id", recipientHandler.Update)
-	r.GET("/recipients/user/:userId", recipientHandler.GetByUserID)
+	// Access to recipient data is written to the audit log
+	audit := func(action string, resource models.AuditResource) gin.HandlerFunc {
+		return handlers.Audit(DB, action, resource)
+	}
+	dataExportHandler := handlers.DataExportHandler{DB: DB}
+	r.POST("/me/exports", auth.Middleware(), dataExportHandler.Create)
+	r.GET("/me/exports", auth.Middleware(), dataExportHandler.List)
+	r.GET("/me/exports/:id", auth.Middleware(), dataExportHandler.Get)
+	r.GET("/exports/:id/download", dataExportHandler.Download)
+
+	// Background jobs run in this process unless JOB_WORKERS=0, in which
+	// case `server worker` runs them separately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workers, err := jobWorkers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	workerDone := make(chan struct{})
+	if workers > 0 {
+		worker, err := newWorker(DB, workers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer close(workerDone)
+			if err := worker.Run(ctx); err != nil {
+				log.Printf("job worker stopped: %v", err)
+			}
+		}()
+	} else {
+		close(workerDone)
+	}
+
+	auditHandler := handlers.AuditHandler{DB: DB}
+	r.GET("/recipients/:id/access-log", auth.Middleware(), auditHandler.RecipientAccessLog)
+
+	adminHandler := handlers.AdminHandler{DB: DB}
+	admin := r.Group("/admin", auth.Middleware(), auth.RequireRole(string(models.RoleAdmin)))
+	admin.GET("/users", adminHandler.ListUsers)
+	admin.GET("/users/:id", adminHandler.GetUser)
+	admin.POST("/users/:id/deactivate", adminHandler.Deactivate)
+	admin.POST("/users/:id/reactivate", adminHandler.Reactivate)
+	admin.POST("/users/:id/reset-password", adminHandler.ResetPassword)
+	admin.PUT("/users/:id/role", adminHandler.ChangeRole)
+	admin.POST("/users/merge", adminHandler.Merge)
+	admin.DELETE("/users/:id", adminHandler.DeleteUser)
+	admin.GET("/integrity", adminHandler.Integrity)
+	admin.GET("/audit-logs", auditHandler.AdminList)
+	admin.GET("/jobs", adminHandler.ListJobs)
+	admin.GET("/jobs/schedules", adminHandler.ListJobSchedules)
+	admin.GET("/jobs/:id", adminHandler.GetJob)
+	admin.POST("/jobs/:id/retry", adminHandler.RetryJob)
+
+	recipientHandler := handlers.RecipientHandler{DB: DB, Limiter: limiter}
+	r.GET("/recipients", auth.OptionalMiddleware(), audit("recipients.listed", models.AuditResourceRecipient), recipientHandler.List)
+	r.GET("/caregivers/:id/recipients", auth.OptionalMiddleware(), audit("recipients.listed", models.AuditResourceCaregiver), recipientHandler.ListByCaregiver)
+	r.GET("/recipients/:id", auth.OptionalMiddleware(), audit("recipient.viewed", models.AuditResourceRecipient), recipientHandler.GetByID)
+	r.PUT("/recipients/:id", auth.Middleware(), audit("recipient.updated", models.AuditResourceRecipient), recipientHandler.Update)
+	r.GET("/recipients/user/:userId", auth.OptionalMiddleware(), audit("recipient.viewed", models.AuditResourceRecipient), recipientHandler.GetByUserID)
+	r.GET("/recipients/invite/:code", auth.OptionalMiddleware(), audit("recipient.viewed", models.AuditResourceRecipient), recipientHandler.GetByInviteCode)
+	r.POST("/recipients/:id/invite-code", auth.Middleware(), recipientHandler.RotateInviteCode)
+	r.DELETE("/recipients/:id/invite-code", auth.Middleware(), recipientHandler.DisableInviteCode)
+	r.GET("/caregivers/:id/matches", auth.Middleware(), recipientHandler.Match)
 
 	caregiverHandler := handlers.CaregiverHandler{DB: DB}
-	r.GET("/caregivers", caregiverHandler.List)
-	r.PUT("/caregivers/:id", caregiverHandler.Update)
-	r.GET("/recipients/:id/caregivers", caregiverHandler.ListByRecipient)
-	r.GET("/caregivers/user/:userId", caregiverHandler.GetByUserID)
+	r.GET("/caregivers", auth.Middleware(), caregiverHandler.List)
+	r.PUT("/caregivers/:id", auth.Middleware(), caregiverHandler.Update)
+	r.GET("/recipients/:id/caregivers", auth.Middleware(), audit("caregivers.listed", models.AuditResourceRecipient), caregiverHandler.ListByRecipient)
+	r.GET("/recipients/:id/caregivers/:caregiverId/scopes", auth.Middleware(), caregiverHandler.GetScopes)
+	r.PUT("/recipients/:id/caregivers/:caregiverId/scopes", auth.Middleware(), caregiverHandler.UpdateScopes)
+	r.GET("/caregivers/user/:userId", auth.Middleware(), caregiverHandler.GetByUserID)
+	r.PUT("/caregivers/:id/profile", auth.Middleware(), caregiverHandler.UpdateProfile)
+
+	guardianHandler := handlers.GuardianHandler{DB: DB}
+	guardians := r.Group("", auth.Middleware())
+	guardians.GET("/guardian/recipients", guardianHandler.ListManaged)
+	guardians.GET("/recipients/:id/guardians", guardianHandler.ListByRecipient)
+	guardians.POST("/recipients/:id/guardians", guardianHandler.Add)
+	guardians.PATCH("/recipients/:id/guardians/:guardianId", guardianHandler.UpdatePermissions)
+	guardians.DELETE("/recipients/:id/guardians/:guardianId", guardianHandler.Remove)
 
-	careRequestHandler := handlers.CareRequestHandler{DB: DB}
-	r.POST("/requests", careRequestHandler.CreateRequest)
-	r.GET("/recipients/:id/requests", careRequestHandler.ListRecipientRequests)
-	r.PATCH("/requests/:id", careRequestHandler.RespondToRequest)
+	careRequestHandler := handlers.CareRequestHandler{DB: DB, Limiter: limiter}
+	r.POST("/requests", auth.Middleware(), audit("care_request.created", models.AuditResourceCareRequest), careRequestHandler.CreateRequest)
+	r.POST("/requests/by-code", auth.Middleware(), audit("care_request.created", models.AuditResourceCareRequest), careRequestHandler.CreateRequestByCode)
+	r.GET("/recipients/:id/requests", auth.Middleware(), audit("care_requests.listed", models.AuditResourceRecipient), careRequestHandler.ListRecipientRequests)
+	r.PATCH("/requests/:id", auth.Middleware(), audit("care_request.responded", models.AuditResourceCareRequest), careRequestHandler.RespondToRequest)
+
+	inviteHandler := handlers.InviteHandler{DB: DB}
+	r.POST("/invites/qr", inviteHandler.QRCode)
+	invites := r.Group("/invites", auth.Middleware())
+	invites.POST("", inviteHandler.Create)
+	invites.GET("", inviteHandler.List)
+	invites.DELETE("/:id", inviteHandler.Revoke)
+	invites.GET("/:id/events", inviteHandler.ListEvents)
+	invites.POST("/redeem", inviteHandler.Redeem)
 
 	journalHandler := handlers.JournalHandler{DB: DB}
-	r.POST("/journal-entries", journalHandler.Create)
-	r.GET("/journal-entries", journalHandler.List)
-	r.GET("/journal-entries/accepted", journalHandler.ListAccepted)
-	r.PUT("/journal-entries/:id", journalHandler.Update)
-	r.DELETE("/journal-entries/:id", journalHandler.Delete)
+	r.POST("/journal-entries", auth.OptionalMiddleware(), audit("journal_entry.created", models.AuditResourceJournalEntry), journalHandler.Create)
+	r.GET("/journal-entries", auth.OptionalMiddleware(), audit("journal.listed", models.AuditResourceJournalEntry), journalHandler.List)
+	r.GET("/journal-entries/accepted", auth.OptionalMiddleware(), audit("journal.listed", models.AuditResourceJournalEntry), journalHandler.ListAccepted)
+	r.GET("/journal-entries/search", auth.OptionalMiddleware(), audit("journal.searched", models.AuditResourceJournalEntry), journalHandler.Search)
+	r.PUT("/journal-entries/:id", auth.OptionalMiddleware(), audit("journal_entry.updated", models.AuditResourceJournalEntry), journalHandler.Update)
+	r.DELETE("/journal-entries/:id", auth.OptionalMiddleware(), audit("journal_entry.deleted", models.AuditResourceJournalEntry), journalHandler.Delete)
+	r.PUT("/journal-entries/:id/transcript", auth.Middleware(), audit("journal_entry.transcript_updated", models.AuditResourceJournalEntry), journalHandler.UpdateTranscript)
+	r.GET("/journal-entries/:id/revisions", auth.OptionalMiddleware(), audit("journal_entry.history_viewed", models.AuditResourceJournalEntry), journalHandler.ListRevisions)
+	r.GET("/journal-entries/:id/revisions/:revisionId", auth.OptionalMiddleware(), audit("journal_entry.history_viewed", models.AuditResourceJournalEntry), journalHandler.GetRevision)
+
+	uploadHandler := handlers.UploadHandler{DB: DB}
+	r.POST("/uploads", auth.Middleware(), uploadHandler.Create)
+	r.GET("/uploads/:name", auth.Middleware(), uploadHandler.Get)
 
 	commentHandler := handlers.CommentHandler{DB: DB}
-	r.POST("/comments", commentHandler.Create)
-	r.GET("/comments", commentHandler.List)
-	r.PUT("/comments/:id", commentHandler.Update)
-	r.DELETE("/comments/:id", commentHandler.Delete)
+	r.POST("/comments", auth.Middleware(), commentHandler.Create)
+	r.GET("/comments", auth.Middleware(), audit("comments.listed", models.AuditResourceJournalEntry), commentHandler.List)
+	r.PUT("/comments/:id", auth.Middleware(), commentHandler.Update)
+	r.DELETE("/comments/:id", auth.Middleware(), commentHandler.Delete)
+	r.GET("/comments/:id/revisions", auth.Middleware(), audit("comment.history_viewed", models.AuditResourceComment), commentHandler.ListRevisions)
+	r.GET("/comments/:id/revisions/:revisionId", auth.Middleware(), audit("comment.history_viewed", models.AuditResourceComment), commentHandler.GetRevision)
+
+	reactionHandler := handlers.ReactionHandler{DB: DB}
+	r.POST("/reactions", auth.Middleware(), reactionHandler.Create)
+	r.DELETE("/reactions/:id", auth.Middleware(), reactionHandler.Delete)
+	r.GET("/journal-entries/:id/reactions", auth.Middleware(), audit("reactions.listed", models.AuditResourceJournalEntry), reactionHandler.ListForEntry)
+	r.GET("/comments/:id/reactions", auth.Middleware(), audit("reactions.listed", models.AuditResourceComment), reactionHandler.ListForComment)
+
+	conversationHandler := handlers.ConversationHandler{DB: DB}
+	conversations := r.Group("/conversations", auth.Middleware())
+	conversations.POST("", conversationHandler.Create)
+	conversations.GET("", conversationHandler.List)
+	conversations.GET("/:id/messages", conversationHandler.ListMessages)
+	conversations.POST("/:id/messages", conversationHandler.SendMessage)
+	conversations.POST("/:id/read", conversationHandler.MarkRead)
+
+	handoverNoteHandler := handlers.HandoverNoteHandler{DB: DB}
+	handover := r.Group("", auth.Middleware())
+	handover.GET("/recipients/:id/handover-notes", audit("handover_notes.listed", models.AuditResourceRecipient), handoverNoteHandler.List)
+	handover.POST("/recipients/:id/handover-notes", handoverNoteHandler.Create)
+	handover.GET("/recipients/:id/digest", audit("digest.viewed", models.AuditResourceRecipient), handoverNoteHandler.Digest)
+	handover.PATCH("/handover-notes/:id", handoverNoteHandler.Update)
+	handover.DELETE("/handover-notes/:id", handoverNoteHandler.Delete)
+	handover.POST("/handover-notes/:id/ack", handoverNoteHandler.Acknowledge)
+
+	organizationHandler := handlers.OrganizationHandler{DB: DB}
+	organizations := r.Group("/organizations", auth.Middleware())
+	organizations.POST("", organizationHandler.Create)
+	organizations.GET("/me", organizationHandler.Mine)
+	organizations.GET("/invitations", organizationHandler.Invitations)
+	organizations.POST("/:id/accept", organizationHandler.AcceptInvitation)
+	organizations.POST("/:id/decline", organizationHandler.DeclineInvitation)
+	organizations.PATCH("/:id", organizationHandler.UpdateSettings)
+	organizations.GET("/:id/members", organizationHandler.ListMembers)
+	organizations.POST("/:id/members", organizationHandler.AddMember)
+	organizations.PATCH("/:id/members/:userId", organizationHandler.UpdateMember)
+	organizations.DELETE("/:id/members/:userId", organizationHandler.RemoveMember)
+	organizations.GET("/:id/caregivers", organizationHandler.ListCaregivers)
+	organizations.GET("/:id/recipients", audit("recipients.listed", models.AuditResourceOrganization), organizationHandler.ListRecipients)
+	organizations.GET("/:id/todos", audit("todos.listed", models.AuditResourceOrganization), organizationHandler.ListTodos)
+	organizations.GET("/:id/dashboard", audit("dashboard.viewed", models.AuditResourceOrganization), organizationHandler.Dashboard)
 
 	todoHandler := handlers.TodoHandler{DB: DB}
-	r.POST("/todos", todoHandler.Create)
-	r.GET("/todos", todoHandler.List)
-	r.GET("/todos/:id", todoHandler.GetByID)
-	r.PUT("/todos/:id", todoHandler.Update)
-	r.DELETE("/todos/:id", todoHandler.Delete)
+	r.POST("/todos", auth.Middleware(), audit("todo.created", models.AuditResourceTodo), todoHandler.Create)
+	r.GET("/todos", auth.Middleware(), audit("todos.listed", models.AuditResourceTodo), todoHandler.List)
+	r.GET("/todos/:id", auth.Middleware(), audit("todo.viewed", models.AuditResourceTodo), todoHandler.GetByID)
+	r.PUT("/todos/:id", auth.Middleware(), audit("todo.updated", models.AuditResourceTodo), todoHandler.Update)
+	r.DELETE("/todos/:id", auth.Middleware(), audit("todo.deleted", models.AuditResourceTodo), todoHandler.Delete)
+
+	reminderHandler := handlers.ReminderHandler{DB: DB}
+	r.GET("/me/reminder-settings", auth.Middleware(), reminderHandler.GetSettings)
+	r.PUT("/me/reminder-settings", auth.Middleware(), reminderHandler.UpdateSettings)
+
+	notificationHandler := handlers.NotificationHandler{DB: DB}
+	r.GET("/me/notifications", auth.Middleware(), notificationHandler.List)
+	r.POST("/me/notifications/read-all", auth.Middleware(), notificationHandler.MarkAllRead)
+	r.POST("/me/notifications/:id/read", auth.Middleware(), notificationHandler.MarkRead)
+
+	webhookHandler := handlers.WebhookHandler{DB: DB}
+	for _, webhookRoutes := range []*gin.RouterGroup{
+		r.Group("/me/webhooks", auth.Middleware()),
+		r.Group("/organizations/:id/webhooks", auth.Middleware()),
+	} {
+		webhookRoutes.GET("", webhookHandler.List)
+		webhookRoutes.POST("", webhookHandler.Create)
+		webhookRoutes.GET("/:webhookId", webhookHandler.Get)
+		webhookRoutes.PATCH("/:webhookId", webhookHandler.Update)
+		webhookRoutes.DELETE("/:webhookId", webhookHandler.Delete)
+		webhookRoutes.POST("/:webhookId/test", webhookHandler.Test)
+		webhookRoutes.GET("/:webhookId/deliveries", webhookHandler.ListDeliveries)
+		webhookRoutes.POST("/:webhookId/deliveries/:deliveryId/replay", webhookHandler.Replay)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	if err := r.Run("0.0.0.0:" + port); err != nil {
+	srv := &http.Server{Addr: "0.0.0.0:" + port, Handler: r}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("server shutdown: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server failed: %v", err)
 	}
+
+	// Let in-flight requests and running jobs finish
+	<-shutdownDone
+	log.Println("waiting for running jobs to finish")
+	<-workerDone
 }
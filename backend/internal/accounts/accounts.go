@@ -0,0 +1,386 @@
+// Package accounts holds user administration shared by the admin API and the
+// command line.
+package accounts
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+var (
+	ErrNotFound     = errors.New("user not found")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrSameUser     = errors.New("cannot merge a user into itself")
+	ErrRoleMismatch = errors.New("only users with the same role can be merged")
+	ErrMerged       = errors.New("user has been merged into another account")
+)
+
+type Filter struct {
+	Query  string // matched against username and name
+	Role   models.UserRole
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+func List(db *gorm.DB, f Filter) ([]models.User, int64, error) {
+	q := db.Model(&models.User{})
+	if f.Query != "" {
+		like := "%" + strings.ToLower(strings.TrimSpace(f.Query)) + "%"
+		q = q.Where("(LOWER(username) LIKE ? OR LOWER(name) LIKE ?)", like, like)
+	}
+	if f.Role != "" {
+		q = q.Where("role = ?", f.Role)
+	}
+	if f.Active != nil {
+		q = q.Where("active = ?", *f.Active)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	var users []models.User
+	if err := q.Order("id asc").Limit(f.Limit).Offset(f.Offset).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func Get(db *gorm.DB, id uint) (models.User, error) {
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, ErrNotFound
+		}
+		return user, err
+	}
+	return user, nil
+}
+
+// SetActive deactivates or reactivates an account. Deactivating also revokes
+// every token the user holds.
+func SetActive(db *gorm.DB, id uint, active bool) (models.User, error) {
+	user, err := Get(db, id)
+	if err != nil {
+		return user, err
+	}
+	if active && user.MergedIntoID != nil {
+		return user, ErrMerged
+	}
+	if active && user.DeletedAt != nil {
+		return user, ErrAlreadyDeleted
+	}
+
+	updates := map[string]any{"active": active}
+	if active {
+		updates["deactivated_at"] = nil
+	} else {
+		updates["deactivated_at"] = time.Now()
+		updates["token_version"] = gorm.Expr("token_version + 1")
+	}
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		return user, err
+	}
+	return Get(db, id)
+}
+
+// ResetPassword replaces the password with a random temporary one, revokes
+// existing tokens and flags the account so the user has to choose a new
+// password. The temporary password is returned once and never stored.
+func ResetPassword(db *gorm.DB, id uint) (string, error) {
+	if _, err := Get(db, id); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	temp := base64.RawURLEncoding.EncodeToString(buf)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(temp), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]any{
+		"password_hash":       string(hash),
+		"must_reset_password": true,
+		"token_version":       gorm.Expr("token_version + 1"),
+	}).Error; err != nil {
+		return "", err
+	}
+	return temp, nil
+}
+
+// ChangeRole switches a user's role, creating the matching profile if the
+// user never had one. Old profiles are kept so switching back restores them.
+func ChangeRole(db *gorm.DB, id uint, role models.UserRole) (models.User, error) {
+	switch role {
+	case models.RoleCaregiver, models.RoleRecipient, models.RoleGuardian, models.RoleAdmin:
+	default:
+		return models.User{}, ErrInvalidRole
+	}
+
+	user, err := Get(db, id)
+	if err != nil {
+		return user, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureProfile(tx, user.ID, role); err != nil {
+			return err
+		}
+		// Tokens carry the role, so old ones must stop working
+		return tx.Model(&user).Updates(map[string]any{
+			"role":          role,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+	})
+	if err != nil {
+		return user, err
+	}
+	return Get(db, id)
+}
+
+func ensureProfile(tx *gorm.DB, userID uint, role models.UserRole) error {
+	switch role {
+	case models.RoleCaregiver:
+		return tx.Where(models.Caregiver{UserID: userID}).FirstOrCreate(&models.Caregiver{}).Error
+	case models.RoleRecipient:
+		return tx.Where(models.Recipient{UserID: userID}).FirstOrCreate(&models.Recipient{}).Error
+	case models.RoleGuardian:
+		return tx.Where(models.Guardian{UserID: userID}).FirstOrCreate(&models.Guardian{}).Error
+	}
+	return nil
+}
+
+// mergedUserRefs are the columns pointing at a user that Merge moves from the
+// source account to the target.
+var mergedUserRefs = []reference{
+	{table: "comments", column: "author_id"},
+	{table: "journal_entry_revisions", column: "editor_id"},
+	{table: "comment_revisions", column: "editor_id"},
+	{table: "reactions", column: "user_id", unique: []string{"journal_entry_id", "comment_id", "emoji"}},
+	{table: "conversations", column: "created_by_id"},
+	{table: "conversation_participants", column: "user_id", unique: []string{"conversation_id"}},
+	{table: "messages", column: "sender_id"},
+	{table: "invites", column: "created_by_id"},
+	{table: "invites", column: "redeemed_by_id"},
+	{table: "invite_events", column: "actor_id"},
+	{table: "organization_members", column: "user_id", unique: []string{}},
+	{table: "notifications", column: "user_id"},
+	{table: "todo_reminders", column: "user_id", unique: []string{"todo_id", "kind", "minutes_before", "due_date"}},
+	{table: "webhook_subscriptions", column: "user_id"},
+	{table: "webhook_subscriptions", column: "created_by_id"},
+	{table: "uploads", column: "user_id"},
+	{table: "data_exports", column: "user_id"},
+	{table: "reminder_rules", column: "user_id"},
+	{table: "login_codes", column: "created_by_id"},
+	{table: "device_sessions", column: "created_by_id"},
+	{table: "device_sessions", column: "revoked_by_id"},
+}
+
+// loginState belongs to the source account's credentials rather than to the
+// person, so Merge deletes it instead of handing it to the target.
+var loginState = []reference{
+	{table: "device_sessions", column: "user_id"},
+	{table: "two_factors", column: "user_id"},
+	{table: "recovery_codes", column: "user_id"},
+	{table: "password_reset_tokens", column: "user_id"},
+}
+
+// Merge moves everything owned by the source account onto the target and
+// deactivates the source. Rows that would duplicate one the target already
+// has (e.g. the same caregiver-recipient link) are dropped, and the source's
+// sessions, login codes and second factor are deleted.
+func Merge(db *gorm.DB, sourceID, targetID uint) (models.User, error) {
+	if sourceID == targetID {
+		return models.User{}, ErrSameUser
+	}
+	source, err := Get(db, sourceID)
+	if err != nil {
+		return source, err
+	}
+	target, err := Get(db, targetID)
+	if err != nil {
+		return target, err
+	}
+	if source.Role != target.Role {
+		return target, ErrRoleMismatch
+	}
+	if source.MergedIntoID != nil || target.MergedIntoID != nil {
+		return target, ErrMerged
+	}
+	if source.DeletedAt != nil || target.DeletedAt != nil {
+		return target, ErrAlreadyDeleted
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := moveReferences(tx, mergedUserRefs, source.ID, target.ID); err != nil {
+			return err
+		}
+		if err := moveReminderSettings(tx, source.ID, target.ID); err != nil {
+			return err
+		}
+
+		// Codes for the source's own devices would sign in to an account
+		// that no longer works; they go before the sessions they point at
+		if err := tx.Exec("DELETE FROM login_codes WHERE recipient_id IN (SELECT id FROM recipients WHERE user_id = ?)", source.ID).Error; err != nil {
+			return err
+		}
+		for _, ref := range loginState {
+			sql := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", ref.table, ref.column)
+			if err := tx.Exec(sql, source.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := mergeProfile(tx, source, target); err != nil {
+			return err
+		}
+
+		return tx.Model(&source).Updates(map[string]any{
+			"active":         false,
+			"deactivated_at": time.Now(),
+			"merged_into_id": target.ID,
+			"token_version":  gorm.Expr("token_version + 1"),
+		}).Error
+	})
+	if err != nil {
+		return target, err
+	}
+	return Get(db, targetID)
+}
+
+// moveReminderSettings hands the source's delivery settings to a target that
+// has none. They are keyed by user and the webhook secret is encrypted against
+// that key, so the row is rewritten through the model rather than updated.
+func moveReminderSettings(tx *gorm.DB, from, to uint) error {
+	var settings models.ReminderSettings
+	if err := tx.Take(&settings, "user_id = ?", from).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := tx.Delete(&models.ReminderSettings{}, "user_id = ?", from).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&models.ReminderSettings{}).Where("user_id = ?", to).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	settings.UserID = to
+	return tx.Create(&settings).Error
+}
+
+// reference is a column pointing at a user or profile. unique lists the other
+// columns of a unique index the column is part of; an empty non-nil slice
+// means the column is unique on its own.
+type reference struct {
+	table  string
+	column string
+	unique []string
+}
+
+func moveReferences(tx *gorm.DB, refs []reference, from, to uint) error {
+	for _, ref := range refs {
+		if ref.unique != nil {
+			conds := []string{fmt.Sprintf("o.%s = ?", ref.column)}
+			for _, col := range ref.unique {
+				conds = append(conds, fmt.Sprintf("o.%[1]s IS NOT DISTINCT FROM t.%[1]s", col))
+			}
+			sql := fmt.Sprintf(
+				"DELETE FROM %[1]s t WHERE t.%[2]s = ? AND EXISTS (SELECT 1 FROM %[1]s o WHERE %[3]s)",
+				ref.table, ref.column, strings.Join(conds, " AND "),
+			)
+			if err := tx.Exec(sql, from, to).Error; err != nil {
+				return err
+			}
+		}
+
+		sql := fmt.Sprintf("UPDATE %s SET %[2]s = ? WHERE %[2]s = ?", ref.table, ref.column)
+		if err := tx.Exec(sql, to, from).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeProfile(tx *gorm.DB, source, target models.User) error {
+	var refs []reference
+	var table string
+	switch source.Role {
+	case models.RoleCaregiver:
+		table = "caregivers"
+		refs = []reference{
+			{table: "caregiver_recipients", column: "caregiver_id", unique: []string{"recipient_id"}},
+			{table: "care_requests", column: "caregiver_id", unique: []string{"recipient_id"}},
+			{table: "todos", column: "caregiver_id"},
+			{table: "journal_entry_shares", column: "caregiver_id", unique: []string{"journal_entry_id"}},
+			{table: "handover_notes", column: "author_id"},
+			{table: "handover_acknowledgements", column: "caregiver_id", unique: []string{"note_id"}},
+			{table: "invites", column: "caregiver_id"},
+		}
+	case models.RoleRecipient:
+		table = "recipients"
+		refs = []reference{
+			{table: "caregiver_recipients", column: "recipient_id", unique: []string{"caregiver_id"}},
+			{table: "care_requests", column: "recipient_id", unique: []string{"caregiver_id"}},
+			{table: "guardian_recipients", column: "recipient_id", unique: []string{"guardian_id"}},
+			{table: "journal_entries", column: "recipient_id"},
+			{table: "todos", column: "recipient_id"},
+			{table: "conversations", column: "recipient_id"},
+			{table: "handover_notes", column: "recipient_id"},
+			{table: "invites", column: "recipient_id"},
+		}
+	case models.RoleGuardian:
+		table = "guardians"
+		refs = []reference{
+			{table: "guardian_recipients", column: "guardian_id", unique: []string{"recipient_id"}},
+		}
+	default:
+		return nil
+	}
+
+	var from, to uint
+	if err := tx.Table(table).Select("id").Where("user_id = ?", source.ID).Scan(&from).Error; err != nil {
+		return err
+	}
+	if from == 0 {
+		return nil
+	}
+	if err := ensureProfile(tx, target.ID, target.Role); err != nil {
+		return err
+	}
+	if err := tx.Table(table).Select("id").Where("user_id = ?", target.ID).Scan(&to).Error; err != nil {
+		return err
+	}
+
+	if err := moveReferences(tx, refs, from, to); err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), from).Error
+}
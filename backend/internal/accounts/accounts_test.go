@@ -0,0 +1,104 @@
+package accounts
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm/schema"
+
+	"hack4good/internal/models"
+)
+
+// userColumns finds every column of a model table that holds a user ID: fields
+// named UserID, or commented "// UserID" as models do for other names.
+func userColumns(t *testing.T) map[userColumn]bool {
+	t.Helper()
+	tables := map[string]bool{}
+	for _, m := range models.Tables {
+		tables[reflect.TypeOf(m).Elem().Name()] = true
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, "../models", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	naming := schema.NamingStrategy{}
+	columns := map[userColumn]bool{}
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok || !tables[spec.Name.Name] {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+			for _, field := range st.Fields.List {
+				for _, name := range field.Names {
+					if name.Name == "UserID" || field.Comment != nil && strings.HasPrefix(field.Comment.Text(), "UserID") {
+						columns[userColumn{naming.TableName(spec.Name.Name), naming.ColumnName("", name.Name)}] = true
+					}
+				}
+			}
+			return false
+		})
+	}
+	return columns
+}
+
+// userColumn is a table and column, comparable unlike reference.
+type userColumn struct{ table, column string }
+
+func TestMergeHandlesEveryUserReference(t *testing.T) {
+	handled := map[userColumn]string{
+		// mergeProfile moves what hangs off the profile
+		{"caregivers", "user_id"}: "profile",
+		{"recipients", "user_id"}: "profile",
+		{"guardians", "user_id"}:  "profile",
+		// Rewritten through the model so the webhook secret is re-encrypted
+		{"reminder_settings", "user_id"}: "moved",
+		// The audit log is append-only and keeps naming who acted
+		{"audit_logs", "actor_id"}:        "kept",
+		{"audit_logs", "on_behalf_of_id"}: "kept",
+	}
+	for _, ref := range mergedUserRefs {
+		handled[userColumn{ref.table, ref.column}] = "moved"
+	}
+	for _, ref := range loginState {
+		key := userColumn{ref.table, ref.column}
+		if how, ok := handled[key]; ok {
+			t.Errorf("%s.%s is both %s and deleted", ref.table, ref.column, how)
+		}
+		handled[key] = "deleted"
+	}
+
+	columns := userColumns(t)
+	if len(columns) < len(handled) {
+		t.Fatalf("found only %d user columns, the model scan is broken", len(columns))
+	}
+	for ref := range columns {
+		if _, ok := handled[ref]; !ok {
+			t.Errorf("Merge neither moves nor deletes %s.%s", ref.table, ref.column)
+		}
+	}
+	for ref := range handled {
+		if !columns[ref] {
+			t.Errorf("%s.%s is handled by Merge but isn't a user column of any model", ref.table, ref.column)
+		}
+	}
+	for _, ref := range references {
+		if ref.parent == "users" && handled[userColumn{ref.table, ref.column}] == "" {
+			t.Errorf("Merge leaves %s.%s pointing at the source", ref.table, ref.column)
+		}
+	}
+}
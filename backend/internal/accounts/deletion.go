@@ -0,0 +1,260 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+var ErrAlreadyDeleted = errors.New("account has already been deleted")
+
+// formerName replaces the name of a deleted user wherever their comments and
+// messages remain visible to others.
+func formerName(role models.UserRole) string {
+	switch role {
+	case models.RoleCaregiver:
+		return "Former caregiver"
+	case models.RoleRecipient:
+		return "Former recipient"
+	case models.RoleGuardian:
+		return "Former guardian"
+	}
+	return "Former user"
+}
+
+// Delete erases a user. Their own content is hard-deleted, links to other
+// users are removed, and the user row is kept only as an anonymous,
+// deactivated placeholder so comments and messages they left for others
+// still have an author. Stored files are removed once the transaction commits.
+func Delete(db *gorm.DB, id uint) error {
+	user, err := Get(db, id)
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt != nil {
+		return ErrAlreadyDeleted
+	}
+
+	var files []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		switch user.Role {
+		case models.RoleRecipient:
+			files, err = deleteRecipientData(tx, user.ID)
+		case models.RoleCaregiver:
+			err = deleteCaregiverData(tx, user.ID)
+		case models.RoleGuardian:
+			err = deleteGuardianData(tx, user.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		own, err := deleteUserData(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		files = append(files, own...)
+
+		now := time.Now()
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"username":               fmt.Sprintf("deleted-%d", user.ID),
+			"name":                   formerName(user.Role),
+			"email":                  nil,
+			"password_hash":          "",
+			"active":                 false,
+			"must_reset_password":    false,
+			"token_version":          gorm.Expr("token_version + 1"),
+			"deactivated_at":         now,
+			"deletion_scheduled_for": nil,
+			"deleted_at":             now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		_ = os.Remove(f)
+	}
+	return nil
+}
+
+// exec runs each statement with the same argument, stopping at the first error.
+func exec(tx *gorm.DB, arg any, statements ...string) error {
+	for _, sql := range statements {
+		if err := tx.Exec(sql, arg).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteUserData(tx *gorm.DB, userID uint) ([]string, error) {
+	var files []string
+	if err := tx.Model(&models.DataExport{}).
+		Where("user_id = ? AND file_path <> ''", userID).
+		Pluck("file_path", &files).Error; err != nil {
+		return nil, err
+	}
+	var uploads []models.Upload
+	if err := tx.Where("user_id = ?", userID).Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range uploads {
+		files = append(files, u.Path("uploads"))
+	}
+
+	err := exec(tx, userID,
+		"DELETE FROM reactions WHERE user_id = ?",
+		"DELETE FROM conversation_participants WHERE user_id = ?",
+		"DELETE FROM organization_members WHERE user_id = ?",
+		"DELETE FROM password_reset_tokens WHERE user_id = ?",
+		"DELETE FROM two_factors WHERE user_id = ?",
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		"DELETE FROM device_sessions WHERE user_id = ?",
+		"DELETE FROM data_exports WHERE user_id = ?",
+		"DELETE FROM invites WHERE created_by_id = ?",
+		"DELETE FROM notifications WHERE user_id = ?",
+		"DELETE FROM todo_reminders WHERE user_id = ?",
+		"DELETE FROM reminder_rules WHERE user_id = ?",
+		"DELETE FROM reminder_settings WHERE user_id = ?",
+		"DELETE FROM webhook_subscriptions WHERE user_id = ?",
+		"DELETE FROM uploads WHERE user_id = ?",
+	)
+	return files, err
+}
+
+func deleteGuardianData(tx *gorm.DB, userID uint) error {
+	return exec(tx, userID,
+		"DELETE FROM guardian_recipients WHERE guardian_id IN (SELECT id FROM guardians WHERE user_id = ?)",
+		"DELETE FROM guardians WHERE user_id = ?",
+	)
+}
+
+func deleteCaregiverData(tx *gorm.DB, userID uint) error {
+	const caregiver = "(SELECT id FROM caregivers WHERE user_id = ?)"
+	return exec(tx, userID,
+		"DELETE FROM handover_acknowledgements WHERE caregiver_id IN "+caregiver,
+		"DELETE FROM handover_acknowledgements WHERE note_id IN (SELECT id FROM handover_notes WHERE author_id IN "+caregiver+")",
+		"DELETE FROM handover_notes WHERE author_id IN "+caregiver,
+		"DELETE FROM journal_entry_shares WHERE caregiver_id IN "+caregiver,
+		"DELETE FROM todos WHERE caregiver_id IN "+caregiver,
+		// Recipients' invites the caregiver redeemed outlive the request
+		"UPDATE invites SET care_request_id = NULL WHERE care_request_id IN (SELECT id FROM care_requests WHERE caregiver_id IN "+caregiver+")",
+		"DELETE FROM care_requests WHERE caregiver_id IN "+caregiver,
+		"DELETE FROM caregiver_recipients WHERE caregiver_id IN "+caregiver,
+		"DELETE FROM invites WHERE caregiver_id IN "+caregiver,
+		"DELETE FROM caregivers WHERE user_id = ?",
+	)
+}
+
+// deleteRecipientData removes the recipient's journal with everything hanging
+// off it, their conversations and care history. It returns the audio and
+// attachment files to remove.
+func deleteRecipientData(tx *gorm.DB, userID uint) ([]string, error) {
+	const recipient = "(SELECT id FROM recipients WHERE user_id = ?)"
+	const entries = "(SELECT id FROM journal_entries WHERE recipient_id IN " + recipient + ")"
+	const comments = "(SELECT id FROM comments WHERE journal_entry_id IN " + entries + ")"
+	const conversations = "(SELECT id FROM conversations WHERE recipient_id IN " + recipient + ")"
+	const messages = "(SELECT id FROM messages WHERE conversation_id IN " + conversations + ")"
+
+	// Files are found through the uploads table, never from the stored URL
+	var files []string
+	if err := tx.Raw("SELECT name FROM uploads WHERE '/uploads/' || name IN "+
+		"(SELECT audio_url FROM journal_entries WHERE recipient_id IN "+recipient+
+		" UNION SELECT url FROM message_attachments WHERE message_id IN "+messages+")", userID, userID).
+		Scan(&files).Error; err != nil {
+		return nil, err
+	}
+	for i, name := range files {
+		files[i] = models.Upload{Name: name}.Path("uploads")
+	}
+
+	err := exec(tx, userID,
+		"DELETE FROM reactions WHERE comment_id IN "+comments,
+		"DELETE FROM reactions WHERE journal_entry_id IN "+entries,
+		"DELETE FROM comment_revisions WHERE comment_id IN "+comments,
+		// Replies first so the parent_id foreign key never dangles
+		"DELETE FROM comments WHERE journal_entry_id IN "+entries+" AND parent_id IS NOT NULL",
+		"DELETE FROM comments WHERE journal_entry_id IN "+entries,
+		"DELETE FROM journal_entry_revisions WHERE journal_entry_id IN "+entries,
+		"DELETE FROM journal_entry_shares WHERE journal_entry_id IN "+entries,
+		"DELETE FROM journal_entries WHERE recipient_id IN "+recipient,
+
+		"DELETE FROM message_attachments WHERE message_id IN "+messages,
+		"DELETE FROM messages WHERE conversation_id IN "+conversations,
+		"DELETE FROM conversation_participants WHERE conversation_id IN "+conversations,
+		"DELETE FROM conversations WHERE recipient_id IN "+recipient,
+
+		"DELETE FROM handover_acknowledgements WHERE note_id IN (SELECT id FROM handover_notes WHERE recipient_id IN "+recipient+")",
+		"DELETE FROM handover_notes WHERE recipient_id IN "+recipient,
+		"DELETE FROM todos WHERE recipient_id IN "+recipient,
+		"DELETE FROM care_requests WHERE recipient_id IN "+recipient,
+		"DELETE FROM caregiver_recipients WHERE recipient_id IN "+recipient,
+		"DELETE FROM guardian_recipients WHERE recipient_id IN "+recipient,
+		"DELETE FROM invites WHERE recipient_id IN "+recipient,
+		"DELETE FROM login_codes WHERE recipient_id IN "+recipient,
+		"DELETE FROM device_sessions WHERE recipient_id IN "+recipient,
+		"DELETE FROM recipients WHERE user_id = ?",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ScheduleDeletion starts the grace period after which the account is erased.
+func ScheduleDeletion(db *gorm.DB, id uint, grace time.Duration) (models.User, error) {
+	user, err := Get(db, id)
+	if err != nil {
+		return user, err
+	}
+	if user.DeletedAt != nil {
+		return user, ErrAlreadyDeleted
+	}
+	if err := db.Model(&user).Update("deletion_scheduled_for", time.Now().Add(grace)).Error; err != nil {
+		return user, err
+	}
+	return Get(db, id)
+}
+
+func CancelDeletion(db *gorm.DB, id uint) (models.User, error) {
+	if err := db.Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NULL", id).
+		Update("deletion_scheduled_for", nil).Error; err != nil {
+		return models.User{}, err
+	}
+	return Get(db, id)
+}
+
+// DeleteDue erases every account whose grace period has ended. An account
+// that can't be deleted is logged and skipped so it doesn't hold up the rest;
+// the error then says how many failed.
+func DeleteDue(db *gorm.DB) (int, error) {
+	var ids []uint
+	if err := db.Model(&models.User{}).
+		Where("deletion_scheduled_for <= ? AND deleted_at IS NULL", time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, id := range ids {
+		if err := Delete(db, id); err != nil {
+			log.Printf("deleting user %d: %v", id, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted < len(ids) {
+		return deleted, fmt.Errorf("%d of %d due accounts could not be deleted", len(ids)-deleted, len(ids))
+	}
+	return deleted, nil
+}
@@ -0,0 +1,108 @@
+package accounts
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// IntegrityIssue is a set of rows pointing at something that no longer exists.
+type IntegrityIssue struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	References string `json:"references"`
+	Count      int64  `json:"count"`
+}
+
+// references lists every column that points at another row. Several have no
+// foreign key constraint, so nothing but this check catches orphans.
+var references = []struct{ table, column, parent string }{
+	{"caregivers", "user_id", "users"},
+	{"recipients", "user_id", "users"},
+	{"guardians", "user_id", "users"},
+	{"caregiver_recipients", "caregiver_id", "caregivers"},
+	{"caregiver_recipients", "recipient_id", "recipients"},
+	{"guardian_recipients", "guardian_id", "guardians"},
+	{"guardian_recipients", "recipient_id", "recipients"},
+	{"care_requests", "caregiver_id", "caregivers"},
+	{"care_requests", "recipient_id", "recipients"},
+	{"journal_entries", "recipient_id", "recipients"},
+	{"journal_entry_shares", "journal_entry_id", "journal_entries"},
+	{"journal_entry_shares", "caregiver_id", "caregivers"},
+	{"journal_entry_revisions", "journal_entry_id", "journal_entries"},
+	{"comments", "journal_entry_id", "journal_entries"},
+	{"comments", "author_id", "users"},
+	{"comments", "parent_id", "comments"},
+	{"comment_revisions", "comment_id", "comments"},
+	{"reactions", "user_id", "users"},
+	{"reactions", "journal_entry_id", "journal_entries"},
+	{"reactions", "comment_id", "comments"},
+	{"todos", "caregiver_id", "caregivers"},
+	{"todos", "recipient_id", "recipients"},
+	{"conversations", "recipient_id", "recipients"},
+	{"conversation_participants", "conversation_id", "conversations"},
+	{"conversation_participants", "user_id", "users"},
+	{"messages", "conversation_id", "conversations"},
+	{"messages", "sender_id", "users"},
+	{"message_attachments", "message_id", "messages"},
+	{"handover_notes", "recipient_id", "recipients"},
+	{"handover_notes", "author_id", "caregivers"},
+	{"handover_acknowledgements", "note_id", "handover_notes"},
+	{"handover_acknowledgements", "caregiver_id", "caregivers"},
+	{"organization_members", "user_id", "users"},
+	{"organization_members", "organization_id", "organizations"},
+	{"device_sessions", "user_id", "users"},
+	{"device_sessions", "recipient_id", "recipients"},
+	{"login_codes", "recipient_id", "recipients"},
+	{"login_codes", "created_by_id", "users"},
+	{"login_codes", "device_session_id", "device_sessions"},
+	{"journal_entry_revisions", "editor_id", "users"},
+	{"comment_revisions", "editor_id", "users"},
+	{"invites", "created_by_id", "users"},
+	{"invites", "recipient_id", "recipients"},
+	{"invites", "caregiver_id", "caregivers"},
+	{"invites", "redeemed_by_id", "users"},
+	{"invites", "care_request_id", "care_requests"},
+	{"invite_events", "invite_id", "invites"},
+	{"invite_events", "actor_id", "users"},
+	{"two_factors", "user_id", "users"},
+	{"recovery_codes", "user_id", "users"},
+	{"password_reset_tokens", "user_id", "users"},
+	{"data_exports", "user_id", "users"},
+	{"reminder_settings", "user_id", "users"},
+	{"reminder_rules", "user_id", "users"},
+	{"todo_reminders", "todo_id", "todos"},
+	{"todo_reminders", "user_id", "users"},
+	{"notifications", "user_id", "users"},
+	{"webhook_subscriptions", "user_id", "users"},
+	{"webhook_subscriptions", "organization_id", "organizations"},
+	{"webhook_subscriptions", "created_by_id", "users"},
+	{"webhook_deliveries", "subscription_id", "webhook_subscriptions"},
+	{"webhook_deliveries", "replay_of_id", "webhook_deliveries"},
+	{"uploads", "user_id", "users"},
+}
+
+// CheckIntegrity counts orphaned rows. An empty result means the data is
+// consistent.
+func CheckIntegrity(db *gorm.DB) ([]IntegrityIssue, error) {
+	issues := []IntegrityIssue{}
+	for _, ref := range references {
+		var count int64
+		sql := fmt.Sprintf(
+			"SELECT COUNT(*) FROM %[1]s t WHERE t.%[2]s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %[3]s p WHERE p.id = t.%[2]s)",
+			ref.table, ref.column, ref.parent,
+		)
+		if err := db.Raw(sql).Scan(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			issues = append(issues, IntegrityIssue{
+				Table:      ref.table,
+				Column:     ref.column,
+				References: ref.parent,
+				Count:      count,
+			})
+		}
+	}
+	return issues, nil
+}
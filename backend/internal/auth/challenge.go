@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ChallengePurpose says what a challenge token lets its holder do next.
+type ChallengePurpose string
+
+const (
+	ChallengeTwoFactor ChallengePurpose = "2fa"        // enter a TOTP or recovery code
+	ChallengeEnroll    ChallengePurpose = "2fa_enroll" // set up TOTP before the first login
+)
+
+const challengeTTL = 5 * time.Minute
+
+var errWrongPurpose = errors.New("token is not valid for this step")
+
+// SignChallenge issues the short-lived token Login hands out when a password
+// was correct but a second factor is still needed. It is never accepted as an
+// access token.
+func SignChallenge(userID uint, version int, purpose ChallengePurpose) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", fmt.Errorf("JWT_SECRET is not set")
+	}
+
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"ver": version,
+		"typ": string(purpose),
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(challengeTTL).Unix(),
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return t.SignedString([]byte(secret))
+}
+
+// ParseChallenge validates a challenge token issued for purpose.
+func ParseChallenge(tokenStr string, purpose ChallengePurpose) (*Claims, error) {
+	claims, err := parseClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := claims["typ"].(string); typ != string(purpose) {
+		return nil, errWrongPurpose
+	}
+
+	parsed, err := toClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSession(parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func SignToken(userID uint, role string) (string, error) {
+func SignToken(userID uint, role string, version int) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return "", fmt.Errorf("JWT_SECRET is not set")
@@ -17,6 +17,7 @@ func SignToken(userID uint, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"sub":  userID,
 		"role": role,
+		"ver":  version,
 		"iat":  time.Now().Unix(),
 		"exp":  time.Now().Add(7 * 24 * time.Hour).Unix(),
 	}
@@ -24,3 +25,24 @@ func SignToken(userID uint, role string) (string, error) {
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return t.SignedString([]byte(secret))
 }
+
+// SignDeviceToken issues a long-lived token bound to a device session. It
+// stops working as soon as the session is revoked.
+func SignDeviceToken(userID uint, role string, version int, sessionID uint, expiresAt time.Time) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", fmt.Errorf("JWT_SECRET is not set")
+	}
+
+	claims := jwt.MapClaims{
+		"sub":  userID,
+		"role": role,
+		"ver":  version,
+		"sid":  sessionID,
+		"iat":  time.Now().Unix(),
+		"exp":  expiresAt.Unix(),
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return t.SignedString([]byte(secret))
+}
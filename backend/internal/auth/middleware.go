@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ctxUserID     = "authUserID"
+	ctxRole       = "authRole"
+	ctxResetRoute = "authResetRoute"
+)
+
+type Claims struct {
+	UserID    uint
+	Role      string
+	Version   int
+	SessionID uint // set on device tokens
+
+	// Set from the user's row; such a caller may only change their password
+	MustResetPassword bool
+}
+
+// AllowPendingReset marks a route as usable by callers who still have to
+// replace a temporary password. Put it before Middleware.
+func AllowPendingReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxResetRoute, true)
+		c.Next()
+	}
+}
+
+// blockedByReset writes a 403 when the caller must change their password
+// before using this route.
+func blockedByReset(c *gin.Context, claims *Claims) bool {
+	if !claims.MustResetPassword || c.GetBool(ctxResetRoute) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "password change required"})
+	return true
+}
+
+func parseClaims(tokenStr string) (jwt.MapClaims, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET is not set")
+	}
+
+	t, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+func toClaims(claims jwt.MapClaims) (*Claims, error) {
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, errors.New("invalid token subject")
+	}
+	role, _ := claims["role"].(string)
+	version, _ := claims["ver"].(float64)
+	sessionID, _ := claims["sid"].(float64)
+
+	return &Claims{UserID: uint(sub), Role: role, Version: int(version), SessionID: uint(sessionID)}, nil
+}
+
+// ParseToken validates an access token. Challenge tokens are rejected.
+func ParseToken(tokenStr string) (*Claims, error) {
+	claims, err := parseClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["typ"]; ok {
+		return nil, errWrongPurpose
+	}
+
+	parsed, err := toClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSession(parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// Middleware rejects requests without a valid bearer token and stores the
+// caller's identity on the context.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenStr, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenStr == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		claims, err := ParseToken(tokenStr)
+		if errors.Is(err, ErrAccountInactive) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "account is deactivated"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		if blockedByReset(c, claims) {
+			return
+		}
+
+		c.Set(ctxUserID, claims.UserID)
+		c.Set(ctxRole, claims.Role)
+		c.Next()
+	}
+}
+
+// OptionalMiddleware identifies the caller when a valid bearer token is sent
+// but lets anonymous requests through.
+func OptionalMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok && tokenStr != "" {
+			if claims, err := ParseToken(tokenStr); err == nil {
+				if blockedByReset(c, claims) {
+					return
+				}
+				c.Set(ctxUserID, claims.UserID)
+				c.Set(ctxRole, claims.Role)
+			}
+		}
+		c.Next()
+	}
+}
+
+// UserID returns the authenticated caller, or 0 outside of Middleware.
+func UserID(c *gin.Context) uint {
+	return c.GetUint(ctxUserID)
+}
+
+func Role(c *gin.Context) string {
+	return c.GetString(ctxRole)
+}
+
+// RequireRole must run after Middleware and rejects callers with any other role.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Role(c) != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+			return
+		}
+		c.Next()
+	}
+}
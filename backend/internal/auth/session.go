@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountInactive = errors.New("account is deactivated")
+	ErrTokenRevoked    = errors.New("token has been revoked")
+)
+
+var sessionDB *gorm.DB
+
+// UseDB makes ParseToken check every token against the user's current state,
+// so deactivating an account or bumping its token version takes effect
+// immediately instead of when the token expires.
+func UseDB(db *gorm.DB) {
+	sessionDB = db
+}
+
+func checkSession(claims *Claims) error {
+	if sessionDB == nil {
+		return nil
+	}
+
+	var user struct {
+		Active            bool
+		TokenVersion      int
+		MustResetPassword bool
+	}
+	if err := sessionDB.Table("users").
+		Select("active, token_version, must_reset_password").
+		Where("id = ?", claims.UserID).
+		Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTokenRevoked
+		}
+		return err
+	}
+
+	if !user.Active {
+		return ErrAccountInactive
+	}
+	if user.TokenVersion != claims.Version {
+		return ErrTokenRevoked
+	}
+	claims.MustResetPassword = user.MustResetPassword
+	if claims.SessionID != 0 {
+		return checkDeviceSession(claims)
+	}
+	return nil
+}
+
+// checkDeviceSession rejects tokens whose device session was revoked and
+// notes when the device was last seen.
+func checkDeviceSession(claims *Claims) error {
+	now := time.Now()
+	var count int64
+	if err := sessionDB.Table("device_sessions").
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, now).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTokenRevoked
+	}
+
+	// At most one write per device per minute
+	return sessionDB.Table("device_sessions").
+		Where("id = ? AND last_used_at < ?", claims.SessionID, now.Add(-time.Minute)).
+		Update("last_used_at", now).Error
+}
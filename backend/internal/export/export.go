@@ -0,0 +1,424 @@
+// Package export assembles a ZIP archive of everything stored about a user,
+// as JSON for machines and HTML for people.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+// UploadsDir is where journal audio lives on disk.
+var UploadsDir = "./uploads"
+
+type section struct {
+	Name    string // file name without extension
+	Title   string
+	Records any
+}
+
+// Write streams the archive for userID to w.
+func Write(db *gorm.DB, userID uint, w io.Writer) error {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	sections, audio, err := collect(db, user)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, s := range sections {
+		data, err := json.MarshalIndent(s.Records, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFile(zw, "json/"+s.Name+".json", data); err != nil {
+			return err
+		}
+	}
+
+	page, err := renderHTML(user, sections, audio)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(zw, "index.html", page); err != nil {
+		return err
+	}
+
+	for name, path := range audio {
+		if err := copyFile(zw, "audio/"+name, path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func copyFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// collect loads every section for the user's role. audio maps archive file
+// names to files on disk.
+func collect(db *gorm.DB, user models.User) ([]section, map[string]string, error) {
+	sections := []section{{Name: "user", Title: "Account", Records: user}}
+	audio := map[string]string{}
+
+	var authored []models.Comment
+	if err := db.Where("author_id = ?", user.ID).Order("created_at").Find(&authored).Error; err != nil {
+		return nil, nil, err
+	}
+	var messages []models.Message
+	if err := db.Where("sender_id = ?", user.ID).Order("created_at").Find(&messages).Error; err != nil {
+		return nil, nil, err
+	}
+	var notifications []models.Notification
+	if err := db.Where("user_id = ?", user.ID).Order("created_at").Find(&notifications).Error; err != nil {
+		return nil, nil, err
+	}
+	var reminderRules []models.ReminderRule
+	if err := db.Where("user_id = ?", user.ID).Order("minutes_before DESC").Find(&reminderRules).Error; err != nil {
+		return nil, nil, err
+	}
+
+	switch user.Role {
+	case models.RoleRecipient:
+		var recipient models.Recipient
+		if err := db.First(&recipient, "user_id = ?", user.ID).Error; err != nil {
+			return nil, nil, err
+		}
+
+		var entries []models.JournalEntry
+		if err := db.Preload("Shares").Where("recipient_id = ?", recipient.ID).Order("created_at").Find(&entries).Error; err != nil {
+			return nil, nil, err
+		}
+		entryIDs := make([]uint, len(entries))
+		for i, e := range entries {
+			entryIDs[i] = e.ID
+			// Relationships are exported separately
+			entries[i].Recipient = models.Recipient{}
+			if e.AudioUrl == "" {
+				continue
+			}
+			upload, err := models.UploadByURL(db, e.AudioUrl)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			audio[fmt.Sprintf("%d-%s", e.ID, upload.Name)] = upload.Path(UploadsDir)
+		}
+
+		var revisions []models.JournalEntryRevision
+		var received []models.Comment
+		if len(entryIDs) > 0 {
+			if err := db.Where("journal_entry_id IN ?", entryIDs).Order("created_at").Find(&revisions).Error; err != nil {
+				return nil, nil, err
+			}
+			if err := db.Where("journal_entry_id IN ?", entryIDs).Order("created_at").Find(&received).Error; err != nil {
+				return nil, nil, err
+			}
+		}
+
+		var todos []models.Todo
+		if err := db.Where("recipient_id = ?", recipient.ID).Order("due_date").Find(&todos).Error; err != nil {
+			return nil, nil, err
+		}
+		requests, err := careRequests(db, "recipient_id", recipient.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		caregivers, err := relationships(db, `
+			SELECT 'caregiver' AS kind, users.name, users.username, cr.created_at AS since
+			FROM caregiver_recipients cr
+			JOIN caregivers ON caregivers.id = cr.caregiver_id
+			JOIN users ON users.id = caregivers.user_id
+			WHERE cr.recipient_id = ?
+			UNION ALL
+			SELECT 'guardian', users.name, users.username, gr.created_at
+			FROM guardian_recipients gr
+			JOIN guardians ON guardians.id = gr.guardian_id
+			JOIN users ON users.id = guardians.user_id
+			WHERE gr.recipient_id = ?`, recipient.ID, recipient.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var notes []models.HandoverNote
+		if err := db.Where("recipient_id = ?", recipient.ID).Order("created_at").Find(&notes).Error; err != nil {
+			return nil, nil, err
+		}
+
+		sections = append(sections,
+			section{Name: "profile", Title: "Recipient profile", Records: recipient},
+			section{Name: "journal_entries", Title: "Journal entries", Records: entries},
+			section{Name: "journal_entry_revisions", Title: "Journal entry edit history", Records: revisions},
+			section{Name: "comments_received", Title: "Comments on your journal", Records: received},
+			section{Name: "todos", Title: "Todos", Records: todos},
+			section{Name: "care_requests", Title: "Care requests", Records: requests},
+			section{Name: "relationships", Title: "Caregivers and guardians", Records: caregivers},
+			section{Name: "handover_notes", Title: "Caregiver handover notes about you", Records: notes},
+		)
+
+	case models.RoleCaregiver:
+		var caregiver models.Caregiver
+		if err := db.First(&caregiver, "user_id = ?", user.ID).Error; err != nil {
+			return nil, nil, err
+		}
+		var todos []models.Todo
+		if err := db.Where("caregiver_id = ?", caregiver.ID).Order("due_date").Find(&todos).Error; err != nil {
+			return nil, nil, err
+		}
+		requests, err := careRequests(db, "caregiver_id", caregiver.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		recipients, err := relationships(db, `
+			SELECT 'recipient' AS kind, users.name, users.username, cr.created_at AS since
+			FROM caregiver_recipients cr
+			JOIN recipients ON recipients.id = cr.recipient_id
+			JOIN users ON users.id = recipients.user_id
+			WHERE cr.caregiver_id = ?`, caregiver.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var notes []models.HandoverNote
+		if err := db.Where("author_id = ?", caregiver.ID).Order("created_at").Find(&notes).Error; err != nil {
+			return nil, nil, err
+		}
+
+		sections = append(sections,
+			section{Name: "profile", Title: "Caregiver profile", Records: caregiver},
+			section{Name: "todos", Title: "Todos", Records: todos},
+			section{Name: "care_requests", Title: "Care requests", Records: requests},
+			section{Name: "relationships", Title: "Recipients", Records: recipients},
+			section{Name: "handover_notes", Title: "Handover notes you wrote", Records: notes},
+		)
+
+	case models.RoleGuardian:
+		var guardian models.Guardian
+		if err := db.First(&guardian, "user_id = ?", user.ID).Error; err != nil {
+			return nil, nil, err
+		}
+		recipients, err := relationships(db, `
+			SELECT 'recipient' AS kind, users.name, users.username, gr.created_at AS since
+			FROM guardian_recipients gr
+			JOIN recipients ON recipients.id = gr.recipient_id
+			JOIN users ON users.id = recipients.user_id
+			WHERE gr.guardian_id = ?`, guardian.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		sections = append(sections,
+			section{Name: "profile", Title: "Guardian profile", Records: guardian},
+			section{Name: "relationships", Title: "Recipients", Records: recipients},
+		)
+	}
+
+	sections = append(sections,
+		section{Name: "comments_authored", Title: "Comments you wrote", Records: authored},
+		section{Name: "messages_sent", Title: "Messages you sent", Records: messages},
+		section{Name: "notifications", Title: "Notifications", Records: notifications},
+		section{Name: "reminder_rules", Title: "Reminder rules", Records: reminderRules},
+	)
+	return sections, audio, nil
+}
+
+type careRequestRecord struct {
+	ID          uint                     `json:"id"`
+	Caregiver   string                   `json:"caregiver"`
+	Recipient   string                   `json:"recipient"`
+	Status      models.CareRequestStatus `json:"status"`
+	RequestedAt time.Time                `json:"requestedAt"`
+	RespondedAt *time.Time               `json:"respondedAt"`
+}
+
+func careRequests(db *gorm.DB, column string, id uint) ([]careRequestRecord, error) {
+	var requests []models.CareRequest
+	if err := db.
+		Preload("Caregiver.User").
+		Preload("Recipient.User").
+		Where(column+" = ?", id).
+		Order("requested_at").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]careRequestRecord, len(requests))
+	for i, r := range requests {
+		records[i] = careRequestRecord{
+			ID:          r.ID,
+			Caregiver:   r.Caregiver.User.Name,
+			Recipient:   r.Recipient.User.Name,
+			Status:      r.Status,
+			RequestedAt: r.RequestedAt,
+			RespondedAt: r.RespondedAt,
+		}
+	}
+	return records, nil
+}
+
+type relationship struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Username string    `json:"username"`
+	Since    time.Time `json:"since"`
+}
+
+func relationships(db *gorm.DB, query string, args ...any) ([]relationship, error) {
+	var rows []relationship
+	err := db.Raw(query, args...).Scan(&rows).Error
+	return rows, err
+}
+
+type htmlTable struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+var page = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Your data – {{.User.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2rem; font-size: 0.9rem; }
+th, td { border: 1px solid #ccc; padding: 0.3rem 0.5rem; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+</style>
+</head>
+<body>
+<h1>Your data</h1>
+<p>Exported for {{.User.Name}} ({{.User.Username}}) on {{.Generated}}. The same records are in the <code>json</code> folder.</p>
+{{range .Tables}}
+<h2>{{.Title}}</h2>
+{{if .Rows}}<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>Nothing stored.</p>{{end}}
+{{end}}
+{{if .Audio}}<h2>Audio recordings</h2>
+<ul>{{range .Audio}}<li><a href="audio/{{.}}">{{.}}</a></li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+func renderHTML(user models.User, sections []section, audio map[string]string) ([]byte, error) {
+	tables := make([]htmlTable, 0, len(sections))
+	for _, s := range sections {
+		t, err := toTable(s)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+
+	names := make([]string, 0, len(audio))
+	for name := range audio {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	err := page.Execute(&buf, map[string]any{
+		"User":      user,
+		"Generated": time.Now().Format("2 January 2006 15:04 MST"),
+		"Tables":    tables,
+		"Audio":     names,
+	})
+	return buf.Bytes(), err
+}
+
+// toTable flattens records through their JSON form so the HTML always shows
+// the same fields as the JSON files.
+func toTable(s section) (htmlTable, error) {
+	data, err := json.Marshal(s.Records)
+	if err != nil {
+		return htmlTable{}, err
+	}
+
+	var rows []map[string]any
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var row map[string]any
+		if err := json.Unmarshal(data, &row); err != nil {
+			return htmlTable{}, err
+		}
+		rows = []map[string]any{row}
+	} else if err := json.Unmarshal(data, &rows); err != nil {
+		return htmlTable{}, err
+	}
+
+	t := htmlTable{Title: s.Title}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				t.Columns = append(t.Columns, k)
+			}
+		}
+	}
+	sort.Strings(t.Columns)
+
+	for _, row := range rows {
+		cells := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			cells[i] = cell(row[col])
+		}
+		t.Rows = append(t.Rows, cells)
+	}
+	return t, nil
+}
+
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
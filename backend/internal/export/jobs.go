@@ -0,0 +1,134 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+// TTL is how long a finished archive can be downloaded.
+const TTL = 7 * 24 * time.Hour
+
+// JobKind is the background job that builds one archive.
+const JobKind = "export.generate"
+
+type JobPayload struct {
+	ExportID uint `json:"exportId"`
+}
+
+// Dir is where finished archives are kept until they expire.
+func Dir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "./exports"
+}
+
+// Generate builds the archive for a pending export and records the outcome.
+func Generate(db *gorm.DB, exportID uint) error {
+	var exp models.DataExport
+	if err := db.First(&exp, exportID).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&exp).Update("status", models.ExportRunning).Error; err != nil {
+		return err
+	}
+
+	path, size, err := writeArchive(db, exp)
+	now := time.Now()
+	if err != nil {
+		log.Printf("data export %d failed: %v", exp.ID, err)
+		return db.Model(&exp).Updates(map[string]any{
+			"status":       models.ExportFailed,
+			"error":        err.Error(),
+			"completed_at": now,
+		}).Error
+	}
+
+	return db.Model(&exp).Updates(map[string]any{
+		"status":       models.ExportReady,
+		"file_path":    path,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   now.Add(TTL),
+	}).Error
+}
+
+func writeArchive(db *gorm.DB, exp models.DataExport) (string, int64, error) {
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(Dir(), fmt.Sprintf("export-%d-%d.zip", exp.UserID, exp.ID))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := Write(db, exp.UserID, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+// PurgeExpired deletes archives past their expiry.
+func PurgeExpired(db *gorm.DB) error {
+	var expired []models.DataExport
+	if err := db.Where("status = ? AND expires_at < ?", models.ExportReady, time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, exp := range expired {
+		if err := os.Remove(exp.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := db.Model(&exp).Updates(map[string]any{
+			"status":    models.ExportExpired,
+			"file_path": "",
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Signature authenticates a download link so it works without a bearer
+// token, e.g. when opened in a new tab. It is empty when JWT_SECRET isn't set,
+// since anyone could sign links with an empty key.
+func Signature(exportID uint, expires time.Time) string {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "export:%d:%d", exportID, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a link produced with Signature.
+func VerifySignature(exportID uint, expiresUnix, sig string) bool {
+	unix, err := strconv.ParseInt(expiresUnix, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := Signature(exportID, time.Unix(unix, 0))
+	return expected != "" && hmac.Equal([]byte(expected), []byte(sig))
+}
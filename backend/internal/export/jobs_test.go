@@ -0,0 +1,37 @@
+package export
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		secret  string
+		id      uint
+		expires time.Time
+		sig     func() string
+		want    bool
+	}{
+		{"valid", "secret", 1, future, func() string { return Signature(1, future) }, true},
+		{"other export", "secret", 2, future, func() string { return Signature(1, future) }, false},
+		{"expired", "secret", 1, past, func() string { return Signature(1, past) }, false},
+		{"tampered expiry", "secret", 1, future.Add(time.Hour), func() string { return Signature(1, future) }, false},
+		{"empty signature", "secret", 1, future, func() string { return "" }, false},
+		{"no secret configured", "", 1, future, func() string { return Signature(1, future) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.secret)
+			got := VerifySignature(tt.id, strconv.FormatInt(tt.expires.Unix(), 10), tt.sig())
+			if got != tt.want {
+				t.Errorf("VerifySignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
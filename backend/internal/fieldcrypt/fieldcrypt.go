@@ -0,0 +1,208 @@
+// Package fieldcrypt encrypts individual database columns with envelope
+// encryption: every value gets its own data key, which is wrapped with a
+// master key from a KeyProvider. Columns opt in with the GORM tag
+// `serializer:encrypted`, so handlers only ever see plaintext.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyProvider supplies master keys. Keys are 32 bytes (AES-256) and are
+// identified by an ID stored next to every value, so old keys keep
+// decrypting after the current one changes.
+type KeyProvider interface {
+	CurrentKeyID() string
+	Key(id string) ([]byte, error)
+}
+
+// Stored values start with marker and a version. v1 values were sealed
+// without associated data; v2 values are bound to the row and column they
+// are stored in, so they can't be copied to another row. Reencrypt upgrades
+// v1 values.
+const (
+	marker   = "enc:"
+	prefixV1 = marker + "v1:"
+	prefix   = marker + "v2:"
+)
+
+var (
+	ErrUnknownKey  = errors.New("unknown encryption key")
+	ErrNoProvider  = errors.New("field encryption is not configured")
+	errMalformed   = errors.New("malformed encrypted value")
+	errNoRowID     = errors.New("encrypted values need the row's primary key")
+	provider       KeyProvider
+	encoding       = base64.RawStdEncoding
+	dataKeyLength  = 32
+	masterKeyBytes = 32
+)
+
+// Location is where a value is stored. It is sealed with the value as
+// associated data, so a value moved to another row or column fails to
+// decrypt.
+type Location struct {
+	Table  string
+	Column string
+	RowID  uint
+}
+
+func (l Location) aad() []byte {
+	return []byte(fmt.Sprintf("%s.%s:%d", l.Table, l.Column, l.RowID))
+}
+
+// SetProvider enables encryption. Without a provider values are written in
+// plaintext and encrypted values can't be read.
+func SetProvider(p KeyProvider) {
+	provider = p
+}
+
+func Enabled() bool {
+	return provider != nil
+}
+
+// IsEncrypted reports whether a stored value is ciphertext, or claims to be.
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, marker)
+}
+
+// KeyID returns the master key a stored value was encrypted with, or "" for
+// plaintext.
+func KeyID(stored string) string {
+	_, rest, ok := cutVersion(stored)
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, ":")
+	return id
+}
+
+// cutVersion splits a stored value into its version prefix and the rest.
+func cutVersion(stored string) (string, string, bool) {
+	for _, p := range []string{prefix, prefixV1} {
+		if rest, ok := strings.CutPrefix(stored, p); ok {
+			return p, rest, true
+		}
+	}
+	return "", "", false
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errMalformed
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+// Encrypt seals plaintext for loc under a fresh data key wrapped with the
+// current master key: enc:v2:<key id>:<wrapped data key>:<ciphertext>.
+func Encrypt(plaintext string, loc Location) (string, error) {
+	if provider == nil {
+		return "", ErrNoProvider
+	}
+	if loc.RowID == 0 {
+		return "", errNoRowID
+	}
+	keyID := provider.CurrentKeyID()
+	master, err := provider.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, dataKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aad := loc.aad()
+	wrapped, err := seal(master, dataKey, aad)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + keyID + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens a value produced by Encrypt for the same loc. Values without
+// the enc: marker, e.g. rows written before encryption was turned on, are
+// returned unchanged; anything with the marker must decrypt, so an unknown
+// version or a value moved from elsewhere is an error.
+func Decrypt(stored string, loc Location) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+	if provider == nil {
+		return "", ErrNoProvider
+	}
+
+	version, rest, ok := cutVersion(stored)
+	if !ok {
+		return "", errMalformed
+	}
+	var aad []byte
+	if version == prefix {
+		if loc.RowID == 0 {
+			return "", errNoRowID
+		}
+		aad = loc.aad()
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", errMalformed
+	}
+	master, err := provider.Key(parts[0])
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errMalformed
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errMalformed
+	}
+
+	dataKey, err := open(master, wrapped, aad)
+	if err != nil {
+		return "", fmt.Errorf("unwrapping data key: %w", err)
+	}
+	plaintext, err := open(dataKey, ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,257 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+var (
+	keyA = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	keyB = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+)
+
+// useKeys installs a provider for the test and removes it afterwards.
+func useKeys(t *testing.T, spec, current string) *LocalKeyProvider {
+	t.Helper()
+	p, err := ParseKeys(spec, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetProvider(p)
+	t.Cleanup(func() { SetProvider(nil) })
+	return p
+}
+
+// sealV1 builds a value in the old format, which had no associated data.
+func sealV1(t *testing.T, p KeyProvider, plaintext string) string {
+	t.Helper()
+	master, _ := p.Key(p.CurrentKeyID())
+	dataKey := []byte(strings.Repeat("d", dataKeyLength))
+	wrapped, err := seal(master, dataKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefixV1 + p.CurrentKeyID() + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(ciphertext)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	p := useKeys(t, "a="+keyA, "")
+	loc := Location{Table: "journal_entries", Column: "content", RowID: 7}
+	sealed, err := Encrypt("dear diary", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v2:a:") {
+		t.Fatalf("sealed = %q, want enc:v2:a: prefix", sealed)
+	}
+	tampered := []byte(sealed)
+	tampered[len(tampered)-3] ^= 1 // stays valid base64, changes the GCM tag
+
+	tests := []struct {
+		name    string
+		stored  string
+		loc     Location
+		want    string
+		wantErr bool
+	}{
+		{"same location", sealed, loc, "dear diary", false},
+		{"other row", sealed, Location{"journal_entries", "content", 8}, "", true},
+		{"other column", sealed, Location{"journal_entries", "transcript", 7}, "", true},
+		{"other table", sealed, Location{"comments", "content", 7}, "", true},
+		{"no row id", sealed, Location{"journal_entries", "content", 0}, "", true},
+		{"plaintext passes through", "written before encryption", loc, "written before encryption", false},
+		{"legacy v1 value", sealV1(t, p, "old"), loc, "old", false},
+		{"unknown version", "enc:v9:a:xx:yy", loc, "", true},
+		{"bare marker", "enc:", loc, "", true},
+		{"missing parts", "enc:v2:a:xx", loc, "", true},
+		{"bad base64", "enc:v2:a:!!:??", loc, "", true},
+		{"unknown key", strings.Replace(sealed, "enc:v2:a:", "enc:v2:z:", 1), loc, "", true},
+		{"tampered ciphertext", string(tampered), loc, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.stored, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptNeedsRowID(t *testing.T) {
+	useKeys(t, "a="+keyA, "")
+	if _, err := Encrypt("x", Location{Table: "comments", Column: "content"}); !errors.Is(err, errNoRowID) {
+		t.Errorf("Encrypt without a row id: err = %v, want errNoRowID", err)
+	}
+}
+
+func TestNoProvider(t *testing.T) {
+	SetProvider(nil)
+	loc := Location{"comments", "content", 1}
+	if _, err := Encrypt("x", loc); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("Encrypt err = %v, want ErrNoProvider", err)
+	}
+	if _, err := Decrypt("enc:v2:a:xx:yy", loc); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("Decrypt err = %v, want ErrNoProvider", err)
+	}
+	if got, err := Decrypt("plain", loc); err != nil || got != "plain" {
+		t.Errorf("Decrypt plaintext = %q, %v", got, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	useKeys(t, "a="+keyA, "")
+	loc := Location{"recipients", "condition", 3}
+	old, err := Encrypt("asthma", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useKeys(t, "a="+keyA+",b="+keyB, "")
+	fresh, err := Encrypt("asthma", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stored    string
+		wantKeyID string
+	}{
+		{old, "a"},
+		{fresh, "b"},
+		{"plain", ""},
+	}
+	for _, tt := range tests {
+		if got := KeyID(tt.stored); got != tt.wantKeyID {
+			t.Errorf("KeyID(%.12s…) = %q, want %q", tt.stored, got, tt.wantKeyID)
+		}
+		if got, err := Decrypt(tt.stored, loc); err != nil || (tt.wantKeyID != "" && got != "asthma") {
+			t.Errorf("Decrypt(%.12s…) = %q, %v", tt.stored, got, err)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		current     string
+		wantCurrent string
+		wantErr     bool
+	}{
+		{"single key", "a=" + keyA, "", "a", false},
+		{"last key is current", "a=" + keyA + ",b=" + keyB, "", "b", false},
+		{"explicit current", "a=" + keyA + "\nb=" + keyB, "a", "a", false},
+		{"comments and blanks", "# old\na=" + keyA + "\n\n", "", "a", false},
+		{"unknown current", "a=" + keyA, "b", "", true},
+		{"missing id", "=" + keyA, "", "", true},
+		{"colon in id", "a:b=" + keyA, "", "", true},
+		{"short key", "a=" + base64.StdEncoding.EncodeToString([]byte("short")), "", "", true},
+		{"no keys", "# nothing", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseKeys(tt.spec, tt.current)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && p.CurrentKeyID() != tt.wantCurrent {
+				t.Errorf("current = %q, want %q", p.CurrentKeyID(), tt.wantCurrent)
+			}
+		})
+	}
+}
+
+type note struct {
+	ID   uint
+	Body *string `gorm:"serializer:encrypted"`
+}
+
+func TestSerializer(t *testing.T) {
+	useKeys(t, "a="+keyA, "")
+	s, err := schema.Parse(&note{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := s.LookUpField("body")
+	ctx := context.Background()
+	body := "remember the keys"
+
+	row := note{ID: 5, Body: &body}
+	stored, err := Serializer{}.Value(ctx, field, reflect.ValueOf(&row).Elem(), row.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		id      uint
+		stored  any
+		want    *string
+		wantErr bool
+	}{
+		{"same row", ctx, 5, stored, &body, false},
+		{"copied to another row", ctx, 6, stored, nil, true},
+		{"primary key not loaded", ctx, 0, stored, nil, true},
+		{"read as another table", context.WithValue(ctx, tableKey{}, "other"), 5, stored, nil, true},
+		{"null", ctx, 5, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := note{ID: tt.id}
+			err := Serializer{}.Scan(tt.ctx, field, reflect.ValueOf(&dst).Elem(), tt.stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(dst.Body, tt.want) {
+				t.Errorf("Body = %v, want %v", dst.Body, tt.want)
+			}
+		})
+	}
+
+	if _, err := (Serializer{}).Value(ctx, field, reflect.ValueOf(&note{}).Elem(), &body); !errors.Is(err, errNoRowID) {
+		t.Errorf("Value for a row without an ID: err = %v, want errNoRowID", err)
+	}
+}
+
+func TestSerializerWithoutProvider(t *testing.T) {
+	SetProvider(nil)
+	s, err := schema.Parse(&note{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := s.LookUpField("body")
+	row := reflect.ValueOf(&note{}).Elem()
+
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"plain text", false},
+		{"enc:v2:looks:like:ciphertext", true},
+	}
+	for _, tt := range tests {
+		got, err := Serializer{}.Value(context.Background(), field, row, &tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Value(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+		if err == nil && got != tt.value {
+			t.Errorf("Value(%q) = %v, want it unchanged", tt.value, got)
+		}
+	}
+}
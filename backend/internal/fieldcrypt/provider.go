@@ -0,0 +1,83 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LocalKeyProvider holds master keys in memory, loaded from the environment
+// or a file.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+func (p *LocalKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// ParseKeys reads "id=base64key" entries separated by commas or newlines.
+// Blank lines and lines starting with # are ignored. The current key is
+// current, or the last one listed when current is empty, so rotating is just
+// appending a new key.
+func ParseKeys(spec, current string) (*LocalKeyProvider, error) {
+	p := &LocalKeyProvider{keys: map[string][]byte{}}
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(field, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key entry %q, want id=base64key", field)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != masterKeyBytes {
+			return nil, fmt.Errorf("key %q must be %d bytes, base64 encoded", id, masterKeyBytes)
+		}
+		p.keys[id] = key
+		p.current = id
+	}
+
+	if len(p.keys) == 0 {
+		return nil, fmt.Errorf("no keys configured")
+	}
+	if current != "" {
+		if _, ok := p.keys[current]; !ok {
+			return nil, fmt.Errorf("current key %q is not configured", current)
+		}
+		p.current = current
+	}
+	return p, nil
+}
+
+// FromEnv builds a provider from FIELD_ENCRYPTION_KEYS, or from the file named
+// by FIELD_ENCRYPTION_KEY_FILE. FIELD_ENCRYPTION_CURRENT_KEY picks the key new
+// values are written with. It returns nil, nil when neither is set, which
+// leaves encryption off.
+func FromEnv() (KeyProvider, error) {
+	spec := os.Getenv("FIELD_ENCRYPTION_KEYS")
+	if path := os.Getenv("FIELD_ENCRYPTION_KEY_FILE"); spec == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(data)
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	return ParseKeys(spec, os.Getenv("FIELD_ENCRYPTION_CURRENT_KEY"))
+}
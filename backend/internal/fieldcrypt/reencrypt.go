@@ -0,0 +1,87 @@
+package fieldcrypt
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const reencryptBatch = 200
+
+// Reencrypt rewrites every encrypted column of the given models that is still
+// plaintext, sealed with an older master key or in the v1 format that isn't
+// bound to its row, so retired keys can be removed once it has run. Rows are updated directly, leaving updated_at and
+// hooks alone, and a row edited in the meantime is skipped until the next
+// run. It returns the number of values rewritten.
+func Reencrypt(db *gorm.DB, values ...any) (int, error) {
+	if provider == nil {
+		return 0, ErrNoProvider
+	}
+
+	total := 0
+	for _, value := range values {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(value); err != nil {
+			return total, err
+		}
+		if stmt.Schema.PrioritizedPrimaryField == nil {
+			continue
+		}
+		key := stmt.Schema.PrioritizedPrimaryField.DBName
+
+		for _, field := range stmt.Schema.Fields {
+			if !strings.EqualFold(field.TagSettings["SERIALIZER"], "encrypted") || field.DBName == "" {
+				continue
+			}
+			n, err := reencryptColumn(db, stmt.Schema.Table, key, field.DBName)
+			total += n
+			if err != nil {
+				return total, fmt.Errorf("%s.%s: %w", stmt.Schema.Table, field.DBName, err)
+			}
+		}
+	}
+	return total, nil
+}
+
+func reencryptColumn(db *gorm.DB, table, key, column string) (int, error) {
+	current := prefix + provider.CurrentKeyID() + ":%"
+	loc := Location{Table: table, Column: column}
+	query := fmt.Sprintf(`SELECT %[2]s AS id, %[3]s AS value FROM %[1]s
+		WHERE %[3]s IS NOT NULL AND %[3]s NOT LIKE ? AND %[2]s > ?
+		ORDER BY %[2]s LIMIT ?`, table, key, column)
+	update := fmt.Sprintf(`UPDATE %[1]s SET %[3]s = ? WHERE %[2]s = ? AND %[3]s = ?`, table, key, column)
+
+	var lastID uint
+	done := 0
+	for {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		if err := db.Raw(query, current, lastID, reencryptBatch).Scan(&rows).Error; err != nil {
+			return done, err
+		}
+		if len(rows) == 0 {
+			return done, nil
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			loc.RowID = row.ID
+			plaintext, err := Decrypt(row.Value, loc)
+			if err != nil {
+				return done, fmt.Errorf("row %d: %w", row.ID, err)
+			}
+			sealed, err := Encrypt(plaintext, loc)
+			if err != nil {
+				return done, err
+			}
+			res := db.Exec(update, sealed, row.ID, row.Value)
+			if res.Error != nil {
+				return done, res.Error
+			}
+			done += int(res.RowsAffected)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer encrypts string and *string fields tagged
+// `serializer:encrypted`. Values are bound to their table, column and the
+// row's primary key, so the key must be loaded before the field is read and
+// set before it is written; Register assigns keys to new rows. With no
+// provider configured values pass through in plaintext, so development
+// setups need no keys.
+type Serializer struct{}
+
+type tableKey struct{}
+
+// FromTable makes encrypted fields scanned by db's queries decrypt as stored
+// in table. It is for result structs that aren't the model itself, e.g. a
+// revision read from either revision table.
+func FromTable(db *gorm.DB, table string) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, tableKey{}, table))
+}
+
+// location works out where the field of the row dst is stored.
+func location(ctx context.Context, field *schema.Field, dst reflect.Value) (Location, error) {
+	loc := Location{Table: field.Schema.Table, Column: field.DBName}
+	if table, ok := ctx.Value(tableKey{}).(string); ok {
+		loc.Table = table
+	}
+	pk := field.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return loc, fmt.Errorf("%s.%s: %w", loc.Table, loc.Column, errNoRowID)
+	}
+	id, zero := pk.ValueOf(ctx, dst)
+	if zero {
+		return loc, fmt.Errorf("%s.%s: %w", loc.Table, loc.Column, errNoRowID)
+	}
+	switch v := id.(type) {
+	case uint:
+		loc.RowID = v
+	default:
+		return loc, fmt.Errorf("%s.%s: unsupported primary key type %T", loc.Table, loc.Column, id)
+	}
+	return loc, nil
+}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+		return field.Set(ctx, dst, nil)
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported encrypted column value %T", dbValue)
+	}
+
+	var plaintext string
+	if IsEncrypted(stored) {
+		loc, err := location(ctx, field, dst)
+		if err != nil {
+			return err
+		}
+		if plaintext, err = Decrypt(stored, loc); err != nil {
+			return fmt.Errorf("%s.%s: %w", loc.Table, loc.Column, err)
+		}
+	} else {
+		plaintext = stored
+	}
+	if field.FieldType.Kind() == reflect.Ptr {
+		return field.Set(ctx, dst, &plaintext)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	var plaintext string
+	switch v := fieldValue.(type) {
+	case string:
+		plaintext = v
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		plaintext = *v
+	default:
+		return nil, fmt.Errorf("unsupported encrypted field type %T", fieldValue)
+	}
+
+	if !Enabled() {
+		// It would be read back as ciphertext
+		if IsEncrypted(plaintext) {
+			return nil, fmt.Errorf("%s.%s: plaintext can't start with %q", field.Schema.Table, field.DBName, marker)
+		}
+		return plaintext, nil
+	}
+	loc, err := location(ctx, field, dst)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(plaintext, loc)
+}
+
+// Register makes db give new rows of models with encrypted fields their
+// primary key before they are inserted, since the key is part of what the
+// values are bound to.
+func Register(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register("fieldcrypt:assign_ids", assignIDs)
+}
+
+func hasEncryptedFields(s *schema.Schema) bool {
+	for _, field := range s.Fields {
+		if strings.EqualFold(field.TagSettings["SERIALIZER"], "encrypted") {
+			return true
+		}
+	}
+	return false
+}
+
+func assignIDs(db *gorm.DB) {
+	s := db.Statement.Schema
+	if db.Error != nil || !Enabled() || s == nil || !hasEncryptedFields(s) {
+		return
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil || !pk.AutoIncrement {
+		return
+	}
+
+	ctx := db.Statement.Context
+	assign := func(row reflect.Value) {
+		if _, zero := pk.ValueOf(ctx, row); !zero {
+			return
+		}
+		var id uint
+		if err := db.Session(&gorm.Session{NewDB: true}).
+			Raw("SELECT nextval(pg_get_serial_sequence(?, ?))", s.Table, pk.DBName).
+			Scan(&id).Error; err != nil {
+			db.AddError(err)
+			return
+		}
+		db.AddError(pk.Set(ctx, row, id))
+	}
+
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
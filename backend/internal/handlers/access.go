@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+// requireUser returns the authenticated caller, writing a 401 for anonymous
+// requests on routes behind OptionalMiddleware.
+func requireUser(c *gin.Context) (uint, bool) {
+	userID := auth.UserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// callerCaregiver resolves the authenticated caller's caregiver profile,
+// writing a 401 or 403 and returning false when there is none.
+func callerCaregiver(c *gin.Context, db *gorm.DB) (models.Caregiver, bool) {
+	var caregiver models.Caregiver
+	userID, ok := requireUser(c)
+	if !ok {
+		return caregiver, false
+	}
+	if err := db.First(&caregiver, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers can do this"})
+			return caregiver, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return caregiver, false
+	}
+	return caregiver, true
+}
+
+// linkedCaregiver resolves the authenticated caller as a caregiver linked to
+// the recipient, writing a 403 and returning false otherwise.
+func linkedCaregiver(c *gin.Context, db *gorm.DB, recipientID uint) (models.Caregiver, bool) {
+	caregiver, ok := callerCaregiver(c, db)
+	if !ok {
+		return caregiver, false
+	}
+
+	var count int64
+	if err := db.Model(&models.CaregiverRecipient{}).
+		Where("caregiver_id = ? AND recipient_id = ?", caregiver.ID, recipientID).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return caregiver, false
+	}
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caregiver is not linked to this recipient"})
+		return caregiver, false
+	}
+
+	return caregiver, true
+}
+
+// isRecipientUser reports whether the authenticated caller is the recipient.
+func isRecipientUser(c *gin.Context, db *gorm.DB, recipientID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Recipient{}).
+		Where("id = ? AND user_id = ?", recipientID, auth.UserID(c)).
+		Count(&count).Error
+	return count > 0, err
+}
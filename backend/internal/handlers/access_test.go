@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"hack4good/internal/models"
+)
+
+// fakeTables answers a query on a table with the rows that satisfy its
+// "column = $n" conditions on that table. Other conditions, such as ones on
+// joined tables or jsonb scopes, aren't evaluated; TestAccessConditions checks
+// those as SQL.
+type fakeTables map[string][]map[string]driver.Value
+
+var (
+	fromTable = regexp.MustCompile(`FROM "?(\w+)"?`)
+	equals    = regexp.MustCompile(`(?:"?(\w+)"?\.)?"?(\w+)"? = \$(\d+)`)
+)
+
+// matches reports whether row satisfies every equality condition in query
+// that is on table and names one of the row's columns.
+func matches(table string, row map[string]driver.Value, query string, args []driver.NamedValue) bool {
+	for _, m := range equals.FindAllStringSubmatch(query, -1) {
+		if m[1] != "" && m[1] != table {
+			continue
+		}
+		value, ok := row[m[2]]
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(m[3])
+		if n < 1 || n > len(args) || fmt.Sprint(args[n-1].Value) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t fakeTables) Connect(context.Context) (driver.Conn, error) { return fakeConn{t}, nil }
+func (t fakeTables) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ tables fakeTables }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	m := fromTable.FindStringSubmatch(query)
+	if m == nil {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	var rows []map[string]driver.Value
+	for _, row := range c.tables[m[1]] {
+		if matches(m[1], row, query, args) {
+			rows = append(rows, row)
+		}
+	}
+	if strings.HasPrefix(query, "SELECT count(*)") {
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(rows))}}}, nil
+	}
+
+	var columns []string
+	for _, row := range rows {
+		for col := range row {
+			if !slices.Contains(columns, col) {
+				columns = append(columns, col)
+			}
+		}
+	}
+	result := &fakeRows{columns: columns}
+	for _, row := range rows {
+		values := make([]driver.Value, len(columns))
+		for i, col := range columns {
+			values[i] = row[col]
+		}
+		result.values = append(result.values, values)
+	}
+	return result, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func fakeDB(t *testing.T, tables fakeTables) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(tables)}), &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testContext is a request made by the given user; 0 is anonymous.
+func testContext(userID uint, role models.UserRole) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if userID != 0 {
+		c.Set("authUserID", userID)
+		c.Set("authRole", string(role))
+	}
+	return c, w
+}
+
+func TestRequireUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     uint
+		wantOK     bool
+		wantStatus int
+	}{
+		{"anonymous", 0, false, http.StatusUnauthorized},
+		{"signed in", 7, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(tt.userID, models.RoleCaregiver)
+			id, ok := requireUser(c)
+			if ok != tt.wantOK || w.Code != tt.wantStatus {
+				t.Errorf("requireUser = %d, %v with status %d, want ok %v and %d", id, ok, w.Code, tt.wantOK, tt.wantStatus)
+			}
+			if ok && id != tt.userID {
+				t.Errorf("user = %d, want %d", id, tt.userID)
+			}
+		})
+	}
+}
+
+func TestEffectiveScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []models.CaregiverScope
+		want   []models.CaregiverScope
+	}{
+		{"never chosen", nil, models.DefaultCaregiverScopes},
+		{"all revoked", []models.CaregiverScope{}, []models.CaregiverScope{}},
+		{"chosen", []models.CaregiverScope{models.ScopeManageDevices}, []models.CaregiverScope{models.ScopeManageDevices}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := effectiveScopes(models.CaregiverRecipient{Scopes: tt.scopes})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("effectiveScopes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	caregiverRow = map[string]driver.Value{"id": int64(3), "user_id": int64(7)}
+	recipientRow = map[string]driver.Value{"id": int64(2), "user_id": int64(7)}
+
+	// Rows that belong to someone else and must not be found for user 7
+	otherCaregiver = map[string]driver.Value{"id": int64(4), "user_id": int64(8)}
+	otherRecipient = map[string]driver.Value{"id": int64(2), "user_id": int64(8)}
+	otherLink      = map[string]driver.Value{"id": int64(5), "caregiver_id": int64(4), "recipient_id": int64(2)}
+	elsewhereLink  = map[string]driver.Value{"id": int64(6), "caregiver_id": int64(3), "recipient_id": int64(9)}
+)
+
+func link(scopes string) map[string]driver.Value {
+	row := map[string]driver.Value{"id": int64(1), "caregiver_id": int64(3), "recipient_id": int64(2)}
+	if scopes != "" {
+		row["scopes"] = []byte(scopes)
+	}
+	return row
+}
+
+func TestAuthorizationHelpers(t *testing.T) {
+	callerScope := func(scope models.CaregiverScope) func(*gin.Context, *gorm.DB) bool {
+		return func(c *gin.Context, db *gorm.DB) bool { return requireCallerScope(c, db, 2, scope) }
+	}
+	caregiver := func(c *gin.Context, db *gorm.DB) bool {
+		_, ok := callerCaregiver(c, db)
+		return ok
+	}
+	linked := func(c *gin.Context, db *gorm.DB) bool {
+		_, ok := linkedCaregiver(c, db, 2)
+		return ok
+	}
+	devices := func(c *gin.Context, db *gorm.DB) bool { return managesRecipientDevices(c, db, 2) }
+	commenter := func(c *gin.Context, db *gorm.DB) bool { return requireCommenter(c, db, 2) }
+	guardianLink := func(canViewJournal bool) map[string]driver.Value {
+		return map[string]driver.Value{"id": int64(1), "guardian_id": int64(1), "recipient_id": int64(2), "can_view_journal": canViewJournal}
+	}
+
+	tests := []struct {
+		name       string
+		check      func(*gin.Context, *gorm.DB) bool
+		userID     uint
+		role       models.UserRole
+		tables     fakeTables
+		wantOK     bool
+		wantStatus int
+	}{
+		{"caregiver: anonymous", caregiver, 0, "", fakeTables{"caregivers": {caregiverRow}}, false, http.StatusUnauthorized},
+		{"caregiver: no profile", caregiver, 7, models.RoleRecipient, fakeTables{}, false, http.StatusForbidden},
+		{"caregiver: only someone else's profile", caregiver, 7, models.RoleCaregiver, fakeTables{"caregivers": {otherCaregiver}}, false, http.StatusForbidden},
+		{"caregiver: has profile", caregiver, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}}, true, http.StatusOK},
+
+		{"linked: anonymous", linked, 0, "", fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, false, http.StatusUnauthorized},
+		{"linked: not linked", linked, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}}, false, http.StatusForbidden},
+		{"linked: only another caregiver is linked", linked, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow, otherCaregiver}, "caregiver_recipients": {otherLink}}, false, http.StatusForbidden},
+		{"linked: linked to another recipient", linked, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {elsewhereLink}}, false, http.StatusForbidden},
+		{"linked: linked", linked, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, true, http.StatusOK},
+
+		{"scope: anonymous", callerScope(models.ScopeReadJournal), 0, "", fakeTables{"recipients": {recipientRow}}, false, http.StatusUnauthorized},
+		{"scope: the recipient", callerScope(models.ScopeManageDevices), 7, models.RoleRecipient, fakeTables{"recipients": {recipientRow}}, true, http.StatusOK},
+		{"scope: someone else is the recipient", callerScope(models.ScopeManageDevices), 7, models.RoleRecipient, fakeTables{"recipients": {otherRecipient}}, false, http.StatusForbidden},
+		{"scope: another caregiver was granted it", callerScope(models.ScopeViewVitals), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow, otherCaregiver}, "caregiver_recipients": {{"id": int64(5), "caregiver_id": int64(4), "recipient_id": int64(2), "scopes": []byte(`["view_vitals"]`)}}}, false, http.StatusForbidden},
+		{"scope: default grants read_journal", callerScope(models.ScopeReadJournal), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, true, http.StatusOK},
+		{"scope: default lacks view_vitals", callerScope(models.ScopeViewVitals), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, false, http.StatusForbidden},
+		{"scope: granted", callerScope(models.ScopeViewVitals), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link(`["view_vitals"]`)}}, true, http.StatusOK},
+		{"scope: revoked", callerScope(models.ScopeReadJournal), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link(`[]`)}}, false, http.StatusForbidden},
+		{"scope: not linked", callerScope(models.ScopeReadJournal), 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}}, false, http.StatusForbidden},
+		{"scope: neither caregiver nor recipient", callerScope(models.ScopeReadJournal), 7, models.RoleGuardian, fakeTables{}, false, http.StatusForbidden},
+
+		{"devices: anonymous", devices, 0, "", fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link(`["manage_devices"]`)}}, false, http.StatusUnauthorized},
+		{"devices: the recipient", devices, 7, models.RoleRecipient, fakeTables{"recipients": {recipientRow}}, true, http.StatusOK},
+		{"devices: another recipient", devices, 7, models.RoleRecipient, fakeTables{}, false, http.StatusForbidden},
+		{"devices: linked guardian", devices, 7, models.RoleGuardian, fakeTables{"guardian_recipients": {{"id": int64(1)}}}, true, http.StatusOK},
+		{"devices: unlinked guardian", devices, 7, models.RoleGuardian, fakeTables{}, false, http.StatusForbidden},
+		{"devices: caregiver with default scopes", devices, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, false, http.StatusForbidden},
+		{"devices: caregiver granted manage_devices", devices, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link(`["manage_devices"]`)}}, true, http.StatusOK},
+
+		{"commenter: anonymous", commenter, 0, "", fakeTables{"recipients": {recipientRow}}, false, http.StatusUnauthorized},
+		{"commenter: the recipient", commenter, 7, models.RoleRecipient, fakeTables{"recipients": {recipientRow}}, true, http.StatusOK},
+		{"commenter: guardian who may read the journal", commenter, 7, models.RoleGuardian, fakeTables{"guardian_recipients": {guardianLink(true)}}, true, http.StatusOK},
+		{"commenter: guardian who may not", commenter, 7, models.RoleGuardian, fakeTables{"guardian_recipients": {guardianLink(false)}}, false, http.StatusForbidden},
+		{"commenter: neither caregiver, recipient nor guardian", commenter, 7, models.RoleCaregiver, fakeTables{}, false, http.StatusForbidden},
+		{"commenter: unlinked caregiver", commenter, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}}, false, http.StatusForbidden},
+		{"commenter: caregiver with default scopes", commenter, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, true, http.StatusOK},
+		{"commenter: caregiver without comment", commenter, 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link(`["read_journal"]`)}}, false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(tt.userID, tt.role)
+			ok := tt.check(c, fakeDB(t, tt.tables))
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v (response %d %s)", ok, tt.wantOK, w.Code, w.Body)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// render builds the query without running it.
+func render(t *testing.T, query func(*gorm.DB) *gorm.DB) (string, []any) {
+	t.Helper()
+	stmt := query(fakeDB(t, fakeTables{}).Session(&gorm.Session{DryRun: true})).Statement
+	return stmt.SQL.String(), stmt.Vars
+}
+
+// grants evaluates a rendered ScopeGranted condition for a link whose scopes
+// column holds stored, the way Postgres would: a null column falls back to
+// the bound defaults, which must then contain the wanted scope.
+func grants(t *testing.T, vars []any, stored string) bool {
+	t.Helper()
+	var defaults, wanted []models.CaregiverScope
+	if err := json.Unmarshal([]byte(vars[0].(string)), &defaults); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(vars[1].(string)), &wanted); err != nil {
+		t.Fatal(err)
+	}
+	effective := defaults
+	if stored != "" && stored != "null" {
+		effective = nil
+		if err := json.Unmarshal([]byte(stored), &effective); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, scope := range wanted {
+		if !slices.Contains(effective, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScopeGranted(t *testing.T) {
+	tests := []struct {
+		name   string
+		scope  models.CaregiverScope
+		stored string
+		want   bool
+	}{
+		{"never chosen, default scope", models.ScopeComment, "", true},
+		{"json null, default scope", models.ScopeReadJournal, "null", true},
+		{"never chosen, scope outside the defaults", models.ScopeViewVitals, "", false},
+		{"all revoked", models.ScopeComment, `[]`, false},
+		{"granted", models.ScopeViewVitals, `["view_vitals"]`, true},
+		{"other scopes granted", models.ScopeManageTodos, `["read_journal","comment"]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars := render(t, func(db *gorm.DB) *gorm.DB {
+				return db.Where(models.ScopeGranted("cr", tt.scope)).Find(&[]models.CaregiverRecipient{})
+			})
+			if !strings.Contains(sql, "COALESCE(NULLIF(cr.scopes, 'null'::jsonb), $1::jsonb) @> $2::jsonb") {
+				t.Fatalf("unexpected condition: %s", sql)
+			}
+			if got := grants(t, vars, tt.stored); got != tt.want {
+				t.Errorf("grants = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAccessConditions checks the caller and scope bound into the list
+// filters, so no branch matches rows without tying them to the caller.
+func TestAccessConditions(t *testing.T) {
+	defaults, _ := json.Marshal(models.DefaultCaregiverScopes)
+	wanted := func(scope models.CaregiverScope) string { return `["` + string(scope) + `"]` }
+
+	tests := []struct {
+		name     string
+		query    func(*gorm.DB) *gorm.DB
+		contains []string
+		vars     []any
+	}{
+		{
+			name: "journal entries, anonymous",
+			query: func(db *gorm.DB) *gorm.DB {
+				return db.Scopes(readableBy(0)).Find(&[]models.JournalEntry{})
+			},
+			contains: []string{
+				"journal_entries.recipient_id IN (SELECT id FROM recipients WHERE user_id = $1)",
+				"AND caregivers.user_id = $2",
+				"AND COALESCE(NULLIF(caregiver_recipients.scopes, 'null'::jsonb), $3::jsonb) @> $4::jsonb",
+				"AND guardians.user_id = $7 AND guardian_recipients.can_view_journal",
+			},
+			vars: []any{uint(0), uint(0), string(defaults), wanted(models.ScopeReadJournal),
+				models.VisibilityCaregivers, models.VisibilitySelected, uint(0), models.VisibilityCaregivers},
+		},
+		{
+			name: "journal entries, signed in",
+			query: func(db *gorm.DB) *gorm.DB {
+				return db.Scopes(readableBy(7)).Find(&[]models.JournalEntry{})
+			},
+			contains: []string{"WHERE s.journal_entry_id = journal_entries.id AND s.caregiver_id = caregivers.id"},
+			vars: []any{uint(7), uint(7), string(defaults), wanted(models.ScopeReadJournal),
+				models.VisibilityCaregivers, models.VisibilitySelected, uint(7), models.VisibilityCaregivers},
+		},
+		{
+			name: "todos",
+			query: func(db *gorm.DB) *gorm.DB {
+				return db.Scopes(managedBy(7)).Find(&[]models.Todo{})
+			},
+			contains: []string{
+				"todos.recipient_id IN (SELECT id FROM recipients WHERE user_id = $1)",
+				"WHERE caregiver_recipients.recipient_id = todos.recipient_id",
+				"AND caregivers.user_id = $2",
+				"AND COALESCE(NULLIF(caregiver_recipients.scopes, 'null'::jsonb), $3::jsonb) @> $4::jsonb",
+			},
+			vars: []any{uint(7), uint(7), string(defaults), wanted(models.ScopeManageTodos)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars := render(t, tt.query)
+			for _, want := range tt.contains {
+				if !strings.Contains(sql, want) {
+					t.Errorf("missing %q in %s", want, sql)
+				}
+			}
+			if fmt.Sprint(vars) != fmt.Sprint(tt.vars) {
+				t.Errorf("vars = %v, want %v", vars, tt.vars)
+			}
+		})
+	}
+}
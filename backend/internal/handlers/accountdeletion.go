@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"hack4good/internal/accounts"
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+const defaultDeletionGraceDays = 30
+
+// deletionGrace is how long a user can change their mind, from
+// ACCOUNT_DELETION_GRACE_DAYS.
+func deletionGrace() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultDeletionGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type scheduleDeletionRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// ScheduleDeletion marks the caller's account for deletion once the grace
+// period ends. Until then they can log in and cancel.
+func (h AuthHandler) ScheduleDeletion(c *gin.Context) {
+	var req scheduleDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	// An organization must not be left without an admin
+	var member models.OrganizationMember
+	if err := h.DB.First(&member, "user_id = ? AND role = ?", u.ID, models.OrgRoleAdmin).Error; err == nil {
+		var others int64
+		if err := h.DB.Model(&models.OrganizationMember{}).
+			Where("organization_id = ? AND role = ? AND user_id <> ?", member.OrganizationID, models.OrgRoleAdmin, u.ID).
+			Count(&others).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if others == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "make someone else an organization admin before deleting your account"})
+			return
+		}
+	}
+
+	u, err := accounts.ScheduleDeletion(h.DB, u.ID, deletionGrace())
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "account.deletion_scheduled", ResourceType: "user", ResourceID: &u.ID})
+
+	c.JSON(http.StatusAccepted, gin.H{"deletionScheduledFor": u.DeletionScheduledFor})
+}
+
+func (h AuthHandler) CancelDeletion(c *gin.Context) {
+	u, err := accounts.CancelDeletion(h.DB, auth.UserID(c))
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "account.deletion_cancelled", ResourceType: "user", ResourceID: &u.ID})
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUser erases an account immediately, skipping the grace period.
+func (h AdminHandler) DeleteUser(c *gin.Context) {
+	id, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
+	if id == auth.UserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot delete themselves here"})
+		return
+	}
+
+	if err := accounts.Delete(h.DB, id); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	h.auditUser(c, "admin.user_deleted", id)
+
+	c.Status(http.StatusNoContent)
+}
+
+// Integrity reports rows that reference deleted records.
+func (h AdminHandler) Integrity(c *gin.Context) {
+	issues, err := accounts.CheckIntegrity(h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": len(issues) == 0, "issues": issues})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/accounts"
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+type AdminHandler struct {
+	DB *gorm.DB
+}
+
+// respondAccountError maps accounts errors onto HTTP statuses.
+func respondAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, accounts.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, accounts.ErrInvalidRole),
+		errors.Is(err, accounts.ErrSameUser),
+		errors.Is(err, accounts.ErrRoleMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, accounts.ErrMerged),
+		errors.Is(err, accounts.ErrAlreadyDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func parseUserParam(c *gin.Context) (uint, bool) {
+	userID64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return uint(userID64), true
+}
+
+func (h AdminHandler) auditUser(c *gin.Context, action string, userID uint) {
+	_ = recordAudit(h.DB, c, models.AuditLog{
+		Action:       action,
+		ResourceType: "user",
+		ResourceID:   &userID,
+	})
+}
+
+// ListUsers supports q (username or name), role, active, limit and offset.
+func (h AdminHandler) ListUsers(c *gin.Context) {
+	filter := accounts.Filter{
+		Query: c.Query("q"),
+		Role:  models.UserRole(c.Query("role")),
+	}
+	if active := c.Query("active"); active != "" {
+		v, err := strconv.ParseBool(active)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return
+		}
+		filter.Active = &v
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	users, total, err := accounts.List(h.DB, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total})
+}
+
+func (h AdminHandler) GetUser(c *gin.Context) {
+	id, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := accounts.Get(h.DB, id)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h AdminHandler) Deactivate(c *gin.Context) {
+	h.setActive(c, false)
+}
+
+func (h AdminHandler) Reactivate(c *gin.Context) {
+	h.setActive(c, true)
+}
+
+func (h AdminHandler) setActive(c *gin.Context, active bool) {
+	id, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
+	if !active && id == auth.UserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot deactivate themselves"})
+		return
+	}
+
+	user, err := accounts.SetActive(h.DB, id, active)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	action := "admin.user_deactivated"
+	if active {
+		action = "admin.user_reactivated"
+	}
+	h.auditUser(c, action, id)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResetPassword returns a one-time temporary password the admin passes on to
+// the user, who must replace it after logging in.
+func (h AdminHandler) ResetPassword(c *gin.Context) {
+	id, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
+
+	temp, err := accounts.ResetPassword(h.DB, id)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	h.auditUser(c, "admin.password_reset", id)
+
+	c.JSON(http.StatusOK, gin.H{"temporaryPassword": temp})
+}
+
+type changeRoleRequest struct {
+	Role models.UserRole `json:"role" binding:"required,oneof=caregiver recipient guardian admin"`
+}
+
+func (h AdminHandler) ChangeRole(c *gin.Context) {
+	id, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req changeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id == auth.UserID(c) && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot demote themselves"})
+		return
+	}
+
+	user, err := accounts.ChangeRole(h.DB, id, req.Role)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	h.auditUser(c, "admin.role_changed", id)
+
+	c.JSON(http.StatusOK, user)
+}
+
+type mergeUsersRequest struct {
+	SourceID uint `json:"sourceId" binding:"required"`
+	TargetID uint `json:"targetId" binding:"required"`
+}
+
+// Merge folds the source account into the target and deactivates the source.
+func (h AdminHandler) Merge(c *gin.Context) {
+	var req mergeUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SourceID == auth.UserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot merge away their own account"})
+		return
+	}
+
+	user, err := accounts.Merge(h.DB, req.SourceID, req.TargetID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	h.auditUser(c, "admin.users_merged", req.SourceID)
+
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+const (
+	ctxAudited           = "auditRecorded"
+	ctxAuditResourceID   = "auditResourceID"
+	ctxAuditRecipientID  = "auditRecipientID"
+	ctxAuditRecipientIDs = "auditRecipientIDs"
+)
+
+// recordAudit appends audit entries for the caller, who is recorded as
+// anonymous when not signed in.
+func recordAudit(db *gorm.DB, c *gin.Context, entries ...models.AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var actorID *uint
+	if id := auth.UserID(c); id != 0 {
+		actorID = &id
+	}
+	for i := range entries {
+		entries[i].ActorID = actorID
+		entries[i].IP = c.ClientIP()
+		entries[i].UserAgent = c.Request.UserAgent()
+	}
+	c.Set(ctxAudited, true)
+	return db.Create(&entries).Error
+}
+
+// auditTarget is the hook for handlers whose resource only exists once they
+// ran, e.g. Create. The Audit middleware picks it up.
+func auditTarget(c *gin.Context, resourceID, recipientID uint) {
+	c.Set(ctxAuditResourceID, resourceID)
+	c.Set(ctxAuditRecipientID, recipientID)
+}
+
+// auditRecipients is the hook for handlers that return data about several
+// recipients; the Audit middleware writes one entry per recipient.
+func auditRecipients(c *gin.Context, recipientIDs ...uint) {
+	c.Set(ctxAuditRecipientIDs, recipientIDs)
+}
+
+// entryRecipients are the recipients whose entries are in a listing.
+func entryRecipients(entries []models.JournalEntry) []uint {
+	ids := make([]uint, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.RecipientID
+	}
+	return ids
+}
+
+// todoRecipients are the recipients whose todos are in a listing.
+func todoRecipients(todos []models.Todo) []uint {
+	ids := make([]uint, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.RecipientID
+	}
+	return ids
+}
+
+// recipientIDs are the IDs of the recipients in a listing.
+func recipientIDs(recipients []models.Recipient) []uint {
+	ids := make([]uint, len(recipients))
+	for i, recipient := range recipients {
+		ids[i] = recipient.ID
+	}
+	return ids
+}
+
+// auditRecipientSQL finds the recipient a resource belongs to.
+var auditRecipientSQL = map[models.AuditResource]string{
+	models.AuditResourceRecipient:    "SELECT id FROM recipients WHERE id = ?",
+	models.AuditResourceJournalEntry: "SELECT recipient_id FROM journal_entries WHERE id = ?",
+	models.AuditResourceTodo:         "SELECT recipient_id FROM todos WHERE id = ?",
+	models.AuditResourceCareRequest:  "SELECT recipient_id FROM care_requests WHERE id = ?",
+	models.AuditResourceComment: `SELECT journal_entries.recipient_id FROM comments
+		JOIN journal_entries ON journal_entries.id = comments.journal_entry_id WHERE comments.id = ?`,
+}
+
+// Audit records a successful request in the audit log. The resource is the
+// :id path parameter, and the recipient is looked up from it before the
+// handler runs so deletes are covered too. List routes without :id use the
+// recipientId query parameter; handlers can override both with auditTarget,
+// or with auditRecipients when they return several recipients' data. Nothing
+// is written if the handler already recorded a more specific entry.
+func Audit(db *gorm.DB, action string, resource models.AuditResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resourceID, recipientID *uint
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+			rid := uint(id)
+			resourceID = &rid
+			if query, ok := auditRecipientSQL[resource]; ok {
+				var owner uint
+				if db.Raw(query, rid).Scan(&owner).Error == nil && owner != 0 {
+					recipientID = &owner
+				}
+			}
+		} else if id, err := strconv.ParseUint(c.Query("recipientId"), 10, 64); err == nil {
+			owner := uint(id)
+			recipientID = &owner
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest || c.GetBool(ctxAudited) {
+			return
+		}
+		if v, ok := c.Get(ctxAuditResourceID); ok {
+			id := v.(uint)
+			resourceID = &id
+		}
+		if v, ok := c.Get(ctxAuditRecipientID); ok {
+			id := v.(uint)
+			recipientID = &id
+		}
+
+		entry := models.AuditLog{
+			Action:       action,
+			ResourceType: string(resource),
+			ResourceID:   resourceID,
+			RecipientID:  recipientID,
+		}
+		entries := []models.AuditLog{entry}
+		if v, ok := c.Get(ctxAuditRecipientIDs); ok && len(v.([]uint)) > 0 {
+			entries = entries[:0]
+			seen := map[uint]bool{}
+			for _, id := range v.([]uint) {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				entry.RecipientID = &id
+				entries = append(entries, entry)
+			}
+		}
+		if err := recordAudit(db, c, entries...); err != nil {
+			log.Printf("audit %s: %v", action, err)
+		}
+	}
+}
+
+type AuditHandler struct {
+	DB *gorm.DB
+}
+
+// auditQuery applies the filters shared by every audit listing: action,
+// resourceType, actorId, from and to (RFC3339).
+func auditQuery(c *gin.Context, q *gorm.DB) (*gorm.DB, bool) {
+	if action := c.Query("action"); action != "" {
+		q = q.Where("audit_logs.action = ?", action)
+	}
+	if resourceType := c.Query("resourceType"); resourceType != "" {
+		q = q.Where("audit_logs.resource_type = ?", resourceType)
+	}
+	if actorID := c.Query("actorId"); actorID != "" {
+		q = q.Where("audit_logs.actor_id = ?", actorID)
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := parseDate(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 timestamp"})
+			return nil, false
+		}
+		q = q.Where("audit_logs.created_at "+op+" ?", t)
+	}
+	return q, true
+}
+
+// respondAuditLog writes the entries as JSON, or as a CSV download when
+// format=csv. JSON is paginated with limit and offset; CSV exports everything
+// that matches.
+func respondAuditLog(c *gin.Context, q *gorm.DB) {
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	q = q.
+		Select("audit_logs.*, actors.name AS actor_name, actors.username AS actor_username").
+		Joins("LEFT JOIN users actors ON actors.id = audit_logs.actor_id").
+		Order("audit_logs.created_at desc, audit_logs.id desc")
+
+	if c.Query("format") == "csv" {
+		var entries []models.AuditLogEntry
+		if err := q.Find(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		writeAuditCSV(c, entries)
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	entries := []models.AuditLogEntry{}
+	if err := q.Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total})
+}
+
+func writeAuditCSV(c *gin.Context, entries []models.AuditLogEntry) {
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	optional := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(*id), 10)
+	}
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"time", "actor_id", "actor_username", "actor_name", "on_behalf_of_id", "action", "resource_type", "resource_id", "recipient_id", "ip", "user_agent"})
+	for _, e := range entries {
+		_ = w.Write([]string{
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			optional(e.ActorID),
+			e.ActorUsername,
+			e.ActorName,
+			optional(e.OnBehalfOfID),
+			e.Action,
+			e.ResourceType,
+			optional(e.ResourceID),
+			optional(e.RecipientID),
+			e.IP,
+			e.UserAgent,
+		})
+	}
+	w.Flush()
+}
+
+// RecipientAccessLog answers "who accessed my data" for the recipient.
+func (h AuditHandler) RecipientAccessLog(c *gin.Context) {
+	recipient, ok := ownRecipient(c, h.DB)
+	if !ok {
+		return
+	}
+
+	q, ok := auditQuery(c, h.DB.Model(&models.AuditLog{}).Where("audit_logs.recipient_id = ?", recipient.ID))
+	if !ok {
+		return
+	}
+	respondAuditLog(c, q)
+}
+
+// AdminList searches the whole audit log; recipientId narrows it down.
+func (h AuditHandler) AdminList(c *gin.Context) {
+	q := h.DB.Model(&models.AuditLog{})
+	if recipientID := c.Query("recipientId"); recipientID != "" {
+		q = q.Where("audit_logs.recipient_id = ?", recipientID)
+	}
+
+	q, ok := auditQuery(c, q)
+	if !ok {
+		return
+	}
+	respondAuditLog(c, q)
+}
@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"hack4good/internal/auth"
+	"hack4good/internal/loginguard"
 	"hack4good/internal/models"
 )
 
@@ -17,11 +22,10 @@ type SignupRequest struct {
 	Username string          `json:"username" binding:"required"`
 	Password string          `json:"password" binding:"required,min=8"`
 	Name     string          `json:"name" binding:"required"`
-	Role     models.UserRole `json:"role" binding:"required,oneof=caregiver recipient"`
+	Role     models.UserRole `json:"role" binding:"required,oneof=caregiver recipient guardian"`
+	Email    *string         `json:"email,omitempty" binding:"omitempty,email"`
 
-	Caregiver *struct {
-		// caregiver-specific fields go here later
-	} `json:"caregiver,omitempty"`
+	Caregiver *models.CaregiverProfileRequest `json:"caregiver,omitempty"`
 
 	Recipient *struct {
 		Age       *int    `json:"age,omitempty"`
@@ -30,11 +34,16 @@ type SignupRequest struct {
 		Dislikes  *string `json:"dislikes,omitempty"`
 		Phobias   *string `json:"phobias,omitempty"`
 		PetPeeves *string `json:"petPeeves,omitempty"`
+
+		Needs        []string                  `json:"needs,omitempty" binding:"omitempty,dive,required"`
+		Languages    []string                  `json:"languages,omitempty" binding:"omitempty,dive,required"`
+		Availability []models.AvailabilitySlot `json:"availability,omitempty" binding:"omitempty,dive"`
 	} `json:"recipient,omitempty"`
 }
 
 type AuthHandler struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Limiter *loginguard.Limiter
 }
 
 func (h AuthHandler) Signup(c *gin.Context) {
@@ -47,6 +56,10 @@ func (h AuthHandler) Signup(c *gin.Context) {
 	// normalize username SAME way as login
 	username := strings.ToLower(strings.TrimSpace(req.Username))
 	req.Username = username
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		req.Email = &email
+	}
 
 	// Enforce shape based on role
 	switch req.Role {
@@ -68,11 +81,29 @@ func (h AuthHandler) Signup(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "caregiver object must not be provided when role is recipient"})
 			return
 		}
+	case models.RoleGuardian:
+		if req.Caregiver != nil || req.Recipient != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "caregiver and recipient objects must not be provided when role is guardian"})
+			return
+		}
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
 		return
 	}
 
+	if req.Caregiver != nil {
+		if err := validateAvailability(req.Caregiver.Availability); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Recipient != nil {
+		if err := validateAvailability(req.Recipient.Availability); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// hash password BEFORE transaction
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -87,6 +118,7 @@ func (h AuthHandler) Signup(c *gin.Context) {
 			Username:     req.Username,
 			Name:         req.Name,
 			Role:         req.Role,
+			Email:        req.Email,
 			PasswordHash: string(hash),
 		}
 		if err := tx.Create(&user).Error; err != nil {
@@ -96,9 +128,15 @@ func (h AuthHandler) Signup(c *gin.Context) {
 		// 2) create role-specific profile
 		if req.Role == models.RoleCaregiver {
 			caregiver := models.Caregiver{UserID: user.ID}
+			applyCaregiverProfile(*req.Caregiver, &caregiver)
 			if err := tx.Create(&caregiver).Error; err != nil {
 				return err
 			}
+		} else if req.Role == models.RoleGuardian {
+			guardian := models.Guardian{UserID: user.ID}
+			if err := tx.Create(&guardian).Error; err != nil {
+				return err
+			}
 		} else {
 			recipient := models.Recipient{
 				UserID:    user.ID,
@@ -108,6 +146,10 @@ func (h AuthHandler) Signup(c *gin.Context) {
 				Dislikes:  req.Recipient.Dislikes,
 				Phobias:   req.Recipient.Phobias,
 				PetPeeves: req.Recipient.PetPeeves,
+
+				Needs:        req.Recipient.Needs,
+				Languages:    req.Recipient.Languages,
+				Availability: req.Recipient.Availability,
 			}
 			if err := tx.Create(&recipient).Error; err != nil {
 				return err
@@ -120,7 +162,7 @@ func (h AuthHandler) Signup(c *gin.Context) {
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
-			c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -136,8 +178,9 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token string     `json:"token"`
-	User  userPublic `json:"user"`
+	Token         string     `json:"token"`
+	User          userPublic `json:"user"`
+	RecoveryCodes []string   `json:"recoveryCodes,omitempty"`
 }
 
 // Public view of user object
@@ -148,6 +191,10 @@ type userPublic struct {
 	Role        models.UserRole `json:"role"`
 	RecipientID *uint           `json:"recipientId,omitempty"`
 	CaregiverID *uint           `json:"caregiverId,omitempty"`
+	GuardianID  *uint           `json:"guardianId,omitempty"`
+
+	MustResetPassword    bool       `json:"mustResetPassword"`
+	DeletionScheduledFor *time.Time `json:"deletionScheduledFor,omitempty"`
 }
 
 func (h AuthHandler) Login(c *gin.Context) {
@@ -158,11 +205,24 @@ func (h AuthHandler) Login(c *gin.Context) {
 	}
 
 	username := strings.ToLower(strings.TrimSpace(req.Username))
+	ip := c.ClientIP()
+
+	wait, err := h.Limiter.Attempt(c.Request.Context(), username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
 
 	var u models.User
 	if err := h.DB.First(&u, "username = ?", username).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+			// Same bcrypt cost as a real account so timing doesn't reveal it
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+			h.loginFailed(c, username, ip, nil)
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -170,15 +230,38 @@ func (h AuthHandler) Login(c *gin.Context) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		h.loginFailed(c, username, ip, &u.ID)
+		return
+	}
+	if err := h.Limiter.Success(c.Request.Context(), username, ip); err != nil {
+		log.Printf("clearing login failures for %q: %v", username, err)
+	}
+
+	if !u.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is deactivated"})
+		return
+	}
+
+	// Accounts with 2FA, or that must set it up, finish logging in via /login/2fa
+	if challenged := h.challengeSecondFactor(c, u); challenged {
 		return
 	}
 
-	token, err := auth.SignToken(u.ID, string(u.Role))
+	h.issueSession(c, u, nil)
+}
+
+// issueSession answers a completed login with an access token and the
+// caller's public profile. recoveryCodes is only set right after 2FA setup.
+func (h AuthHandler) issueSession(c *gin.Context, u models.User, recoveryCodes []string) {
+	token, err := auth.SignToken(u.ID, string(u.Role), u.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign token"})
 		return
 	}
+	h.respondSession(c, u, token, recoveryCodes)
+}
+
+func (h AuthHandler) respondSession(c *gin.Context, u models.User, token string, recoveryCodes []string) {
 
 	// Build public user
 	publicUser := userPublic{
@@ -186,6 +269,9 @@ func (h AuthHandler) Login(c *gin.Context) {
 		Username: u.Username,
 		Name:     u.Name,
 		Role:     u.Role,
+
+		MustResetPassword:    u.MustResetPassword,
+		DeletionScheduledFor: u.DeletionScheduledFor,
 	}
 
 	// Resolve domain identity
@@ -201,10 +287,57 @@ func (h AuthHandler) Login(c *gin.Context) {
 		if err := h.DB.Where("user_id = ?", u.ID).First(&caregiver).Error; err == nil {
 			publicUser.CaregiverID = &caregiver.ID
 		}
+
+	case models.RoleGuardian:
+		var guardian models.Guardian
+		if err := h.DB.Where("user_id = ?", u.ID).First(&guardian).Error; err == nil {
+			publicUser.GuardianID = &guardian.ID
+		}
 	}
 
 	c.JSON(http.StatusOK, loginResponse{
-		Token: token,
-		User:  publicUser,
+		Token:         token,
+		User:          publicUser,
+		RecoveryCodes: recoveryCodes,
 	})
 }
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "too many failed login attempts, try again later",
+		"retryAfter": seconds,
+	})
+}
+
+// dummyPasswordHash is compared against for unknown usernames.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// loginFailed records the failure against the username and IP, audits it and
+// answers 401, or 429 if this attempt triggered a lockout. userID is nil for
+// unknown usernames.
+func (h AuthHandler) loginFailed(c *gin.Context, username, ip string, userID *uint) {
+	locked, err := h.Limiter.Locked(c.Request.Context(), username)
+	if err != nil {
+		log.Printf("recording login failure for %q: %v", username, err)
+	}
+
+	_ = recordAudit(h.DB, c, models.AuditLog{
+		Action:       "auth.login_failed",
+		ResourceType: "user",
+		ResourceID:   userID,
+	})
+
+	if locked {
+		_ = recordAudit(h.DB, c, models.AuditLog{
+			Action:       "auth.account_locked",
+			ResourceType: "user",
+			ResourceID:   userID,
+		})
+		tooManyAttempts(c, h.Limiter.Username.Lockout)
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+}
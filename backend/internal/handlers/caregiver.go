@@ -23,6 +23,7 @@ func (h CaregiverHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, caregivers)
 }
 
+// Update renames the calling caregiver, identified by their user ID.
 func (h CaregiverHandler) Update(c *gin.Context) {
 	userIDStr := c.Param("id")
 
@@ -32,6 +33,15 @@ func (h CaregiverHandler) Update(c *gin.Context) {
 		return
 	}
 
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
+		return
+	}
+	if caregiver.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caregivers can only edit their own profile"})
+		return
+	}
+
 	var req models.UpdateUserNameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -58,6 +68,8 @@ func (h CaregiverHandler) Update(c *gin.Context) {
 	})
 }
 
+// ListByRecipient shows a recipient's caregivers to the recipient, their
+// guardians and the caregivers themselves.
 func (h CaregiverHandler) ListByRecipient(c *gin.Context) {
 	recipientID64, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -66,6 +78,10 @@ func (h CaregiverHandler) ListByRecipient(c *gin.Context) {
 	}
 	recipientID := uint(recipientID64)
 
+	if !h.inCircle(c, recipientID) {
+		return
+	}
+
 	var caregivers []models.Caregiver
 	err = h.DB.
 		Preload("User").
@@ -83,6 +99,36 @@ func (h CaregiverHandler) ListByRecipient(c *gin.Context) {
 	c.JSON(http.StatusOK, caregivers)
 }
 
+// inCircle writes a 401 or 403 and returns false unless the caller is the
+// recipient, one of their guardians or a linked caregiver.
+func (h CaregiverHandler) inCircle(c *gin.Context, recipientID uint) bool {
+	userID, ok := requireUser(c)
+	if !ok {
+		return false
+	}
+
+	isRecipient, err := isRecipientUser(c, h.DB, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if isRecipient {
+		return true
+	}
+
+	guardian, err := guardianLink(h.DB, userID, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if guardian != nil {
+		return true
+	}
+
+	_, ok = linkedCaregiver(c, h.DB, recipientID)
+	return ok
+}
+
 func (h CaregiverHandler) GetByUserID(c *gin.Context) {
 	userID64, err := strconv.ParseUint(c.Param("userId"), 10, 64)
 	if err != nil {
@@ -99,3 +145,69 @@ func (h CaregiverHandler) GetByUserID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, caregiver)
 }
+
+// UpdateProfile edits the calling caregiver's own profile.
+func (h CaregiverHandler) UpdateProfile(c *gin.Context) {
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
+		return
+	}
+	if strconv.FormatUint(uint64(caregiver.ID), 10) != c.Param("id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caregivers can only edit their own profile"})
+		return
+	}
+
+	var req models.CaregiverProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAvailability(req.Availability); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyCaregiverProfile(req, &caregiver)
+
+	if err := h.DB.Save(&caregiver).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("User").First(&caregiver, caregiver.ID)
+
+	c.JSON(http.StatusOK, caregiver)
+}
+
+// applyCaregiverProfile copies the provided fields onto the caregiver. Lists
+// replace the existing ones when present.
+func applyCaregiverProfile(req models.CaregiverProfileRequest, caregiver *models.Caregiver) {
+	if req.Bio != nil {
+		caregiver.Bio = req.Bio
+	}
+	if req.Languages != nil {
+		caregiver.Languages = req.Languages
+	}
+	if req.Certifications != nil {
+		caregiver.Certifications = req.Certifications
+	}
+	if req.Skills != nil {
+		caregiver.Skills = req.Skills
+	}
+	if req.YearsOfExperience != nil {
+		caregiver.YearsOfExperience = req.YearsOfExperience
+	}
+	if req.Availability != nil {
+		caregiver.Availability = req.Availability
+	}
+}
+
+func validateAvailability(slots []models.AvailabilitySlot) error {
+	for _, slot := range slots {
+		// HH:MM strings compare correctly as text
+		if slot.Start >= slot.End {
+			return fmt.Errorf("availability on %s must end after it starts", slot.Day)
+		}
+	}
+	return nil
+}
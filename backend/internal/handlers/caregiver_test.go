@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"hack4good/internal/models"
+)
+
+func TestCaregiverInCircle(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     uint
+		role       models.UserRole
+		tables     fakeTables
+		wantOK     bool
+		wantStatus int
+	}{
+		{"anonymous", 0, "", fakeTables{"recipients": {recipientRow}}, false, http.StatusUnauthorized},
+		{"the recipient", 7, models.RoleRecipient, fakeTables{"recipients": {recipientRow}}, true, http.StatusOK},
+		{"guardian", 7, models.RoleGuardian, fakeTables{"guardian_recipients": {{"id": int64(1), "guardian_id": int64(1), "recipient_id": int64(2)}}}, true, http.StatusOK},
+		{"linked caregiver", 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}, "caregiver_recipients": {link("")}}, true, http.StatusOK},
+		{"unlinked caregiver", 7, models.RoleCaregiver, fakeTables{"caregivers": {caregiverRow}}, false, http.StatusForbidden},
+		{"stranger", 7, models.RoleRecipient, fakeTables{}, false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(tt.userID, tt.role)
+			ok := CaregiverHandler{DB: fakeDB(t, tt.tables)}.inCircle(c, 2)
+			if ok != tt.wantOK || w.Code != tt.wantStatus {
+				t.Errorf("inCircle = %v with status %d, want %v and %d", ok, w.Code, tt.wantOK, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCaregiverUpdateOwnNameOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     uint
+		tables     fakeTables
+		wantStatus int
+	}{
+		{"anonymous", 0, fakeTables{"caregivers": {caregiverRow}}, http.StatusUnauthorized},
+		{"not a caregiver", 7, fakeTables{}, http.StatusForbidden},
+		{"another user", 8, fakeTables{"caregivers": {{"id": int64(4), "user_id": int64(8)}}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(tt.userID, models.RoleCaregiver)
+			c.Request = httptest.NewRequest(http.MethodPut, "/caregivers/7", strings.NewReader(`{"name":"Mallory"}`))
+			c.Params = gin.Params{{Key: "id", Value: "7"}}
+			CaregiverHandler{DB: fakeDB(t, tt.tables)}.Update(c)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,35 +11,106 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"hack4good/internal/auth"
+	"hack4good/internal/loginguard"
 	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
 )
 
 type CareRequestHandler struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Limiter *loginguard.Limiter
 }
 
 type createRequestBody struct {
-	CaregiverID uint `json:"caregiverId" binding:"required"`
 	RecipientID uint `json:"recipientId" binding:"required"`
 }
 
+// CreateRequest sends a request from the calling caregiver.
 func (h CareRequestHandler) CreateRequest(c *gin.Context) {
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
+		return
+	}
+
 	var body createRequestBody
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate caregiver/recipient exist
-	if err := h.DB.First(&models.Caregiver{}, "id = ?", body.CaregiverID).Error; err != nil {
+	h.create(c, caregiver.ID, body.RecipientID, false)
+}
+
+type createRequestByCodeBody struct {
+	InviteCode string `json:"inviteCode" binding:"required"`
+}
+
+// CreateRequestByCode sends a request from the calling caregiver to the
+// recipient who shared the invite code, whether or not they are discoverable.
+func (h CareRequestHandler) CreateRequestByCode(c *gin.Context) {
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var body createRequestByCodeBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipient, ok := findByInviteCode(c, h.DB, h.Limiter, body.InviteCode)
+	if !ok {
+		return
+	}
+
+	h.create(c, caregiver.ID, recipient.ID, true)
+}
+
+// findByInviteCode looks up the recipient who shared code. Unknown codes count
+// against the caller and their IP, so codes can't be guessed by enumeration.
+func findByInviteCode(c *gin.Context, db *gorm.DB, limiter *loginguard.Limiter, code string) (models.Recipient, bool) {
+	ctx := c.Request.Context()
+	keys := []string{"invite_code:ip:" + c.ClientIP()}
+	if userID := auth.UserID(c); userID != 0 {
+		keys = append(keys, "invite_code:user:"+strconv.FormatUint(uint64(userID), 10))
+	}
+	for _, key := range keys {
+		wait, err := limiter.Check(ctx, key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return models.Recipient{}, false
+		}
+		if wait > 0 {
+			tooManyAttempts(c, wait)
+			return models.Recipient{}, false
+		}
+	}
+
+	var recipient models.Recipient
+	if err := db.Preload("User").First(&recipient, "invite_code = ?", strings.ToUpper(strings.TrimSpace(code))).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "caregiver not found"})
-			return
+			for _, key := range keys {
+				if err := limiter.Failure(ctx, key, loginguard.InviteCodePolicy); err != nil {
+					log.Printf("recording invite code failure: %v", err)
+				}
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid invite code"})
+			return models.Recipient{}, false
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return models.Recipient{}, false
 	}
-	if err := h.DB.First(&models.Recipient{}, "id = ?", body.RecipientID).Error; err != nil {
+	return recipient, true
+}
+
+// create opens a pending request after checking the recipient exists and
+// isn't already linked. Recipients who opted out of discovery can only be
+// reached with their invite code.
+func (h CareRequestHandler) create(c *gin.Context, caregiverID, recipientID uint, viaInvite bool) {
+	var recipient models.Recipient
+	if err := h.DB.First(&recipient, "id = ?", recipientID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "recipient not found"})
 			return
@@ -46,11 +118,15 @@ func (h CareRequestHandler) CreateRequest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !recipient.Discoverable && !viaInvite {
+		c.JSON(http.StatusForbidden, gin.H{"error": "recipient only accepts requests via invite code"})
+		return
+	}
 
 	// If already linked, no need to request
 	var existingLink models.CaregiverRecipient
 	if err := h.DB.
-		Where("caregiver_id = ? AND recipient_id = ?", body.CaregiverID, body.RecipientID).
+		Where("caregiver_id = ? AND recipient_id = ?", caregiverID, recipientID).
 		First(&existingLink).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "caregiver and recipient already linked"})
 		return
@@ -62,7 +138,7 @@ func (h CareRequestHandler) CreateRequest(c *gin.Context) {
 	// If there is already a pending request, block duplicates
 	var existingReq models.CareRequest
 	err := h.DB.
-		Where("caregiver_id = ? AND recipient_id = ? AND status = ?", body.CaregiverID, body.RecipientID, models.CareRequestPending).
+		Where("caregiver_id = ? AND recipient_id = ? AND status = ?", caregiverID, recipientID, models.CareRequestPending).
 		First(&existingReq).Error
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "request already pending"})
@@ -74,17 +150,24 @@ func (h CareRequestHandler) CreateRequest(c *gin.Context) {
 	}
 
 	req := models.CareRequest{
-		CaregiverID: body.CaregiverID,
-		RecipientID: body.RecipientID,
+		CaregiverID: caregiverID,
+		RecipientID: recipientID,
 		Status:      models.CareRequestPending,
 		RequestedAt: time.Now(),
 	}
 
-	if err := h.DB.Create(&req).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		return webhooks.Publish(tx, models.EventCareRequestCreated, req.ID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	auditTarget(c, req.ID, req.RecipientID)
 	c.JSON(http.StatusCreated, req)
 }
 
@@ -96,6 +179,11 @@ func (h CareRequestHandler) ListRecipientRequests(c *gin.Context) {
 	}
 	recipientID := uint(recipientID64)
 
+	guardian, ok := actingGuardian(c, h.DB, recipientID, models.GuardianRespondToRequests)
+	if !ok {
+		return
+	}
+
 	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
 
 	q := h.DB.Model(&models.CareRequest{}).
@@ -120,12 +208,22 @@ func (h CareRequestHandler) ListRecipientRequests(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	if guardian != nil {
+		if err := recordOnBehalf(h.DB, c, guardian, "care_request.list", "recipient", recipientID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	
 	c.JSON(http.StatusOK, requests)
 }
 
 type respondBody struct {
 	Status string `json:"status" binding:"required,oneof=accepted rejected"`
+
+	// Permissions granted to the caregiver when accepting; defaults apply if omitted
+	Scopes []models.CaregiverScope `json:"scopes" binding:"omitempty,dive,oneof=read_journal comment manage_todos edit_profile view_vitals manage_medications manage_devices"`
 }
 
 func (h CareRequestHandler) RespondToRequest(c *gin.Context) {
@@ -152,6 +250,12 @@ func (h CareRequestHandler) RespondToRequest(c *gin.Context) {
 		return
 	}
 
+	// Only the recipient answers, or a guardian permitted to on their behalf
+	guardian, ok := actingGuardian(c, h.DB, req.RecipientID, models.GuardianRespondToRequests)
+	if !ok {
+		return
+	}
+
 	// Only pending requests can be responded to
 	if req.Status != models.CareRequestPending {
 		c.JSON(http.StatusConflict, gin.H{"error": "request already responded to"})
@@ -171,6 +275,15 @@ func (h CareRequestHandler) RespondToRequest(c *gin.Context) {
 			}).Error; err != nil {
 			return err
 		}
+		if err := webhooks.Publish(tx, models.EventCareRequestResponded, req.ID); err != nil {
+			return err
+		}
+
+		if guardian != nil {
+			if err := recordOnBehalf(tx, c, guardian, "care_request."+body.Status, "care_request", req.ID); err != nil {
+				return err
+			}
+		}
 
 		// If accepted, create caregiver<->recipient link (idempotent)
 		if newStatus == models.CareRequestAccepted {
@@ -178,6 +291,9 @@ func (h CareRequestHandler) RespondToRequest(c *gin.Context) {
 				CaregiverID: req.CaregiverID,
 				RecipientID: req.RecipientID,
 			}
+			if body.Scopes != nil {
+				link.Scopes = uniqueScopes(body.Scopes)
+			}
 			if err := tx.FirstOrCreate(
 				&link,
 				"caregiver_id = ? AND recipient_id = ?",
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"hack4good/internal/loginguard"
+	"hack4good/internal/models"
+)
+
+func TestFindByInviteCodeLimitsFailures(t *testing.T) {
+	limiter := loginguard.New(loginguard.NewMemoryStore())
+	db := fakeDB(t, fakeTables{})
+
+	for i := 0; i < loginguard.InviteCodePolicy.MaxFailures; i++ {
+		c, w := testContext(7, models.RoleCaregiver)
+		if _, ok := findByInviteCode(c, db, limiter, "WRONG"); ok || w.Code != http.StatusNotFound {
+			t.Fatalf("attempt %d: ok = %v, status = %d, want a 404", i+1, ok, w.Code)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+	}{
+		{"same caller", 7},
+		{"another caller from the same IP", 8},
+		{"anonymous from the same IP", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(tt.userID, models.RoleCaregiver)
+			if _, ok := findByInviteCode(c, db, limiter, "WRONG"); ok || w.Code != http.StatusTooManyRequests {
+				t.Errorf("ok = %v, status = %d, want a 429", ok, w.Code)
+			}
+			if w.Header().Get("Retry-After") == "" {
+				t.Error("missing Retry-After")
+			}
+		})
+	}
+}
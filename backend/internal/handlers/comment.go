@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"hack4good/internal/auth"
+	"hack4good/internal/fieldcrypt"
 	"hack4good/internal/models"
 )
 
@@ -16,43 +19,50 @@ type CommentHandler struct {
 
 type createCommentRequest struct {
 	JournalEntryID uint   `json:"journalEntryId" binding:"required"`
-	AuthorID       uint   `json:"authorId" binding:"required"` // UserID
 	Content        string `json:"content" binding:"required"`
+	ParentID       *uint  `json:"parentId"` // comment being replied to
 }
 
+// Create adds a comment by the caller to an entry they are allowed to see.
 func (h CommentHandler) Create(c *gin.Context) {
+	authorID := auth.UserID(c)
+
 	var req createCommentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Optional: ensure journal entry exists
-	var entry models.JournalEntry
-	if err := h.DB.First(&entry, "id = ?", req.JournalEntryID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "journal entry not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	entry, ok := visibleEntry(c, h.DB, req.JournalEntryID, http.StatusBadRequest)
+	if !ok {
+		return
+	}
+	if !requireCommenter(c, h.DB, entry.RecipientID) {
 		return
 	}
 
-	// Optional: ensure author exists (User table)
-	var user models.User
-	if err := h.DB.First(&user, "id = ?", req.AuthorID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "author not found"})
+	// Replies must stay on the same entry as their parent
+	if req.ParentID != nil {
+		var parent models.Comment
+		if err := h.DB.First(&parent, "id = ?", *req.ParentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if parent.JournalEntryID != req.JournalEntryID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment belongs to a different journal entry"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
 	}
 
 	comment := models.Comment{
 		JournalEntryID: req.JournalEntryID,
-		AuthorID:       req.AuthorID,
+		AuthorID:       authorID,
 		Content:        req.Content,
+		ParentID:       req.ParentID,
 	}
 
 	if err := h.DB.Create(&comment).Error; err != nil {
@@ -63,12 +73,22 @@ func (h CommentHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, comment)
 }
 
+// List returns the threaded comments on an entry the caller may read.
 func (h CommentHandler) List(c *gin.Context) {
-	journalEntryIDStr := c.Query("journalEntryId")
+	var entryID uint
+	if _, err := fmt.Sscan(c.Query("journalEntryId"), &entryID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "journalEntryId is required"})
+		return
+	}
+	entry, ok := visibleEntry(c, h.DB, entryID, http.StatusNotFound)
+	if !ok {
+		return
+	}
+	auditTarget(c, entry.ID, entry.RecipientID)
 
 	var comments []models.CommentReturned
 
-	q := h.DB.
+	q := fieldcrypt.FromTable(h.DB, "comments").
 		Table("comments").
 		Select(`
 		comments.id,
@@ -76,22 +96,70 @@ func (h CommentHandler) List(c *gin.Context) {
 		comments.author_id,
 		comments.journal_entry_id,
 		comments.created_at,
+		comments.updated_at,
+		comments.edited,
+		comments.parent_id,
 		users.role AS author_role,
 		users.name AS author_name
 	`).
 		Joins("JOIN users ON users.id = comments.author_id").
+		Where("comments.journal_entry_id = ?", entryID).
 		Order("comments.created_at ASC")
 
-	if journalEntryIDStr != "" {
-		q = q.Where("comments.journal_entry_id = ?", journalEntryIDStr)
+	if err := q.Scan(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := q.Scan(&comments).Error; err != nil {
+	ids := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	reactions, err := summarizeReactions(h.DB, "comment_id", ids)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range comments {
+		comments[i].Reactions = reactions[comments[i].ID]
+		if comments[i].Reactions == nil {
+			comments[i].Reactions = []models.ReactionSummary{}
+		}
+	}
+
+	c.JSON(http.StatusOK, buildCommentThreads(comments))
+}
+
+// buildCommentThreads nests replies under their parents, keeping creation order
+// at every level. Comments whose parent is missing are treated as top level.
+func buildCommentThreads(comments []models.CommentReturned) []models.CommentReturned {
+	children := make(map[uint][]models.CommentReturned)
+	present := make(map[uint]bool, len(comments))
+	for _, comment := range comments {
+		present[comment.ID] = true
+	}
+
+	var roots []models.CommentReturned
+	for _, comment := range comments {
+		if comment.ParentID != nil && present[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+
+	var attach func(list []models.CommentReturned) []models.CommentReturned
+	attach = func(list []models.CommentReturned) []models.CommentReturned {
+		if list == nil {
+			return []models.CommentReturned{}
+		}
+		for i := range list {
+			list[i].Replies = attach(children[list[i].ID])
+		}
+		return list
+	}
 
-	c.JSON(http.StatusOK, comments)
+	return attach(roots)
 }
 
 /**func (h CommentHandler) GetByID(c *gin.Context) {
@@ -114,7 +182,13 @@ type updateCommentRequest struct {
 	Content *string `json:"content"`
 }
 
+// Update lets the author edit their comment. The caller is recorded as the
+// editor of the revision.
 func (h CommentHandler) Update(c *gin.Context) {
+	editorID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	id := c.Param("id")
 
 	var req updateCommentRequest
@@ -133,11 +207,33 @@ func (h CommentHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if req.Content != nil {
-		comment.Content = *req.Content
+	if comment.AuthorID != editorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit this comment"})
+		return
 	}
 
-	if err := h.DB.Save(&comment).Error; err != nil {
+	if req.Content == nil || *req.Content == comment.Content {
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	// Keep the prior content so readers can see what changed
+	revision := models.CommentRevision{
+		CommentID: comment.ID,
+		Content:   comment.Content,
+		EditorID:  editorID,
+	}
+
+	comment.Content = *req.Content
+	comment.Edited = true
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		return tx.Save(&comment).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -145,10 +241,95 @@ func (h CommentHandler) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, comment)
 }
 
+// ListRevisions returns the prior versions of a comment, newest first.
+func (h CommentHandler) ListRevisions(c *gin.Context) {
+	comment, ok := h.loadForHistory(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.RevisionReturned
+	if err := revisionsQuery(h.DB, "comment_revisions", "comment_id", comment.ID).
+		Scan(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (h CommentHandler) GetRevision(c *gin.Context) {
+	comment, ok := h.loadForHistory(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.RevisionReturned
+	if err := revisionsQuery(h.DB, "comment_revisions", "comment_id", comment.ID).
+		Where("comment_revisions.id = ?", c.Param("revisionId")).
+		Scan(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(revisions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions[0])
+}
+
+// loadForHistory resolves the comment in the path and checks that the caller
+// may see both the entry it is on and its edit history.
+func (h CommentHandler) loadForHistory(c *gin.Context) (models.Comment, bool) {
+	var comment models.Comment
+
+	viewerID, ok := requireUser(c)
+	if !ok {
+		return comment, false
+	}
+
+	if err := h.DB.First(&comment, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return comment, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return comment, false
+	}
+
+	var entry models.JournalEntry
+	if err := h.DB.First(&entry, "id = ?", comment.JournalEntryID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return comment, false
+	}
+
+	if err := checkEntryVisible(h.DB, entry, viewerID); err != nil {
+		if errors.Is(err, errEntryNotVisible) || errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusForbidden, gin.H{"error": errEntryNotVisible.Error()})
+			return comment, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return comment, false
+	}
+
+	if err := canViewEditHistory(h.DB, entry.RecipientID, viewerID); err != nil {
+		if errors.Is(err, errHistoryHidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return comment, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return comment, false
+	}
+
+	return comment, true
+}
+
+// Delete removes one of the caller's own comments.
 func (h CommentHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
-	res := h.DB.Delete(&models.Comment{}, "id = ?", id)
+	res := h.DB.Delete(&models.Comment{}, "id = ? AND author_id = ?", id, auth.UserID(c))
 	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
 		return
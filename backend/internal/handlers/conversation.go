@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+var errNotLinked = errors.New("participants must be linked through caregiver_recipients")
+
+type ConversationHandler struct {
+	DB *gorm.DB
+}
+
+type createConversationRequest struct {
+	ParticipantIDs []uint  `json:"participantIds" binding:"required,min=1"` // UserIDs, excluding the caller
+	Title          *string `json:"title"`
+}
+
+func (h ConversationHandler) Create(c *gin.Context) {
+	var req createConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDs := uniqueIDs(append([]uint{auth.UserID(c)}, req.ParticipantIDs...))
+	if len(userIDs) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a conversation needs at least one other participant"})
+		return
+	}
+
+	recipientID, err := conversationRecipient(h.DB, userIDs)
+	if err != nil {
+		if errors.Is(err, errNotLinked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	isGroup := len(userIDs) > 2
+
+	// Reuse an existing 1:1 thread between the same two people
+	if !isGroup {
+		var existing models.Conversation
+		err := h.DB.
+			Preload("Participants.User").
+			Where("is_group = ? AND recipient_id = ?", false, recipientID).
+			Where("id IN (?)", h.DB.Model(&models.ConversationParticipant{}).
+				Select("conversation_id").
+				Where("user_id IN ?", userIDs).
+				Group("conversation_id").
+				Having("COUNT(*) = ?", len(userIDs))).
+			First(&existing).Error
+		if err == nil {
+			c.JSON(http.StatusOK, existing)
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	conversation := models.Conversation{
+		RecipientID: recipientID,
+		Title:       req.Title,
+		IsGroup:     isGroup,
+		CreatedByID: auth.UserID(c),
+	}
+	for _, id := range userIDs {
+		conversation.Participants = append(conversation.Participants, models.ConversationParticipant{UserID: id})
+	}
+
+	if err := h.DB.Create(&conversation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Participants.User").First(&conversation, conversation.ID)
+
+	c.JSON(http.StatusCreated, conversation)
+}
+
+// conversationRecipient checks that the users consist of exactly one recipient
+// plus caregivers who are all linked to that recipient, and returns the
+// recipient's ID.
+func conversationRecipient(db *gorm.DB, userIDs []uint) (uint, error) {
+	var users []models.User
+	if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return 0, err
+	}
+	if len(users) != len(userIDs) {
+		return 0, fmt.Errorf("%w: unknown user", errNotLinked)
+	}
+
+	var recipientUserID uint
+	var caregiverUserIDs []uint
+	for _, u := range users {
+		switch u.Role {
+		case models.RoleRecipient:
+			if recipientUserID != 0 {
+				return 0, fmt.Errorf("%w: only one recipient per conversation", errNotLinked)
+			}
+			recipientUserID = u.ID
+		case models.RoleCaregiver:
+			caregiverUserIDs = append(caregiverUserIDs, u.ID)
+		default:
+			return 0, fmt.Errorf("%w: unsupported participant role", errNotLinked)
+		}
+	}
+	if recipientUserID == 0 {
+		return 0, fmt.Errorf("%w: a recipient must take part", errNotLinked)
+	}
+
+	var recipient models.Recipient
+	if err := db.First(&recipient, "user_id = ?", recipientUserID).Error; err != nil {
+		return 0, err
+	}
+
+	var linked int64
+	if err := db.Model(&models.CaregiverRecipient{}).
+		Joins("JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id").
+		Where("caregiver_recipients.recipient_id = ? AND caregivers.user_id IN ?", recipient.ID, caregiverUserIDs).
+		Count(&linked).Error; err != nil {
+		return 0, err
+	}
+	if int(linked) != len(caregiverUserIDs) {
+		return 0, errNotLinked
+	}
+
+	return recipient.ID, nil
+}
+
+func (h ConversationHandler) List(c *gin.Context) {
+	userID := auth.UserID(c)
+
+	var conversations []models.Conversation
+	if err := h.DB.
+		Preload("Participants.User").
+		Where("id IN (?)", h.DB.Model(&models.ConversationParticipant{}).
+			Select("conversation_id").
+			Where("user_id = ?", userID)).
+		Order("updated_at DESC").
+		Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids := make([]uint, 0, len(conversations))
+	for _, conv := range conversations {
+		ids = append(ids, conv.ID)
+	}
+
+	type unreadRow struct {
+		ConversationID uint
+		Unread         int64
+	}
+	var unread []unreadRow
+	if err := h.DB.
+		Table("messages m").
+		Select("m.conversation_id, COUNT(*) AS unread").
+		Joins("JOIN conversation_participants p ON p.conversation_id = m.conversation_id AND p.user_id = ?", userID).
+		Where("m.conversation_id IN ? AND m.id > p.last_read_message_id AND m.sender_id <> ?", ids, userID).
+		Group("m.conversation_id").
+		Scan(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unreadByConv := make(map[uint]int64, len(unread))
+	for _, row := range unread {
+		unreadByConv[row.ConversationID] = row.Unread
+	}
+
+	var latest []models.Message
+	if err := h.DB.
+		Raw(`SELECT DISTINCT ON (conversation_id) * FROM messages
+			WHERE conversation_id IN ? ORDER BY conversation_id, id DESC`, ids).
+		Scan(&latest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	latestByConv := make(map[uint]*models.Message, len(latest))
+	for i := range latest {
+		latestByConv[latest[i].ConversationID] = &latest[i]
+	}
+
+	res := make([]models.ConversationSummary, 0, len(conversations))
+	for _, conv := range conversations {
+		res = append(res, models.ConversationSummary{
+			Conversation: conv,
+			UnreadCount:  unreadByConv[conv.ID],
+			LastMessage:  latestByConv[conv.ID],
+		})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// loadParticipating resolves the conversation in the path and ensures the
+// caller takes part in it.
+func (h ConversationHandler) loadParticipating(c *gin.Context) (models.Conversation, bool) {
+	var conversation models.Conversation
+	if err := h.DB.Preload("Participants.User").First(&conversation, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return conversation, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return conversation, false
+	}
+
+	userID := auth.UserID(c)
+	for _, p := range conversation.Participants {
+		if p.UserID == userID {
+			return conversation, true
+		}
+	}
+
+	// Don't reveal conversations the caller isn't part of
+	c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+	return conversation, false
+}
+
+func (h ConversationHandler) ListMessages(c *gin.Context) {
+	conversation, ok := h.loadParticipating(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if s := c.Query("limit"); s != "" {
+		if _, err := fmt.Sscan(s, &limit); err != nil || limit < 1 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	q := h.DB.
+		Preload("Attachments").
+		Where("conversation_id = ?", conversation.ID).
+		Order("id DESC").
+		Limit(limit)
+	if before := c.Query("before"); before != "" {
+		q = q.Where("id < ?", before) // message id, for paging back
+	}
+
+	var messages []models.Message
+	if err := q.Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	names := make(map[uint]string, len(conversation.Participants))
+	for _, p := range conversation.Participants {
+		names[p.UserID] = p.User.Name
+	}
+
+	// Oldest first for display
+	res := make([]models.MessageReturned, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		readBy := []uint{}
+		for _, p := range conversation.Participants {
+			if p.UserID != m.SenderID && p.LastReadMessageID >= m.ID {
+				readBy = append(readBy, p.UserID)
+			}
+		}
+		res = append(res, models.MessageReturned{
+			Message:    m,
+			SenderName: names[m.SenderID],
+			ReadBy:     readBy,
+		})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+type sendMessageRequest struct {
+	Content     string `json:"content"`
+	Attachments []struct {
+		Url      string `json:"url" binding:"required"`
+		FileName string `json:"fileName"`
+	} `json:"attachments" binding:"dive"`
+}
+
+func (h ConversationHandler) SendMessage(c *gin.Context) {
+	conversation, ok := h.loadParticipating(c)
+	if !ok {
+		return
+	}
+
+	var req sendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" && len(req.Attachments) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content or attachments are required"})
+		return
+	}
+
+	userID := auth.UserID(c)
+
+	// A caregiver who has since been unlinked can no longer post
+	var recipient models.Recipient
+	if err := h.DB.First(&recipient, conversation.RecipientID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := conversationRecipient(h.DB, uniqueIDs([]uint{recipient.UserID, userID})); err != nil {
+		if errors.Is(err, errNotLinked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+		Content:        req.Content,
+	}
+	for _, a := range req.Attachments {
+		upload, err := ownUpload(h.DB, a.Url, userID)
+		if errors.Is(err, errUploadNotOwned) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "attachments: " + err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		message.Attachments = append(message.Attachments, models.MessageAttachment{Url: upload.Url(), FileName: a.FileName})
+	}
+
+	now := time.Now()
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Conversation{}).
+			Where("id = ?", conversation.ID).
+			Update("updated_at", now).Error; err != nil {
+			return err
+		}
+		// The sender has obviously seen their own message
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversation.ID, userID).
+			Updates(map[string]any{"last_read_message_id": message.ID, "last_read_at": now}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
+
+type markReadRequest struct {
+	MessageID *uint `json:"messageId"` // defaults to the latest message
+}
+
+func (h ConversationHandler) MarkRead(c *gin.Context) {
+	conversation, ok := h.loadParticipating(c)
+	if !ok {
+		return
+	}
+
+	var req markReadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var message models.Message
+	q := h.DB.Where("conversation_id = ?", conversation.ID)
+	if req.MessageID != nil {
+		q = q.Where("id = ?", *req.MessageID)
+	}
+	if err := q.Order("id DESC").First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Never move the read marker backwards
+	if err := h.DB.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversation.ID, auth.UserID(c), message.ID).
+		Updates(map[string]any{"last_read_message_id": message.ID, "last_read_at": time.Now()}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
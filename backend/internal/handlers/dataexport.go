@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/export"
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+)
+
+type DataExportHandler struct {
+	DB *gorm.DB
+}
+
+// withDownloadURL adds a signed link to ready exports. The link lives as long
+// as the archive.
+func withDownloadURL(exp *models.DataExport) {
+	if exp.Status != models.ExportReady || exp.ExpiresAt == nil {
+		return
+	}
+	sig := export.Signature(exp.ID, *exp.ExpiresAt)
+	if sig == "" {
+		return
+	}
+	exp.DownloadURL = fmt.Sprintf("/exports/%d/download?expires=%d&sig=%s", exp.ID, exp.ExpiresAt.Unix(), sig)
+}
+
+// Create queues a new export of the caller's data.
+func (h DataExportHandler) Create(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var running int64
+	if err := h.DB.Model(&models.DataExport{}).
+		Where("user_id = ? AND status IN ?", userID, []models.DataExportStatus{models.ExportPending, models.ExportRunning}).
+		Count(&running).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "an export is already being prepared"})
+		return
+	}
+
+	exp := models.DataExport{UserID: userID, Status: models.ExportPending}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&exp).Error; err != nil {
+			return err
+		}
+		_, err := jobs.Enqueue(tx, export.JobKind, export.JobPayload{ExportID: exp.ID})
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "export.requested", ResourceType: "data_export", ResourceID: &exp.ID})
+
+	c.JSON(http.StatusAccepted, exp)
+}
+
+// List shows the caller's exports, newest first.
+func (h DataExportHandler) List(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var exports []models.DataExport
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range exports {
+		withDownloadURL(&exports[i])
+	}
+
+	c.JSON(http.StatusOK, exports)
+}
+
+// Get shows one of the caller's exports.
+func (h DataExportHandler) Get(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var exp models.DataExport
+	if err := h.DB.First(&exp, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	withDownloadURL(&exp)
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// Download serves the archive for a signed, unexpired link to an active
+// account's export.
+func (h DataExportHandler) Download(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || !export.VerifySignature(uint(id64), c.Query("expires"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "download link is invalid or has expired"})
+		return
+	}
+
+	// Links stop working once the account is deactivated
+	var exp models.DataExport
+	if err := h.DB.
+		Where("user_id IN (?)", h.DB.Model(&models.User{}).Select("id").Where("active")).
+		First(&exp, "id = ? AND status = ?", id64, models.ExportReady).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	if exp.ExpiresAt == nil || time.Now().After(*exp.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "export has expired"})
+		return
+	}
+
+	c.FileAttachment(exp.FilePath, fmt.Sprintf("my-data-%s.zip", exp.CreatedAt.Format("2006-01-02")))
+}
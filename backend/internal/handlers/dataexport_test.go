@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"hack4good/internal/models"
+)
+
+func TestDataExportsRefuseAnonymous(t *testing.T) {
+	h := DataExportHandler{}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{"create", h.Create},
+		{"list", h.List},
+		{"get", h.Get},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(0, "")
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+			tt.handler(c)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", w.Code)
+			}
+		})
+	}
+}
+
+func TestDataExportGetOnlyOwn(t *testing.T) {
+	tables := fakeTables{"data_exports": {{"id": int64(1), "user_id": int64(8), "status": string(models.ExportReady)}}}
+	c, w := testContext(7, models.RoleRecipient)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	DataExportHandler{DB: fakeDB(t, tables)}.Get(c)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for someone else's export", w.Code)
+	}
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/loginguard"
+	"hack4good/internal/models"
+)
+
+const (
+	loginCodeTTL      = 15 * time.Minute
+	loginCodeDigits   = 8
+	deviceSessionTTL  = 30 * 24 * time.Hour
+	defaultDeviceName = "Recipient device"
+)
+
+var errLoginCodeInvalid = errors.New("code is invalid or has expired")
+
+// managesRecipientDevices lets the recipient, a linked guardian or a linked
+// caregiver granted manage_devices manage the recipient's device logins,
+// writing a 403 otherwise.
+func managesRecipientDevices(c *gin.Context, db *gorm.DB, recipientID uint) bool {
+	switch models.UserRole(auth.Role(c)) {
+	case models.RoleRecipient:
+		own, err := isRecipientUser(c, db, recipientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if !own {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not your recipient profile"})
+		}
+		return own
+
+	case models.RoleGuardian:
+		var count int64
+		if err := db.Model(&models.GuardianRecipient{}).
+			Joins("JOIN guardians ON guardians.id = guardian_recipients.guardian_id").
+			Where("guardians.user_id = ? AND guardian_recipients.recipient_id = ?", auth.UserID(c), recipientID).
+			Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if count == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "guardian is not linked to this recipient"})
+			return false
+		}
+		return true
+	}
+
+	caregiver, ok := callerCaregiver(c, db)
+	if !ok {
+		return false
+	}
+	return requireScope(c, db, caregiver.ID, recipientID, models.ScopeManageDevices)
+}
+
+func newNumericCode() (string, error) {
+	max := big.NewInt(1)
+	for range loginCodeDigits {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", loginCodeDigits, n), nil
+}
+
+type createLoginCodeRequest struct {
+	DeviceName string `json:"deviceName" binding:"max=100"`
+}
+
+// CreateLoginCode issues a short-lived code and magic link the recipient
+// uses to sign in on a device. The recipient is told when someone else
+// created it.
+func (h AuthHandler) CreateLoginCode(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok || !managesRecipientDevices(c, h.DB, recipientID) {
+		return
+	}
+
+	var req createLoginCodeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	var code string
+	// Codes are short, so make sure no other live code shares this one
+	for {
+		if code, err = newNumericCode(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var count int64
+		if err := h.DB.Model(&models.LoginCode{}).
+			Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(code), now).
+			Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if count == 0 {
+			break
+		}
+	}
+
+	deviceName := strings.TrimSpace(req.DeviceName)
+	if deviceName == "" {
+		deviceName = defaultDeviceName
+	}
+	loginCode := models.LoginCode{
+		RecipientID: recipientID,
+		CreatedByID: auth.UserID(c),
+		CodeHash:    hashToken(code),
+		TokenHash:   hashToken(token),
+		DeviceName:  deviceName,
+		ExpiresAt:   now.Add(loginCodeTTL),
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&loginCode).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditLog{
+			Action:       "auth.login_code_created",
+			ResourceType: "login_code",
+			ResourceID:   &loginCode.ID,
+			RecipientID:  &recipientID,
+		}); err != nil {
+			return err
+		}
+		return notifyLoginCode(tx, loginCode)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.LoginCodeIssued{
+		LoginCode: loginCode,
+		Code:      code,
+		Url:       appURL("/device-login", token),
+	})
+}
+
+// notifyLoginCode tells the recipient someone created a login code for them,
+// so an unexpected one can be revoked.
+func notifyLoginCode(tx *gorm.DB, loginCode models.LoginCode) error {
+	var recipient models.Recipient
+	if err := tx.First(&recipient, loginCode.RecipientID).Error; err != nil {
+		return err
+	}
+	if recipient.UserID == loginCode.CreatedByID {
+		return nil
+	}
+	var creator models.User
+	if err := tx.First(&creator, loginCode.CreatedByID).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.Notification{
+		UserID: recipient.UserID,
+		Kind:   "auth.login_code_created",
+		Title:  "A device sign-in code was created",
+		Body: fmt.Sprintf("%s created a code to sign you in on %q. If you didn't expect this, "+
+			"sign the device out from your device sessions.", creator.Name, loginCode.DeviceName),
+	}).Error
+}
+
+type loginWithCodeRequest struct {
+	Code  string `json:"code" binding:"required_without=Token"`
+	Token string `json:"token" binding:"required_without=Code"` // from the magic link
+}
+
+// LoginWithCode redeems a login code and starts a device session. Wrong codes
+// count against the caller's IP and against the code itself, so one code
+// can't be guessed at from many IPs.
+func (h AuthHandler) LoginWithCode(c *gin.Context) {
+	var req loginWithCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lookup := h.DB.Where("token_hash = ?", hashToken(req.Token))
+	codeKey := "login_code:token:" + hashToken(req.Token)
+	if req.Code != "" {
+		code := strings.ReplaceAll(strings.TrimSpace(req.Code), " ", "")
+		lookup = h.DB.Where("code_hash = ?", hashToken(code))
+		codeKey = "login_code:code:" + hashToken(code)
+	}
+
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	for _, check := range []func() (time.Duration, error){
+		func() (time.Duration, error) { return h.Limiter.CheckIP(ctx, ip) },
+		func() (time.Duration, error) { return h.Limiter.Check(ctx, codeKey) },
+	} {
+		wait, err := check()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	now := time.Now()
+	var u models.User
+	var session models.DeviceSession
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var loginCode models.LoginCode
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Recipient").
+			Where(lookup).
+			Where("used_at IS NULL AND expires_at > ?", now).
+			First(&loginCode).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errLoginCodeInvalid
+			}
+			return err
+		}
+
+		if err := tx.First(&u, loginCode.Recipient.UserID).Error; err != nil {
+			return err
+		}
+		if !u.Active {
+			return auth.ErrAccountInactive
+		}
+
+		session = models.DeviceSession{
+			UserID:      u.ID,
+			RecipientID: loginCode.RecipientID,
+			Name:        loginCode.DeviceName,
+			CreatedByID: loginCode.CreatedByID,
+			UserAgent:   c.Request.UserAgent(),
+			LastUsedAt:  now,
+			ExpiresAt:   now.Add(deviceSessionTTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Model(&loginCode).Updates(map[string]any{
+			"used_at":           now,
+			"device_session_id": session.ID,
+		}).Error
+	})
+	if errors.Is(err, errLoginCodeInvalid) {
+		if err := h.Limiter.FailureIP(ctx, ip); err != nil {
+			log.Printf("recording login code failure for %s: %v", ip, err)
+		}
+		if err := h.Limiter.Failure(ctx, codeKey, loginguard.LoginCodePolicy); err != nil {
+			log.Printf("recording login code failure: %v", err)
+		}
+		_ = recordAudit(h.DB, c, models.AuditLog{Action: "auth.login_code_failed", ResourceType: "login_code"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, auth.ErrAccountInactive) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := auth.SignDeviceToken(u.ID, string(u.Role), u.TokenVersion, session.ID, session.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign token"})
+		return
+	}
+	h.respondSession(c, u, token, nil)
+}
+
+// ListDeviceSessions shows the recipient's active device logins.
+func (h AuthHandler) ListDeviceSessions(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok || !managesRecipientDevices(c, h.DB, recipientID) {
+		return
+	}
+
+	var sessions []models.DeviceSession
+	if err := h.DB.
+		Where("recipient_id = ? AND revoked_at IS NULL AND expires_at > ?", recipientID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeDeviceSession signs a device out immediately.
+func (h AuthHandler) RevokeDeviceSession(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok || !managesRecipientDevices(c, h.DB, recipientID) {
+		return
+	}
+
+	var session models.DeviceSession
+	if err := h.DB.First(&session, "id = ? AND recipient_id = ?", c.Param("sessionId"), recipientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if session.RevokedAt == nil {
+		now := time.Now()
+		revokedBy := auth.UserID(c)
+		if err := h.DB.Model(&session).Updates(map[string]any{
+			"revoked_at":    now,
+			"revoked_by_id": revokedBy,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_ = recordAudit(h.DB, c, models.AuditLog{
+			Action:       "auth.device_session_revoked",
+			ResourceType: "device_session",
+			ResourceID:   &session.ID,
+			RecipientID:  &recipientID,
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
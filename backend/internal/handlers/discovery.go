@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+// Profile fields shown to unlinked caregivers when a recipient hasn't chosen.
+var defaultPublicFields = []string{"age", "languages", "availability"}
+
+// recipientViewer describes who is looking at recipient profiles. Callers
+// without a token are anonymous and only ever see public fields.
+type recipientViewer struct {
+	userID       uint
+	linked       map[uint]bool // recipient IDs the viewer is linked to as a caregiver or guardian
+	linkedIDList []uint
+}
+
+func resolveViewer(c *gin.Context, db *gorm.DB) (recipientViewer, error) {
+	v := recipientViewer{userID: auth.UserID(c), linked: map[uint]bool{}}
+	if v.userID == 0 {
+		return v, nil
+	}
+
+	if err := db.Model(&models.CaregiverRecipient{}).
+		Joins("JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id").
+		Where("caregivers.user_id = ?", v.userID).
+		Pluck("caregiver_recipients.recipient_id", &v.linkedIDList).Error; err != nil {
+		return v, err
+	}
+	var guarded []uint
+	if err := db.Model(&models.GuardianRecipient{}).
+		Joins("JOIN guardians ON guardians.id = guardian_recipients.guardian_id").
+		Where("guardians.user_id = ?", v.userID).
+		Pluck("guardian_recipients.recipient_id", &guarded).Error; err != nil {
+		return v, err
+	}
+	v.linkedIDList = append(v.linkedIDList, guarded...)
+
+	for _, id := range v.linkedIDList {
+		v.linked[id] = true
+	}
+	return v, nil
+}
+
+// canSeeAll reports whether the viewer is the recipient or linked to them.
+func (v recipientViewer) canSeeAll(r models.Recipient) bool {
+	return (v.userID != 0 && r.UserID == v.userID) || v.linked[r.ID]
+}
+
+// scope limits a recipients query to those the viewer may find at all.
+func (v recipientViewer) scope(db *gorm.DB) *gorm.DB {
+	return db.Where("(recipients.discoverable = ? OR recipients.user_id = ? OR recipients.id IN ?)",
+		true, v.userID, append([]uint{0}, v.linkedIDList...))
+}
+
+// present strips everything the viewer isn't allowed to see.
+func (v recipientViewer) present(r *models.Recipient) {
+	if v.canSeeAll(*r) {
+		if r.UserID != v.userID {
+			r.InviteCode = nil
+		}
+		return
+	}
+	redactRecipient(r)
+}
+
+func redactRecipient(r *models.Recipient) {
+	public := r.PublicFields
+	if public == nil {
+		public = defaultPublicFields
+	}
+	show := func(field string) bool { return slices.Contains(public, field) }
+
+	if !show("age") {
+		r.Age = nil
+	}
+	if !show("condition") {
+		r.Condition = nil
+	}
+	if !show("likes") {
+		r.Likes = nil
+	}
+	if !show("dislikes") {
+		r.Dislikes = nil
+	}
+	if !show("phobias") {
+		r.Phobias = nil
+	}
+	if !show("petPeeves") {
+		r.PetPeeves = nil
+	}
+	if !show("needs") {
+		r.Needs = nil
+	}
+	if !show("languages") {
+		r.Languages = nil
+	}
+	if !show("availability") {
+		r.Availability = nil
+	}
+
+	r.User.Username = ""
+	r.InviteCode = nil
+}
+
+// Unambiguous characters only, since codes are read out and typed by hand.
+const inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// RotateInviteCode issues a fresh invite code for the calling recipient,
+// invalidating any previous one.
+func (h RecipientHandler) RotateInviteCode(c *gin.Context) {
+	recipient, ok := h.loadOwn(c)
+	if !ok {
+		return
+	}
+
+	for range 5 {
+		code, err := generateInviteCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var taken int64
+		if err := h.DB.Model(&models.Recipient{}).Where("invite_code = ?", code).Count(&taken).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if taken > 0 {
+			continue
+		}
+
+		if err := h.DB.Model(&recipient).Update("invite_code", code).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"inviteCode": code})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate a unique invite code"})
+}
+
+func (h RecipientHandler) DisableInviteCode(c *gin.Context) {
+	recipient, ok := h.loadOwn(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Model(&recipient).Update("invite_code", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetByInviteCode lets a caregiver preview who they are about to send a
+// request to, even when the recipient isn't discoverable.
+func (h RecipientHandler) GetByInviteCode(c *gin.Context) {
+	recipient, ok := findByInviteCode(c, h.DB, h.Limiter, c.Param("code"))
+	if !ok {
+		return
+	}
+
+	viewer, err := resolveViewer(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	viewer.present(&recipient)
+
+	auditTarget(c, recipient.ID, recipient.ID)
+	c.JSON(http.StatusOK, recipient)
+}
+
+// loadOwn resolves the recipient in the path, which must be the caller.
+func (h RecipientHandler) loadOwn(c *gin.Context) (models.Recipient, bool) {
+	var recipient models.Recipient
+	if err := h.DB.First(&recipient, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return recipient, false
+	}
+	if recipient.UserID != auth.UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "recipients can only manage their own invite code"})
+		return recipient, false
+	}
+	return recipient, true
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+type GuardianHandler struct {
+	DB *gorm.DB
+}
+
+// actingGuardian lets the recipient or one of their guardians holding perm
+// act on the recipient's behalf. The recipient gets (nil, true), a permitted
+// guardian gets their link, and everyone else a 401 or 403.
+func actingGuardian(c *gin.Context, db *gorm.DB, recipientID uint, perm models.GuardianPermission) (*models.GuardianRecipient, bool) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	isRecipient, err := isRecipientUser(c, db, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if isRecipient {
+		return nil, true
+	}
+
+	link, err := guardianLink(db, userID, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if link == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient or their guardian can do this"})
+		return nil, false
+	}
+	if !guardianPermits(*link, perm) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "recipient has not granted this permission"})
+		return nil, false
+	}
+
+	return link, true
+}
+
+// guardianLink returns the user's guardian link to the recipient, or nil when
+// they are not one of the recipient's guardians.
+func guardianLink(db *gorm.DB, userID, recipientID uint) (*models.GuardianRecipient, error) {
+	var link models.GuardianRecipient
+	err := db.
+		Preload("Recipient").
+		Joins("JOIN guardians ON guardians.id = guardian_recipients.guardian_id").
+		Where("guardians.user_id = ? AND guardian_recipients.recipient_id = ?", userID, recipientID).
+		First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func guardianPermits(link models.GuardianRecipient, perm models.GuardianPermission) bool {
+	switch perm {
+	case models.GuardianRespondToRequests:
+		return link.CanRespondToRequests
+	case models.GuardianEditProfile:
+		return link.CanEditProfile
+	case models.GuardianViewJournal:
+		return link.CanViewJournal
+	}
+	return false
+}
+
+// recordOnBehalf logs an action a guardian took for the recipient.
+func recordOnBehalf(db *gorm.DB, c *gin.Context, link *models.GuardianRecipient, action, resourceType string, resourceID uint) error {
+	recipientUserID := link.Recipient.UserID
+	return recordAudit(db, c, models.AuditLog{
+		OnBehalfOfID: &recipientUserID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   &resourceID,
+		RecipientID:  &link.RecipientID,
+	})
+}
+
+type guardianPermissionsRequest struct {
+	CanRespondToRequests *bool `json:"canRespondToRequests"`
+	CanEditProfile       *bool `json:"canEditProfile"`
+	CanViewJournal       *bool `json:"canViewJournal"`
+}
+
+type addGuardianRequest struct {
+	Username string `json:"username" binding:"required"`
+	guardianPermissionsRequest
+}
+
+func applyGuardianPermissions(req guardianPermissionsRequest, link *models.GuardianRecipient) {
+	if req.CanRespondToRequests != nil {
+		link.CanRespondToRequests = *req.CanRespondToRequests
+	}
+	if req.CanEditProfile != nil {
+		link.CanEditProfile = *req.CanEditProfile
+	}
+	if req.CanViewJournal != nil {
+		link.CanViewJournal = *req.CanViewJournal
+	}
+}
+
+// ownRecipient resolves the recipient in the path, which must be the caller.
+func ownRecipient(c *gin.Context, db *gorm.DB) (models.Recipient, bool) {
+	var recipient models.Recipient
+	if err := db.First(&recipient, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return recipient, false
+	}
+	if recipient.UserID != auth.UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient can do this"})
+		return recipient, false
+	}
+	return recipient, true
+}
+
+// Add links a guardian, found by username, to the calling recipient.
+func (h GuardianHandler) Add(c *gin.Context) {
+	recipient, ok := ownRecipient(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var req addGuardianRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var guardian models.Guardian
+	if err := h.DB.
+		Joins("JOIN users ON users.id = guardians.user_id").
+		Where("users.username = ?", strings.ToLower(strings.TrimSpace(req.Username))).
+		First(&guardian).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "guardian not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.GuardianRecipient{}).
+		Where("guardian_id = ? AND recipient_id = ?", guardian.ID, recipient.ID).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "guardian already linked"})
+		return
+	}
+
+	link := models.GuardianRecipient{GuardianID: guardian.ID, RecipientID: recipient.ID}
+	applyGuardianPermissions(req.guardianPermissionsRequest, &link)
+
+	if err := h.DB.Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Guardian.User").First(&link, link.ID)
+
+	c.JSON(http.StatusCreated, link)
+}
+
+func (h GuardianHandler) ListByRecipient(c *gin.Context) {
+	recipient, ok := ownRecipient(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var links []models.GuardianRecipient
+	if err := h.DB.
+		Preload("Guardian.User").
+		Where("recipient_id = ?", recipient.ID).
+		Order("id asc").
+		Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// UpdatePermissions lets the recipient change what a guardian may do.
+func (h GuardianHandler) UpdatePermissions(c *gin.Context) {
+	recipient, ok := ownRecipient(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var req guardianPermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var link models.GuardianRecipient
+	if err := h.DB.First(&link, "guardian_id = ? AND recipient_id = ?", c.Param("guardianId"), recipient.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "guardian not linked"})
+		return
+	}
+
+	applyGuardianPermissions(req, &link)
+
+	if err := h.DB.Save(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Guardian.User").First(&link, link.ID)
+
+	c.JSON(http.StatusOK, link)
+}
+
+// Remove unlinks a guardian. Either the recipient or the guardian may do this.
+func (h GuardianHandler) Remove(c *gin.Context) {
+	var link models.GuardianRecipient
+	if err := h.DB.
+		Preload("Guardian").
+		Preload("Recipient").
+		First(&link, "guardian_id = ? AND recipient_id = ?", c.Param("guardianId"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "guardian not linked"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	if link.Recipient.UserID != userID && link.Guardian.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient or the guardian can remove this link"})
+		return
+	}
+
+	if err := h.DB.Delete(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListManaged returns the recipients the calling guardian manages.
+func (h GuardianHandler) ListManaged(c *gin.Context) {
+	var links []models.GuardianRecipient
+	if err := h.DB.
+		Preload("Recipient.User").
+		Joins("JOIN guardians ON guardians.id = guardian_recipients.guardian_id").
+		Where("guardians.user_id = ?", auth.UserID(c)).
+		Order("guardian_recipients.id asc").
+		Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+type HandoverNoteHandler struct {
+	DB *gorm.DB
+}
+
+func parseRecipientParam(c *gin.Context) (uint, bool) {
+	recipientID64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recipient id"})
+		return 0, false
+	}
+	return uint(recipientID64), true
+}
+
+func (h HandoverNoteHandler) notes(recipientID uint) *gorm.DB {
+	return h.DB.
+		Preload("Author.User").
+		Preload("Acknowledgements.Caregiver.User").
+		Where("recipient_id = ?", recipientID)
+}
+
+func (h HandoverNoteHandler) List(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok {
+		return
+	}
+
+	q := h.notes(recipientID).Order("pinned DESC, created_at DESC")
+
+	// The recipient only sees notes explicitly shared with them
+	isRecipient, err := isRecipientUser(c, h.DB, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if isRecipient {
+		q = q.Where("visible_to_recipient = ?", true)
+	} else if _, ok := linkedCaregiver(c, h.DB, recipientID); !ok {
+		return
+	}
+
+	var notes []models.HandoverNote
+	if err := q.Find(&notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+type createHandoverNoteRequest struct {
+	Content            string `json:"content" binding:"required"`
+	Pinned             bool   `json:"pinned"`
+	VisibleToRecipient bool   `json:"visibleToRecipient"`
+}
+
+func (h HandoverNoteHandler) Create(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok {
+		return
+	}
+
+	var req createHandoverNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	caregiver, ok := linkedCaregiver(c, h.DB, recipientID)
+	if !ok {
+		return
+	}
+
+	note := models.HandoverNote{
+		RecipientID:        recipientID,
+		AuthorID:           caregiver.ID,
+		Content:            strings.TrimSpace(req.Content),
+		Pinned:             req.Pinned,
+		VisibleToRecipient: req.VisibleToRecipient,
+	}
+
+	if err := h.DB.Create(&note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.notes(recipientID).First(&note, note.ID)
+
+	c.JSON(http.StatusCreated, note)
+}
+
+// loadNote resolves the note in the path for a caregiver linked to its recipient.
+func (h HandoverNoteHandler) loadNote(c *gin.Context) (models.HandoverNote, models.Caregiver, bool) {
+	var note models.HandoverNote
+	if err := h.DB.First(&note, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "handover note not found"})
+			return note, models.Caregiver{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return note, models.Caregiver{}, false
+	}
+
+	caregiver, ok := linkedCaregiver(c, h.DB, note.RecipientID)
+	return note, caregiver, ok
+}
+
+type updateHandoverNoteRequest struct {
+	Content            *string `json:"content"`
+	Pinned             *bool   `json:"pinned"`
+	VisibleToRecipient *bool   `json:"visibleToRecipient"`
+}
+
+func (h HandoverNoteHandler) Update(c *gin.Context) {
+	var req updateHandoverNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, caregiver, ok := h.loadNote(c)
+	if !ok {
+		return
+	}
+
+	// Any linked caregiver may pin; only the author may rewrite or share it
+	if (req.Content != nil || req.VisibleToRecipient != nil) && note.AuthorID != caregiver.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit this note"})
+		return
+	}
+
+	if req.Content != nil {
+		note.Content = strings.TrimSpace(*req.Content)
+	}
+	if req.Pinned != nil {
+		note.Pinned = *req.Pinned
+	}
+	if req.VisibleToRecipient != nil {
+		note.VisibleToRecipient = *req.VisibleToRecipient
+	}
+
+	if err := h.DB.Save(&note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.notes(note.RecipientID).First(&note, note.ID)
+
+	c.JSON(http.StatusOK, note)
+}
+
+func (h HandoverNoteHandler) Delete(c *gin.Context) {
+	note, caregiver, ok := h.loadNote(c)
+	if !ok {
+		return
+	}
+
+	if note.AuthorID != caregiver.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can delete this note"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.HandoverNote{}, note.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Acknowledge marks the note as read by the calling caregiver (idempotent).
+func (h HandoverNoteHandler) Acknowledge(c *gin.Context) {
+	note, caregiver, ok := h.loadNote(c)
+	if !ok {
+		return
+	}
+
+	ack := models.HandoverAcknowledgement{
+		NoteID:      note.ID,
+		CaregiverID: caregiver.ID,
+	}
+	if err := h.DB.FirstOrCreate(
+		&ack,
+		"note_id = ? AND caregiver_id = ?",
+		note.ID, caregiver.ID,
+	).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.notes(note.RecipientID).First(&note, note.ID)
+
+	c.JSON(http.StatusOK, note)
+}
+
+// Digest summarizes the last 24 hours for a recipient: completed todos if the
+// caregiver may manage them, journal moods the caregiver may see, and
+// handover notes.
+func (h HandoverNoteHandler) Digest(c *gin.Context) {
+	recipientID, ok := parseRecipientParam(c)
+	if !ok {
+		return
+	}
+
+	caregiver, ok := linkedCaregiver(c, h.DB, recipientID)
+	if !ok {
+		return
+	}
+
+	until := time.Now()
+	since := until.Add(-24 * time.Hour)
+
+	digest := models.HandoverDigest{
+		RecipientID:    recipientID,
+		Since:          since,
+		Until:          until,
+		CompletedTodos: []models.Todo{},
+		Moods:          []models.MoodLog{},
+		MoodCounts:     map[models.MoodType]int{},
+		Notes:          []models.HandoverNote{},
+	}
+
+	var link models.CaregiverRecipient
+	if err := h.DB.First(&link, "caregiver_id = ? AND recipient_id = ?", caregiver.ID, recipientID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if slices.Contains(effectiveScopes(link), models.ScopeManageTodos) {
+		if err := h.DB.
+			Where("recipient_id = ? AND completed = ? AND completed_at >= ?", recipientID, true, since).
+			Order("completed_at DESC").
+			Find(&digest.CompletedTodos).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var entries []models.JournalEntry
+	if err := h.DB.
+		Scopes(visibleToCaregiver(caregiver.ID)).
+		Where("journal_entries.recipient_id = ? AND journal_entries.created_at >= ?", recipientID, since).
+		Order("journal_entries.created_at ASC").
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, entry := range entries {
+		digest.Moods = append(digest.Moods, models.MoodLog{
+			JournalEntryID: entry.ID,
+			Mood:           entry.Mood,
+			CreatedAt:      entry.CreatedAt,
+		})
+		digest.MoodCounts[entry.Mood]++
+	}
+
+	if err := h.notes(recipientID).
+		Where("(created_at >= ? OR updated_at >= ?)", since, since).
+		Order("pinned DESC, created_at DESC").
+		Find(&digest.Notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, digest)
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
+)
+
+const (
+	defaultInviteTTL = 72 * time.Hour
+	maxInviteTTL     = 14 * 24 * time.Hour
+	inviteQRSize     = 256
+)
+
+type InviteHandler struct {
+	DB *gorm.DB
+}
+
+// inviteURL is the frontend page that redeems a token.
+func inviteURL(token string) string {
+	return appURL("/invite", token)
+}
+
+func (h InviteHandler) record(db *gorm.DB, c *gin.Context, inviteID uint, action models.InviteAction, detail string) error {
+	return db.Create(&models.InviteEvent{
+		InviteID: inviteID,
+		Action:   action,
+		ActorID:  auth.UserID(c),
+		Detail:   detail,
+		IP:       c.ClientIP(),
+	}).Error
+}
+
+type createInviteRequest struct {
+	AutoAccept *bool `json:"autoAccept"` // defaults to true
+	TTLHours   *int  `json:"ttlHours" binding:"omitempty,min=1"`
+}
+
+func (h InviteHandler) Create(c *gin.Context) {
+	var req createInviteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ttl := defaultInviteTTL
+	if req.TTLHours != nil {
+		ttl = time.Duration(*req.TTLHours) * time.Hour
+		if ttl > maxInviteTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invites can last at most 14 days"})
+			return
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite := models.Invite{
+		TokenHash:   hashToken(token),
+		CreatedByID: auth.UserID(c),
+		AutoAccept:  req.AutoAccept == nil || *req.AutoAccept,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+
+	// The invite is issued on behalf of the caller's own profile
+	var recipient models.Recipient
+	var caregiver models.Caregiver
+	if err := h.DB.First(&recipient, "user_id = ?", invite.CreatedByID).Error; err == nil {
+		invite.RecipientID = &recipient.ID
+	} else if err := h.DB.First(&caregiver, "user_id = ?", invite.CreatedByID).Error; err == nil {
+		invite.CaregiverID = &caregiver.ID
+	} else {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers and recipients can create invites"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invite).Error; err != nil {
+			return err
+		}
+		return h.record(tx, c, invite.ID, models.InviteCreated, "")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	link := inviteURL(token)
+	png, err := qrcode.Encode(link, qrcode.Medium, inviteQRSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.InviteWithToken{
+		Invite: invite,
+		Token:  token,
+		Url:    link,
+		QRCode: base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// QRCode renders the invite URL for a still-usable token as a PNG. The token
+// is taken from the body so it never shows up in request logs.
+func (h InviteHandler) QRCode(c *gin.Context) {
+	var req redeemInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	token := req.Token
+
+	var invite models.Invite
+	if err := h.DB.First(&invite, "token_hash = ?", hashToken(token)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+		return
+	}
+	if reason := inviteUnusable(invite); reason != "" {
+		c.JSON(http.StatusGone, gin.H{"error": reason})
+		return
+	}
+
+	png, err := qrcode.Encode(inviteURL(token), qrcode.Medium, inviteQRSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+func inviteUnusable(invite models.Invite) string {
+	switch {
+	case invite.RevokedAt != nil:
+		return "invite has been revoked"
+	case invite.RedeemedAt != nil:
+		return "invite has already been used"
+	case time.Now().After(invite.ExpiresAt):
+		return "invite has expired"
+	}
+	return ""
+}
+
+func (h InviteHandler) List(c *gin.Context) {
+	var invites []models.Invite
+	if err := h.DB.
+		Where("created_by_id = ?", auth.UserID(c)).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// loadOwn resolves the invite in the path, which the caller must have created.
+func (h InviteHandler) loadOwn(c *gin.Context) (models.Invite, bool) {
+	var invite models.Invite
+	if err := h.DB.First(&invite, "id = ? AND created_by_id = ?", c.Param("id"), auth.UserID(c)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+			return invite, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return invite, false
+	}
+	return invite, true
+}
+
+func (h InviteHandler) Revoke(c *gin.Context) {
+	invite, ok := h.loadOwn(c)
+	if !ok {
+		return
+	}
+
+	if reason := inviteUnusable(invite); reason != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": reason})
+		return
+	}
+
+	now := time.Now()
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invite).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return h.record(tx, c, invite.ID, models.InviteRevoked, "")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h InviteHandler) ListEvents(c *gin.Context) {
+	invite, ok := h.loadOwn(c)
+	if !ok {
+		return
+	}
+
+	var events []models.InviteEvent
+	if err := h.DB.
+		Where("invite_id = ?", invite.ID).
+		Order("created_at ASC").
+		Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+type redeemInviteRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// errInviteRejected carries a reason that is shown to the caller and kept in
+// the audit trail.
+type errInviteRejected struct {
+	status int
+	reason string
+}
+
+func (e errInviteRejected) Error() string { return e.reason }
+
+// Redeem connects the caller with the invite's creator: a linked pair when the
+// invite auto-accepts, otherwise a pending care request.
+func (h InviteHandler) Redeem(c *gin.Context) {
+	var req redeemInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := auth.UserID(c)
+	var result models.CareRequest
+	var inviteID uint
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the invite so two redemptions can't both succeed
+		var invite models.Invite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&invite, "token_hash = ?", hashToken(req.Token)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInviteRejected{http.StatusNotFound, "invite not found"}
+			}
+			return err
+		}
+		inviteID = invite.ID
+
+		if reason := inviteUnusable(invite); reason != "" {
+			return errInviteRejected{http.StatusGone, reason}
+		}
+		if invite.CreatedByID == userID {
+			return errInviteRejected{http.StatusBadRequest, "you cannot redeem your own invite"}
+		}
+
+		// Work out the pair from whichever side created the invite
+		var caregiverID, recipientID uint
+		if invite.RecipientID != nil {
+			var caregiver models.Caregiver
+			if err := tx.First(&caregiver, "user_id = ?", userID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errInviteRejected{http.StatusForbidden, "this invite must be redeemed by a caregiver"}
+				}
+				return err
+			}
+			caregiverID, recipientID = caregiver.ID, *invite.RecipientID
+		} else {
+			var recipient models.Recipient
+			if err := tx.First(&recipient, "user_id = ?", userID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errInviteRejected{http.StatusForbidden, "this invite must be redeemed by a recipient"}
+				}
+				return err
+			}
+			caregiverID, recipientID = *invite.CaregiverID, recipient.ID
+		}
+
+		var linked int64
+		if err := tx.Model(&models.CaregiverRecipient{}).
+			Where("caregiver_id = ? AND recipient_id = ?", caregiverID, recipientID).
+			Count(&linked).Error; err != nil {
+			return err
+		}
+		if linked > 0 {
+			return errInviteRejected{http.StatusConflict, "caregiver and recipient already linked"}
+		}
+
+		now := time.Now()
+		status := models.CareRequestPending
+		var respondedAt *time.Time
+		if invite.AutoAccept {
+			status = models.CareRequestAccepted
+			respondedAt = &now
+		}
+
+		// There is at most one request per pair, so reopen any earlier one
+		request := models.CareRequest{CaregiverID: caregiverID, RecipientID: recipientID}
+		if err := tx.Where(&request).FirstOrInit(&request).Error; err != nil {
+			return err
+		}
+		if request.ID != 0 && request.Status == models.CareRequestPending && !invite.AutoAccept {
+			return errInviteRejected{http.StatusConflict, "request already pending"}
+		}
+		request.Status = status
+		request.RequestedAt = now
+		request.RespondedAt = respondedAt
+		if err := tx.Save(&request).Error; err != nil {
+			return err
+		}
+		if err := webhooks.Publish(tx, models.EventCareRequestCreated, request.ID); err != nil {
+			return err
+		}
+
+		if invite.AutoAccept {
+			link := models.CaregiverRecipient{CaregiverID: caregiverID, RecipientID: recipientID}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+			if err := webhooks.Publish(tx, models.EventCareRequestResponded, request.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&invite).Updates(map[string]any{
+			"redeemed_at":     now,
+			"redeemed_by_id":  userID,
+			"care_request_id": request.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		result = request
+		return h.record(tx, c, invite.ID, models.InviteRedeemed, fmt.Sprintf("care request %d %s", request.ID, request.Status))
+	})
+
+	var rejected errInviteRejected
+	if errors.As(err, &rejected) {
+		if inviteID != 0 {
+			_ = h.record(h.DB, c, inviteID, models.InviteRejected, rejected.reason)
+		}
+		c.JSON(rejected.status, gin.H{"error": rejected.reason})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
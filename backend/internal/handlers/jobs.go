@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+)
+
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, jobs.ErrNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func parseJobParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListJobs supports status, kind, limit and offset.
+func (h AdminHandler) ListJobs(c *gin.Context) {
+	filter := jobs.Filter{
+		Status: models.JobStatus(c.Query("status")),
+		Kind:   c.Query("kind"),
+	}
+	switch filter.Status {
+	case "", models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	list, total, err := jobs.List(h.DB, filter)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": list, "total": total})
+}
+
+func (h AdminHandler) GetJob(c *gin.Context) {
+	id, ok := parseJobParam(c)
+	if !ok {
+		return
+	}
+
+	job, err := jobs.Get(h.DB, id)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryJob requeues a dead job with fresh attempts, or runs a queued one now.
+func (h AdminHandler) RetryJob(c *gin.Context) {
+	id, ok := parseJobParam(c)
+	if !ok {
+		return
+	}
+
+	job, err := jobs.Retry(h.DB, id)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "admin.job_retried", ResourceType: "job", ResourceID: &job.ID})
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h AdminHandler) ListJobSchedules(c *gin.Context) {
+	schedules, err := jobs.Schedules(h.DB)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
@@ -8,11 +8,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"hack4good/internal/auth"
+	"hack4good/internal/jobs"
 	"hack4good/internal/models"
+	"hack4good/internal/transcribe"
+	"hack4good/internal/webhooks"
 )
 
 type JournalHandler struct {
@@ -24,9 +29,17 @@ type createJournalEntryRequest struct {
 	Content     string          `json:"content" binding:"required"`
 	Mood        models.MoodType `json:"mood" binding:"required,oneof=happy sad neutral excited angry anxious"`
 	AudioUrl    string          `json:"audiourl"`
+
+	// Defaults to the recipient's defaultJournalVisibility
+	Visibility *models.JournalVisibility `json:"visibility" binding:"omitempty,oneof=private caregivers selected"`
+	SharedWith []uint                    `json:"sharedWith"` // CaregiverIDs, only with selected visibility
 }
 
+// Create adds an entry to the caller's own journal.
 func (h JournalHandler) Create(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
 
 	var req createJournalEntryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -44,23 +57,75 @@ func (h JournalHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if recipient.UserID != auth.UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient can write in their journal"})
+		return
+	}
+
+	visibility := recipient.DefaultJournalVisibility
+	if req.Visibility != nil {
+		visibility = *req.Visibility
+	}
 
 	entry := models.JournalEntry{
 		RecipientID: req.RecipientID,
 		Content:     req.Content,
 		Mood:        req.Mood,
-		AudioUrl:    req.AudioUrl,
+		Visibility:  visibility,
+	}
+	if req.AudioUrl != "" {
+		upload, err := ownUpload(h.DB, req.AudioUrl, recipient.UserID)
+		if errors.Is(err, errUploadNotOwned) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "audiourl: " + err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		entry.AudioUrl = upload.Url()
+		entry.TranscriptStatus = models.TranscriptPending
+	}
+
+	if visibility == models.VisibilitySelected {
+		if err := validateShares(h.DB, recipient.ID, req.SharedWith); err != nil {
+			respondSharesError(c, err)
+			return
+		}
+		entry.Shares = sharesFor(req.SharedWith)
+	} else if len(req.SharedWith) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sharedWith is only allowed when visibility is selected"})
+		return
 	}
 
-	if err := h.DB.Create(&entry).Error; err != nil {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := webhooks.Publish(tx, models.EventJournalEntryCreated, entry.ID); err != nil {
+			return err
+		}
+		if entry.AudioUrl == "" {
+			return nil
+		}
+		_, err := jobs.Enqueue(tx, transcribe.JobKind, transcribe.JobPayload{EntryID: entry.ID})
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	auditTarget(c, entry.ID, entry.RecipientID)
 	c.JSON(http.StatusCreated, entry)
 }
 
+// List returns the entries of one recipient that the caller may read.
 func (h JournalHandler) List(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	recipientIDStr := c.Query("recipientId")
 	if recipientIDStr == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "recipientId is required"})
@@ -73,30 +138,44 @@ func (h JournalHandler) List(c *gin.Context) {
 		return
 	}
 
+	// readableBy decides what is shown; guardian reads are still recorded
+	guardian, err := guardianLink(h.DB, userID, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if guardian != nil && guardian.CanViewJournal {
+		if err := recordOnBehalf(h.DB, c, guardian, "journal.list", "recipient", recipientID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	var entries []models.JournalEntry
 	if err := h.DB.
 		Preload("Recipient").
 		Preload("Recipient.User").
-		Where("recipient_id = ?", recipientID).
-		Order("created_at DESC").
+		Preload("Shares").
+		Scopes(readableBy(userID)).
+		Where("journal_entries.recipient_id = ?", recipientID).
+		Order("journal_entries.created_at DESC").
 		Find(&entries).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := presentEntries(c, h.DB, entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, entries)
 }
 
+// ListAccepted is the calling caregiver's feed of entries across all the
+// recipients they are linked to.
 func (h JournalHandler) ListAccepted(c *gin.Context) {
-	caregiverIDStr := c.Query("caregiverId")
-	if caregiverIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "caregiverId is required"})
-		return
-	}
-
-	var caregiverID uint
-	if _, err := fmt.Sscan(caregiverIDStr, &caregiverID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid caregiverId"})
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
 		return
 	}
 
@@ -104,23 +183,85 @@ func (h JournalHandler) ListAccepted(c *gin.Context) {
 	if err := h.DB.
 		Preload("Recipient").
 		Preload("Recipient.User").
-		Joins("JOIN caregiver_recipients ON caregiver_recipients.recipient_id = journal_entries.recipient_id").
-		Where("caregiver_recipients.caregiver_id = ?", caregiverID).
+		Scopes(visibleToCaregiver(caregiver.ID)).
 		Order("journal_entries.created_at DESC").
 		Find(&entries).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := presentEntries(c, h.DB, entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	// The feed spans recipients, so each one gets its own access record
+	auditRecipients(c, entryRecipients(entries)...)
 	c.JSON(http.StatusOK, entries)
 }
 
+// Search finds entries the caller may read whose content or audio transcript
+// matches q.
+func (h JournalHandler) Search(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	term := strings.TrimSpace(c.Query("q"))
+	if term == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	q := h.DB.
+		Preload("Recipient").
+		Preload("Recipient.User").
+		Scopes(readableBy(userID)).
+		Order("journal_entries.created_at DESC")
+
+	if recipientID := c.Query("recipientId"); recipientID != "" {
+		q = q.Where("journal_entries.recipient_id = ?", recipientID)
+	}
+
+	var entries []models.JournalEntry
+	if err := q.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Content and transcripts are encrypted at rest, so match after it has been decrypted
+	term = strings.ToLower(term)
+	matches := make([]models.JournalEntry, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(strings.ToLower(entry.Content), term) ||
+			entry.Transcript != nil && strings.Contains(strings.ToLower(*entry.Transcript), term) {
+			matches = append(matches, entry)
+		}
+	}
+	if err := presentEntries(c, h.DB, matches); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	auditRecipients(c, entryRecipients(matches)...)
+	c.JSON(http.StatusOK, matches)
+}
+
 type updateJournalEntryRequest struct {
 	Content *string          `json:"content"`
 	Mood    *models.MoodType `json:"mood" binding:"omitempty,oneof=happy sad angry anxious"`
+
+	Visibility *models.JournalVisibility `json:"visibility" binding:"omitempty,oneof=private caregivers selected"`
+	SharedWith []uint                    `json:"sharedWith"` // replaces existing shares
 }
 
+// Update lets the recipient edit their own entry. The caller is recorded as
+// the editor of the revision.
 func (h JournalHandler) Update(c *gin.Context) {
+	editorID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	idStr := c.Param("id")
 
 	var id uint
@@ -135,7 +276,7 @@ func (h JournalHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if req.Content == nil && req.Mood == nil {
+	if req.Content == nil && req.Mood == nil && req.Visibility == nil && req.SharedWith == nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "at least one field must be provided",
 		})
@@ -152,6 +293,22 @@ func (h JournalHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if own, err := isRecipientUser(c, h.DB, entry.RecipientID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !own {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient can edit this entry"})
+		return
+	}
+
+	// Keep the prior state so readers can see what changed
+	revision := models.JournalEntryRevision{
+		JournalEntryID: entry.ID,
+		Content:        entry.Content,
+		Mood:           entry.Mood,
+		EditorID:       editorID,
+	}
+
 	if req.Content != nil {
 		entry.Content = *req.Content
 	}
@@ -159,15 +316,159 @@ func (h JournalHandler) Update(c *gin.Context) {
 		entry.Mood = *req.Mood
 	}
 
-	if err := h.DB.Save(&entry).Error; err != nil {
+	sharingChanged := req.Visibility != nil || req.SharedWith != nil
+	if req.Visibility != nil {
+		entry.Visibility = *req.Visibility
+	}
+	if sharingChanged {
+		if entry.Visibility == models.VisibilitySelected {
+			if err := validateShares(h.DB, entry.RecipientID, req.SharedWith); err != nil {
+				respondSharesError(c, err)
+				return
+			}
+		} else if len(req.SharedWith) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sharedWith is only allowed when visibility is selected"})
+			return
+		}
+	}
+
+	contentChanged := entry.Content != revision.Content || entry.Mood != revision.Mood
+	if !contentChanged && !sharingChanged {
+		c.JSON(http.StatusOK, entry)
+		return
+	}
+	if contentChanged {
+		entry.Edited = true
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if contentChanged {
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+		}
+		if sharingChanged {
+			if err := tx.Where("journal_entry_id = ?", entry.ID).Delete(&models.JournalEntryShare{}).Error; err != nil {
+				return err
+			}
+			if entry.Visibility == models.VisibilitySelected {
+				shares := sharesFor(req.SharedWith)
+				for i := range shares {
+					shares[i].JournalEntryID = entry.ID
+				}
+				if err := tx.Create(&shares).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Save(&entry).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	h.DB.Preload("Shares").First(&entry, entry.ID)
+
 	c.JSON(http.StatusOK, entry)
 }
 
+// ListRevisions returns the prior versions of a journal entry, newest first.
+func (h JournalHandler) ListRevisions(c *gin.Context) {
+	entry, ok := h.loadForHistory(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.RevisionReturned
+	if err := revisionsQuery(h.DB, "journal_entry_revisions", "journal_entry_id", entry.ID).
+		Scan(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (h JournalHandler) GetRevision(c *gin.Context) {
+	entry, ok := h.loadForHistory(c)
+	if !ok {
+		return
+	}
+
+	var revisionID uint
+	if _, err := fmt.Sscan(c.Param("revisionId"), &revisionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision id"})
+		return
+	}
+
+	var revisions []models.RevisionReturned
+	if err := revisionsQuery(h.DB, "journal_entry_revisions", "journal_entry_id", entry.ID).
+		Where("journal_entry_revisions.id = ?", revisionID).
+		Scan(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(revisions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions[0])
+}
+
+// loadForHistory resolves the entry in the path and checks that the caller
+// may see both the entry and its edit history.
+func (h JournalHandler) loadForHistory(c *gin.Context) (models.JournalEntry, bool) {
+	var entry models.JournalEntry
+
+	viewerID, ok := requireUser(c)
+	if !ok {
+		return entry, false
+	}
+
+	var id uint
+	if _, err := fmt.Sscan(c.Param("id"), &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid journal entry id"})
+		return entry, false
+	}
+
+	if err := h.DB.First(&entry, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "journal entry not found"})
+			return entry, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entry, false
+	}
+
+	if err := checkEntryVisible(h.DB, entry, viewerID); err != nil {
+		if errors.Is(err, errEntryNotVisible) || errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusForbidden, gin.H{"error": errEntryNotVisible.Error()})
+			return entry, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entry, false
+	}
+
+	if err := canViewEditHistory(h.DB, entry.RecipientID, viewerID); err != nil {
+		if errors.Is(err, errHistoryHidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return entry, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// Delete removes one of the caller's own entries.
 func (h JournalHandler) Delete(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	idStr := c.Param("id")
 
 	var id uint
@@ -176,7 +477,9 @@ func (h JournalHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	res := h.DB.Delete(&models.JournalEntry{}, id)
+	res := h.DB.
+		Where("recipient_id IN (SELECT id FROM recipients WHERE user_id = ?)", userID).
+		Delete(&models.JournalEntry{}, id)
 	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
 		return
@@ -189,36 +492,59 @@ func (h JournalHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-func (h JournalHandler) UploadAudio(c *gin.Context) {
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+type updateTranscriptRequest struct {
+	Transcript string  `json:"transcript"`
+	Language   *string `json:"language" binding:"omitempty,max=16"`
+}
+
+// UpdateTranscript lets the recipient correct the transcript of their audio
+// entry. An edited transcript is never overwritten by the worker.
+func (h JournalHandler) UpdateTranscript(c *gin.Context) {
+	var req updateTranscriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fileURL := "uploads/" + file.Filename
-
-	// Save to ./uploads/
-	/*
-	randomName, err := GenerateUniqueFilename("./uploads", ".mp4")
 
-	if err != nil {
-		c.JSON(500, gin.H{"error": "could not generate unique filename"})
+	var entry models.JournalEntry
+	if err := h.DB.Preload("Recipient").First(&entry, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "journal entry not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entry.Recipient.UserID != auth.UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient can edit the transcript"})
+		return
+	}
+	if entry.AudioUrl == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "journal entry has no audio"})
 		return
 	}
 
-	uploadPath := "uploads/" + randomName */
+	transcript := strings.TrimSpace(req.Transcript)
+	entry.Transcript = &transcript
+	if req.Language != nil {
+		entry.TranscriptLanguage = *req.Language
+	}
+	entry.TranscriptStatus = models.TranscriptDone
+	entry.TranscriptEdited = true
 
-	if err = c.SaveUploadedFile(file, fileURL); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error uploading": err.Error()})
+	if err := h.DB.Model(&entry).
+		Select("transcript", "transcript_language", "transcript_status", "transcript_edited").
+		Updates(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// The URL that frontend can load
-
-	c.JSON(http.StatusOK, gin.H{
-		"url": "/" + fileURL,
-	})
+	auditTarget(c, entry.ID, entry.RecipientID)
+	c.JSON(http.StatusOK, entry)
 }
+
+// GenerateUniqueFilename returns a random file name with the given extension
+// that is not yet taken in folder.
 func GenerateUniqueFilename(folder, ext string) (string, error) {
 	for i := 0; i < 10; i++ { // try up to 10 times
 		b := make([]byte, 8) // 8 bytes → 16 hex chars
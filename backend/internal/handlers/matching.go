@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"hack4good/internal/models"
+)
+
+// Match ranks recipients a caregiver is not yet linked to, or waiting on, by
+// how well the caregiver's profile fits the recipient's condition and needs.
+func (h RecipientHandler) Match(c *gin.Context) {
+	caregiverID64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid caregiver id"})
+		return
+	}
+
+	caregiver, ok := callerCaregiver(c, h.DB)
+	if !ok {
+		return
+	}
+	if caregiver.ID != uint(caregiverID64) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caregivers can only view their own matches"})
+		return
+	}
+
+	q := h.DB.
+		Preload("User").
+		Where("recipients.discoverable = ?", true).
+		Where("recipients.id NOT IN (?)", h.DB.Model(&models.CaregiverRecipient{}).
+			Select("recipient_id").
+			Where("caregiver_id = ?", caregiver.ID)).
+		Where("recipients.id NOT IN (?)", h.DB.Model(&models.CareRequest{}).
+			Select("recipient_id").
+			Where("caregiver_id = ? AND status = ?", caregiver.ID, models.CareRequestPending))
+
+	// Age filters only consider recipients whose age is public, so they can't
+	// be used to narrow down a private one
+	if c.Query("minAge") != "" || c.Query("maxAge") != "" {
+		q = q.Where("recipients.public_fields @> ?", `["age"]`)
+	}
+	if s := c.Query("minAge"); s != "" {
+		minAge, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid minAge"})
+			return
+		}
+		q = q.Where("recipients.age >= ?", minAge)
+	}
+	if s := c.Query("maxAge"); s != "" {
+		maxAge, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid maxAge"})
+			return
+		}
+		q = q.Where("recipients.age <= ?", maxAge)
+	}
+
+	// condition=dementia,diabetes matches recipients mentioning any keyword,
+	// as long as they have made their condition public. Conditions are
+	// encrypted at rest, so the keywords are matched after loading.
+	var keywords []string
+	for _, kw := range strings.Split(c.Query("condition"), ",") {
+		if kw = strings.ToLower(strings.TrimSpace(kw)); kw != "" {
+			keywords = append(keywords, kw)
+		}
+	}
+	if len(keywords) > 0 {
+		q = q.Where("recipients.public_fields @> ?", `["condition"]`)
+	}
+
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+	}
+
+	var recipients []models.Recipient
+	if err := q.Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	matches := make([]models.RecipientMatch, 0, len(recipients))
+	for _, recipient := range recipients {
+		if len(keywords) > 0 && !mentionsAny(recipient.Condition, keywords) {
+			continue
+		}
+		// Only rank on what the recipient has made public
+		redactRecipient(&recipient)
+		score, reasons := scoreMatch(caregiver, recipient)
+		matches = append(matches, models.RecipientMatch{
+			Recipient: recipient,
+			Score:     score,
+			Reasons:   reasons,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Recipient.ID > matches[j].Recipient.ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
+
+// mentionsAny reports whether text contains any of the lowercase keywords.
+func mentionsAny(text *string, keywords []string) bool {
+	if text == nil {
+		return false
+	}
+	lower := strings.ToLower(*text)
+	for _, kw := range keywords {
+		if strings.Contains(lower, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	scoreSkill        = 3 // per skill or certification relevant to condition/needs
+	scoreLanguage     = 2 // per shared language
+	scoreHourOverlap  = 1 // per overlapping hour of availability, capped
+	maxOverlapHours   = 5
+	scoreExperience   = 1 // per 5 years of experience, capped
+	maxExperienceBand = 2
+)
+
+// scoreMatch returns how well a caregiver suits a recipient along with
+// human-readable reasons for each contribution.
+func scoreMatch(caregiver models.Caregiver, recipient models.Recipient) (int, []string) {
+	score := 0
+	reasons := []string{}
+
+	needTerms := map[string]bool{}
+	if recipient.Condition != nil {
+		addTerms(needTerms, *recipient.Condition)
+	}
+	for _, need := range recipient.Needs {
+		addTerms(needTerms, need)
+	}
+
+	for _, skill := range append(append([]string{}, caregiver.Skills...), caregiver.Certifications...) {
+		terms := map[string]bool{}
+		addTerms(terms, skill)
+		for term := range terms {
+			if needTerms[term] {
+				score += scoreSkill
+				reasons = append(reasons, fmt.Sprintf("%q relates to the recipient's condition or needs", skill))
+				break
+			}
+		}
+	}
+
+	spoken := map[string]bool{}
+	for _, lang := range caregiver.Languages {
+		spoken[strings.ToLower(strings.TrimSpace(lang))] = true
+	}
+	for _, lang := range recipient.Languages {
+		if spoken[strings.ToLower(strings.TrimSpace(lang))] {
+			score += scoreLanguage
+			reasons = append(reasons, fmt.Sprintf("speaks %s", lang))
+		}
+	}
+
+	if minutes := availabilityOverlap(caregiver.Availability, recipient.Availability); minutes > 0 {
+		hours := min(minutes/60, maxOverlapHours)
+		score += hours * scoreHourOverlap
+		reasons = append(reasons, fmt.Sprintf("available for %.1f hours of the requested weekly care time", float64(minutes)/60))
+	}
+
+	if caregiver.YearsOfExperience != nil && *caregiver.YearsOfExperience >= 5 {
+		score += min(*caregiver.YearsOfExperience/5, maxExperienceBand) * scoreExperience
+		reasons = append(reasons, fmt.Sprintf("%d years of experience", *caregiver.YearsOfExperience))
+	}
+
+	return score, reasons
+}
+
+var stopWords = map[string]bool{
+	"and": true, "the": true, "for": true, "with": true, "care": true,
+}
+
+// addTerms adds the lowercased words of s, ignoring short and filler words.
+func addTerms(terms map[string]bool, s string) {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if len(w) >= 3 && !stopWords[w] {
+			terms[w] = true
+		}
+	}
+}
+
+// availabilityOverlap returns the total weekly minutes during which both
+// schedules are available.
+func availabilityOverlap(a, b []models.AvailabilitySlot) int {
+	total := 0
+	for _, x := range a {
+		for _, y := range b {
+			if x.Day != y.Day {
+				continue
+			}
+			start := max(clockMinutes(x.Start), clockMinutes(y.Start))
+			end := min(clockMinutes(x.End), clockMinutes(y.End))
+			if end > start {
+				total += end - start
+			}
+		}
+	}
+	return total
+}
+
+func clockMinutes(hhmm string) int {
+	var h, m int
+	fmt.Sscanf(hhmm, "%d:%d", &h, &m)
+	return h*60 + m
+}
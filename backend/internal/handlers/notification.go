@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+type NotificationHandler struct {
+	DB *gorm.DB
+}
+
+// List returns the caller's notifications, newest first. unread=true leaves
+// out ones already read.
+func (h NotificationHandler) List(c *gin.Context) {
+	q := h.DB.Where("user_id = ?", auth.UserID(c)).Order("created_at DESC").Limit(100)
+	if unread, _ := strconv.ParseBool(c.Query("unread")); unread {
+		q = q.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := q.Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+func (h NotificationHandler) MarkRead(c *gin.Context) {
+	res := h.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", c.Param("id"), auth.UserID(c)).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h NotificationHandler) MarkAllRead(c *gin.Context) {
+	if err := h.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", auth.UserID(c)).
+		Update("read_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
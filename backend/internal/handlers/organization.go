@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+type OrganizationHandler struct {
+	DB *gorm.DB
+}
+
+// orgMember resolves the organization in the path and checks that the caller
+// belongs to it with one of the roles. Non-members get a 404 so organizations
+// can't be probed.
+func (h OrganizationHandler) orgMember(c *gin.Context, roles ...models.OrgRole) (models.OrganizationMember, bool) {
+	var member models.OrganizationMember
+	if err := h.DB.First(&member, "organization_id = ? AND user_id = ? AND NOT pending", c.Param("id"), auth.UserID(c)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+			return member, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return member, false
+	}
+
+	if !slices.Contains(roles, member.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient organization role"})
+		return member, false
+	}
+	return member, true
+}
+
+// orgCaregivers selects the IDs of caregivers who are members of the organization.
+func (h OrganizationHandler) orgCaregivers(orgID uint) *gorm.DB {
+	return h.DB.Model(&models.Caregiver{}).
+		Select("caregivers.id").
+		Joins("JOIN organization_members om ON om.user_id = caregivers.user_id").
+		Where("om.organization_id = ? AND om.role = ? AND NOT om.pending", orgID, models.OrgRoleCaregiver)
+}
+
+// sharedRecipients selects the IDs of recipients who let organizations see them.
+func (h OrganizationHandler) sharedRecipients() *gorm.DB {
+	return h.DB.Model(&models.Recipient{}).
+		Select("recipients.id").
+		Where("recipients.share_with_organizations")
+}
+
+type createOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// Create starts a new organization with the caller as its first admin.
+func (h OrganizationHandler) Create(c *gin.Context) {
+	var req createOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.OrganizationMember{}).Where("user_id = ?", auth.UserID(c)).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user already belongs to an organization"})
+		return
+	}
+
+	org := models.Organization{Name: strings.TrimSpace(req.Name)}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         auth.UserID(c),
+			Role:           models.OrgRoleAdmin,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// Mine returns the caller's organization and role.
+func (h OrganizationHandler) Mine(c *gin.Context) {
+	var member models.OrganizationMember
+	if err := h.DB.Preload("Organization").First(&member, "user_id = ? AND NOT pending", auth.UserID(c)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user does not belong to an organization"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization": member.Organization,
+		"role":         member.Role,
+	})
+}
+
+type updateOrganizationSettingsRequest struct {
+	Name                *string `json:"name,omitempty" binding:"omitempty,min=1"`
+	RequireCaregiver2FA *bool   `json:"requireCaregiver2fa,omitempty"`
+}
+
+// UpdateSettings lets admins rename the organization and require two-factor
+// authentication for its caregivers. Turning the requirement on signs out
+// caregivers without 2FA so their next login goes through enrollment.
+func (h OrganizationHandler) UpdateSettings(c *gin.Context) {
+	admin, ok := h.orgMember(c, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req updateOrganizationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Name != nil {
+		updates["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.RequireCaregiver2FA != nil {
+		updates["require_caregiver_2fa"] = *req.RequireCaregiver2FA
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, admin.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	enforce := req.RequireCaregiver2FA != nil && *req.RequireCaregiver2FA && !org.RequireCaregiver2FA
+	if len(updates) > 0 {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&org).Updates(updates).Error; err != nil {
+				return err
+			}
+			if !enforce {
+				return nil
+			}
+			return tx.Model(&models.User{}).
+				Where("id IN (?)", tx.Model(&models.OrganizationMember{}).
+					Select("user_id").
+					Where("organization_id = ? AND role = ? AND NOT pending", org.ID, models.OrgRoleCaregiver)).
+				Where("id NOT IN (?)", tx.Model(&models.TwoFactor{}).
+					Select("user_id").
+					Where("enabled_at IS NOT NULL")).
+				Update("token_version", gorm.Expr("token_version + 1")).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h OrganizationHandler) ListMembers(c *gin.Context) {
+	member, ok := h.orgMember(c, models.OrgRoleAdmin, models.OrgRoleCoordinator)
+	if !ok {
+		return
+	}
+
+	var members []models.OrganizationMember
+	if err := h.DB.
+		Preload("User").
+		Where("organization_id = ?", member.OrganizationID).
+		Order("id asc").
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+type addMemberRequest struct {
+	Username string         `json:"username" binding:"required"`
+	Role     models.OrgRole `json:"role" binding:"required,oneof=admin coordinator caregiver"`
+}
+
+// AddMember invites a user into the organization. They become a member once
+// they accept.
+func (h OrganizationHandler) AddMember(c *gin.Context) {
+	admin, ok := h.orgMember(c, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req addMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "username = ?", strings.ToLower(strings.TrimSpace(req.Username))).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == models.OrgRoleCaregiver && user.Role != models.RoleCaregiver {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only caregiver accounts can join as caregivers"})
+		return
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.OrganizationMember{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user already belongs to or is invited to an organization"})
+		return
+	}
+
+	member := models.OrganizationMember{
+		OrganizationID: admin.OrganizationID,
+		UserID:         user.ID,
+		Role:           req.Role,
+		Pending:        true,
+	}
+	if err := h.DB.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("User").First(&member, member.ID)
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// Invitations lists the organizations waiting for the caller to accept.
+func (h OrganizationHandler) Invitations(c *gin.Context) {
+	var invites []models.OrganizationMember
+	if err := h.DB.
+		Preload("Organization").
+		Where("user_id = ? AND pending", auth.UserID(c)).
+		Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := make([]gin.H, 0, len(invites))
+	for _, invite := range invites {
+		res = append(res, gin.H{"organization": invite.Organization, "role": invite.Role})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// AcceptInvitation makes the caller a member of the organization that invited them.
+func (h OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	res := h.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ? AND pending", c.Param("id"), auth.UserID(c)).
+		Update("pending", false)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	h.Mine(c)
+}
+
+// DeclineInvitation drops an invitation the caller doesn't want.
+func (h OrganizationHandler) DeclineInvitation(c *gin.Context) {
+	res := h.DB.Delete(&models.OrganizationMember{}, "organization_id = ? AND user_id = ? AND pending", c.Param("id"), auth.UserID(c))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type updateMemberRequest struct {
+	Role models.OrgRole `json:"role" binding:"required,oneof=admin coordinator caregiver"`
+}
+
+func (h OrganizationHandler) UpdateMember(c *gin.Context) {
+	admin, ok := h.orgMember(c, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req updateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, ok := h.loadMember(c, admin.OrganizationID)
+	if !ok {
+		return
+	}
+	if req.Role == models.OrgRoleCaregiver && member.User.Role != models.RoleCaregiver {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only caregiver accounts can join as caregivers"})
+		return
+	}
+	if member.Role == models.OrgRoleAdmin && req.Role != models.OrgRoleAdmin && !h.hasOtherAdmin(c, member) {
+		return
+	}
+
+	member.Role = req.Role
+	if err := h.DB.Save(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h OrganizationHandler) RemoveMember(c *gin.Context) {
+	admin, ok := h.orgMember(c, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	member, ok := h.loadMember(c, admin.OrganizationID)
+	if !ok {
+		return
+	}
+	if member.Role == models.OrgRoleAdmin && !h.hasOtherAdmin(c, member) {
+		return
+	}
+
+	if err := h.DB.Delete(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h OrganizationHandler) loadMember(c *gin.Context, orgID uint) (models.OrganizationMember, bool) {
+	var member models.OrganizationMember
+	if err := h.DB.Preload("User").First(&member, "organization_id = ? AND user_id = ?", orgID, c.Param("userId")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+			return member, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return member, false
+	}
+	return member, true
+}
+
+// hasOtherAdmin keeps every organization with at least one admin.
+func (h OrganizationHandler) hasOtherAdmin(c *gin.Context, member models.OrganizationMember) bool {
+	var count int64
+	if err := h.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND NOT pending AND id <> ?", member.OrganizationID, models.OrgRoleAdmin, member.ID).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "an organization needs at least one admin"})
+		return false
+	}
+	return true
+}
+
+func (h OrganizationHandler) ListCaregivers(c *gin.Context) {
+	member, ok := h.orgMember(c, models.OrgRoleAdmin, models.OrgRoleCoordinator)
+	if !ok {
+		return
+	}
+
+	var caregivers []models.Caregiver
+	if err := h.DB.
+		Preload("User").
+		Where("id IN (?)", h.orgCaregivers(member.OrganizationID)).
+		Order("id asc").
+		Find(&caregivers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, caregivers)
+}
+
+// ListRecipients returns recipients linked to at least one of the
+// organization's caregivers who agreed to be seen by their organizations.
+func (h OrganizationHandler) ListRecipients(c *gin.Context) {
+	member, ok := h.orgMember(c, models.OrgRoleAdmin, models.OrgRoleCoordinator)
+	if !ok {
+		return
+	}
+
+	var recipients []models.Recipient
+	if err := h.DB.
+		Preload("User").
+		Where("id IN (?)", h.DB.Model(&models.CaregiverRecipient{}).
+			Select("recipient_id").
+			Where("caregiver_id IN (?)", h.orgCaregivers(member.OrganizationID))).
+		Where("share_with_organizations").
+		Order("id asc").
+		Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range recipients {
+		recipients[i].InviteCode = nil
+	}
+
+	auditRecipients(c, recipientIDs(recipients)...)
+	c.JSON(http.StatusOK, recipients)
+}
+
+// ListTodos returns todos owned by the organization's caregivers for
+// recipients who share with organizations. Supports caregiverId, recipientId,
+// completed and overdue=true filters.
+func (h OrganizationHandler) ListTodos(c *gin.Context) {
+	member, ok := h.orgMember(c, models.OrgRoleAdmin, models.OrgRoleCoordinator)
+	if !ok {
+		return
+	}
+
+	q := h.DB.Model(&models.Todo{}).
+		Where("caregiver_id IN (?)", h.orgCaregivers(member.OrganizationID)).
+		Where("recipient_id IN (?)", h.sharedRecipients()).
+		Order("due_date asc")
+
+	if caregiverID := c.Query("caregiverId"); caregiverID != "" {
+		q = q.Where("caregiver_id = ?", caregiverID)
+	}
+	if recipientID := c.Query("recipientId"); recipientID != "" {
+		q = q.Where("recipient_id = ?", recipientID)
+	}
+	if completed := c.Query("completed"); completed != "" {
+		q = q.Where("completed = ?", completed)
+	}
+	if overdue, _ := strconv.ParseBool(c.Query("overdue")); overdue {
+		q = q.Where("completed = ? AND due_date < ?", false, time.Now())
+	}
+
+	var todos []models.Todo
+	if err := q.Find(&todos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	auditRecipients(c, todoRecipients(todos)...)
+	c.JSON(http.StatusOK, todos)
+}
+
+// Dashboard shows coordinators each caregiver's caseload and every overdue
+// todo, counting only recipients who share with organizations.
+func (h OrganizationHandler) Dashboard(c *gin.Context) {
+	member, ok := h.orgMember(c, models.OrgRoleAdmin, models.OrgRoleCoordinator)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	dashboard := models.CoordinatorDashboard{
+		OrganizationID: member.OrganizationID,
+		Caseloads:      []models.CaregiverCaseload{},
+		OverdueTodos:   []models.Todo{},
+	}
+
+	if err := h.DB.
+		Table("caregivers").
+		Select(`
+			caregivers.id AS caregiver_id,
+			users.id AS user_id,
+			users.name AS name,
+			(SELECT COUNT(*) FROM caregiver_recipients cr WHERE cr.caregiver_id = caregivers.id AND cr.recipient_id IN (?)) AS recipients,
+			(SELECT COUNT(*) FROM todos t WHERE t.caregiver_id = caregivers.id AND t.recipient_id IN (?) AND NOT t.completed) AS open_todos,
+			(SELECT COUNT(*) FROM todos t WHERE t.caregiver_id = caregivers.id AND t.recipient_id IN (?) AND NOT t.completed AND t.due_date < ?) AS overdue_todos
+		`, h.sharedRecipients(), h.sharedRecipients(), h.sharedRecipients(), now).
+		Joins("JOIN users ON users.id = caregivers.user_id").
+		Where("caregivers.id IN (?)", h.orgCaregivers(member.OrganizationID)).
+		Order("overdue_todos DESC, open_todos DESC, caregivers.id ASC").
+		Scan(&dashboard.Caseloads).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.
+		Where("caregiver_id IN (?)", h.orgCaregivers(member.OrganizationID)).
+		Where("recipient_id IN (?)", h.sharedRecipients()).
+		Where("completed = ? AND due_date < ?", false, now).
+		Order("due_date asc").
+		Find(&dashboard.OverdueTodos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	auditRecipients(c, todoRecipients(dashboard.OverdueTodos)...)
+	c.JSON(http.StatusOK, dashboard)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/jobs"
+	"hack4good/internal/loginguard"
+	"hack4good/internal/mailer"
+	"hack4good/internal/models"
+)
+
+const passwordResetTTL = time.Hour
+
+var errResetTokenInvalid = errors.New("reset link is invalid or has expired")
+
+// setPassword stores a new password and bumps the token version so every
+// session issued before the change stops working.
+func setPassword(tx *gorm.DB, userID uint, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"password_hash":       string(hash),
+		"must_reset_password": false,
+		"token_version":       gorm.Expr("token_version + 1"),
+	}).Error
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ChangePassword replaces the caller's password. Other sessions are signed
+// out; the caller gets a fresh token so they stay logged in.
+func (h AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	if err := h.DB.First(&u, auth.UserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must be different"})
+		return
+	}
+
+	if err := setPassword(h.DB, u.ID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := auth.SignToken(u.ID, string(u.Role), u.TokenVersion+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+type updateEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// UpdateEmail sets the address password reset links are sent to.
+func (h AuthHandler) UpdateEmail(c *gin.Context) {
+	var req updateEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	if err := h.DB.First(&u, auth.UserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if err := h.DB.Model(&u).Update("email", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.First(&u, u.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+type requestPasswordResetRequest struct {
+	// Username or email
+	Login string `json:"login" binding:"required"`
+}
+
+// PasswordResetJobKind emails a reset link; see SendPasswordReset.
+const PasswordResetJobKind = "password_reset.send"
+
+type PasswordResetPayload struct {
+	Login string `json:"login"` // username or email
+}
+
+// Resetting more often than this per account is ignored by the job
+const maxResetsPerHour = 3
+
+// RequestPasswordReset queues a reset link. It answers 202 whether or not the
+// account exists, and takes the same path either way, so it can't be used to
+// discover usernames. Requests are limited per login and per IP.
+func (h AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req requestPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	login := strings.ToLower(strings.TrimSpace(req.Login))
+	limits := []struct {
+		key    string
+		policy loginguard.Policy
+	}{
+		{"reset:login:" + login, loginguard.ResetLoginPolicy},
+		{"reset:ip:" + c.ClientIP(), loginguard.ResetIPPolicy},
+	}
+	for _, limit := range limits {
+		wait, err := h.Limiter.Throttle(c.Request.Context(), limit.key, limit.policy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	if _, err := jobs.Enqueue(h.DB, PasswordResetJobKind, PasswordResetPayload{Login: login}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists and has an email address, a reset link has been sent"})
+}
+
+// SendPasswordReset issues a reset token for the account matching login and
+// emails the link. Unknown, inactive and email-less accounts are skipped.
+func SendPasswordReset(ctx context.Context, db *gorm.DB, m mailer.Mailer, login string) error {
+	var u models.User
+	if err := db.First(&u, "username = ? OR email = ?", login, login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !u.Active || u.Email == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var recent int64
+	if err := db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", u.ID, now.Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent >= maxResetsPerHour {
+		log.Printf("password reset for user %d skipped: too many requests", u.ID)
+		return nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the newest link works
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", u.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    u.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: now.Add(passwordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      *u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password for your account %q. Open this link within the next hour to choose a new one:\n\n%s\n\nIf this wasn't you, you can ignore this email.\n",
+			u.Name, u.Username, appURL("/reset-password", token),
+		),
+	})
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ResetPassword completes a reset. The token is consumed and every existing
+// session of the user is revoked.
+func (h AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&reset, "token_hash = ?", hashToken(req.Token)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errResetTokenInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+			return errResetTokenInvalid
+		}
+
+		if err := tx.Model(&reset).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return setPassword(tx, reset.UserID, req.NewPassword)
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password updated, please log in again"})
+}
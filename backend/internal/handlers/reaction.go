@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+type ReactionHandler struct {
+	DB *gorm.DB
+}
+
+type createReactionRequest struct {
+	JournalEntryID *uint  `json:"journalEntryId"`
+	CommentID      *uint  `json:"commentId"`
+	Emoji          string `json:"emoji" binding:"required,max=32"`
+}
+
+// Create adds the caller's reaction to an entry or comment they can see.
+func (h ReactionHandler) Create(c *gin.Context) {
+	userID := auth.UserID(c)
+
+	var req createReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.JournalEntryID == nil) == (req.CommentID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of journalEntryId or commentId is required"})
+		return
+	}
+
+	// Resolve the journal entry the reaction ultimately belongs to
+	entryID := req.JournalEntryID
+	if req.CommentID != nil {
+		var comment models.Comment
+		if err := h.DB.First(&comment, "id = ?", *req.CommentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		entryID = &comment.JournalEntryID
+	}
+
+	entry, ok := visibleEntry(c, h.DB, *entryID, http.StatusBadRequest)
+	if !ok {
+		return
+	}
+	if !requireCommenter(c, h.DB, entry.RecipientID) {
+		return
+	}
+
+	reaction := models.Reaction{
+		UserID:         userID,
+		JournalEntryID: req.JournalEntryID,
+		CommentID:      req.CommentID,
+		Emoji:          req.Emoji,
+	}
+
+	// Block duplicate reactions from the same user
+	var existing models.Reaction
+	err := h.DB.Where(&reaction, "UserID", "JournalEntryID", "CommentID", "Emoji").First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "reaction already exists"})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&reaction).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reaction)
+}
+
+// Delete removes one of the caller's own reactions.
+func (h ReactionHandler) Delete(c *gin.Context) {
+	id := c.Param("id")
+
+	res := h.DB.Delete(&models.Reaction{}, "id = ? AND user_id = ?", id, auth.UserID(c))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reaction not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h ReactionHandler) ListForEntry(c *gin.Context) {
+	h.listFor(c, "journal_entry_id")
+}
+
+func (h ReactionHandler) ListForComment(c *gin.Context) {
+	h.listFor(c, "comment_id")
+}
+
+func (h ReactionHandler) listFor(c *gin.Context, column string) {
+	var id uint
+	if _, err := fmt.Sscan(c.Param("id"), &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	entryID := id
+	if column == "comment_id" {
+		var comment models.Comment
+		if err := h.DB.First(&comment, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		entryID = comment.JournalEntryID
+	}
+	if _, ok := visibleEntry(c, h.DB, entryID, http.StatusNotFound); !ok {
+		return
+	}
+
+	summaries, err := summarizeReactions(h.DB, column, []uint{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := summaries[id]
+	if res == nil {
+		res = []models.ReactionSummary{}
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// summarizeReactions groups reactions on the given targets by emoji, keyed by
+// target ID. column is either journal_entry_id or comment_id.
+func summarizeReactions(db *gorm.DB, column string, ids []uint) (map[uint][]models.ReactionSummary, error) {
+	type row struct {
+		TargetID uint
+		Emoji    string
+		UserID   uint
+		UserName string
+	}
+
+	var rows []row
+	if err := db.
+		Table("reactions").
+		Select("reactions."+column+" AS target_id, reactions.emoji, users.id AS user_id, users.name AS user_name").
+		Joins("JOIN users ON users.id = reactions.user_id").
+		Where("reactions."+column+" IN ?", ids).
+		Order("reactions.created_at ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	res := make(map[uint][]models.ReactionSummary)
+	for _, r := range rows {
+		summaries := res[r.TargetID]
+		idx := -1
+		for i := range summaries {
+			if summaries[i].Emoji == r.Emoji {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			summaries = append(summaries, models.ReactionSummary{Emoji: r.Emoji})
+			idx = len(summaries) - 1
+		}
+		summaries[idx].Count++
+		summaries[idx].Users = append(summaries[idx].Users, models.ReactionUser{ID: r.UserID, Name: r.UserName})
+		res[r.TargetID] = summaries
+	}
+	return res, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"hack4good/internal/loginguard"
 	"hack4good/internal/models"
 	"net/http"
 	"strconv"
@@ -10,18 +11,33 @@ import (
 )
 
 type RecipientHandler struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Limiter *loginguard.Limiter
 }
 
 func (h RecipientHandler) List(c *gin.Context) {
-	caregiverIDStr := c.Query("caregiverId")
+	viewer, err := resolveViewer(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	var recipients []models.Recipient
+	if err := h.DB.
+		Preload("User").
+		Scopes(viewer.scope).
+		Order("id desc").
+		Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range recipients {
+		viewer.present(&recipients[i])
+	}
+	auditRecipients(c, recipientIDs(recipients)...)
+
+	caregiverIDStr := c.Query("caregiverId")
 	if caregiverIDStr == "" {
-		var recipients []models.Recipient
-		if err := h.DB.Preload("User").Order("id desc").Find(&recipients).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
 		c.JSON(http.StatusOK, recipients)
 		return
 	}
@@ -33,69 +49,23 @@ func (h RecipientHandler) List(c *gin.Context) {
 	}
 	caregiverID := uint(caregiverID64)
 
-	type row struct {
-		RecipientID uint
-
-		UserID   uint
-		Username string
-		Name     string
-
-		Age       *int
-		Condition *string
-		Likes     *string
-		Dislikes  *string
-		Phobias   *string
-		PetPeeves *string
-
-		RequestID     *uint
-		RequestStatus *string
-	}
-
-	var rows []row
-	q := h.DB.Table("recipients r").
-		Select(`
-			r.id as recipient_id,
-			u.id as user_id,
-			u.username as username,
-			u.name as name,
-			r.age as age,
-			r.condition as condition,
-			r.likes as likes,
-			r.dislikes as dislikes,
-			r.phobias as phobias,
-			r.pet_peeves as pet_peeves,
-			cr.id as request_id,
-			cr.status as request_status
-		`).
-		Joins("JOIN users u ON u.id = r.user_id").
-		Joins("LEFT JOIN care_requests cr ON cr.recipient_id = r.id AND cr.caregiver_id = ?", caregiverID).
-		Order("r.id desc")
-
-	if err := q.Scan(&rows).Error; err != nil {
+	// Attach this caregiver's request, if any, to each recipient
+	var requests []models.CareRequest
+	if err := h.DB.Where("caregiver_id = ?", caregiverID).Find(&requests).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	byRecipient := make(map[uint]models.CareRequest, len(requests))
+	for _, req := range requests {
+		byRecipient[req.RecipientID] = req
+	}
 
-	res := make([]models.RecipientWithRequest, 0, len(rows))
-	for _, row := range rows {
-		recipientWithRequest := models.RecipientWithRequest{
-			Recipient: models.Recipient{
-				ID:     row.RecipientID,
-				UserID: row.UserID,
-				User: models.User{
-					ID:       row.UserID,
-					Username: row.Username,
-					Name:     row.Name,
-				},
-				Age:       row.Age,
-				Condition: row.Condition,
-				Likes:     row.Likes,
-				Dislikes:  row.Dislikes,
-				Phobias:   row.Phobias,
-				PetPeeves: row.PetPeeves,
-			},
-			RequestID:     row.RequestID,
-			RequestStatus: (*models.CareRequestStatus)(row.RequestStatus),
+	res := make([]models.RecipientWithRequest, 0, len(recipients))
+	for _, recipient := range recipients {
+		recipientWithRequest := models.RecipientWithRequest{Recipient: recipient}
+		if req, ok := byRecipient[recipient.ID]; ok {
+			recipientWithRequest.RequestID = &req.ID
+			recipientWithRequest.RequestStatus = &req.Status
 		}
 		res = append(res, recipientWithRequest)
 	}
@@ -110,13 +80,21 @@ func (h RecipientHandler) ListByCaregiver(c *gin.Context) {
 		return
 	}
 
+	viewer, err := resolveViewer(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var recipients []models.Recipient
 
 	err = h.DB.
 		Preload("User").
 		Table("recipients").
+		Select("recipients.*").
 		Joins("JOIN caregiver_recipients cr ON cr.recipient_id = recipients.id").
 		Where("cr.caregiver_id = ?", uint(caregiverID)).
+		Scopes(viewer.scope).
 		Order("recipients.id asc").
 		Find(&recipients).Error
 
@@ -124,38 +102,85 @@ func (h RecipientHandler) ListByCaregiver(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range recipients {
+		viewer.present(&recipients[i])
+	}
 
+	auditRecipients(c, recipientIDs(recipients)...)
 	c.JSON(http.StatusOK, recipients)
 }
 
 func (h RecipientHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
 
-	var recipient models.RecipientReturned
+	recipient, ok := h.findVisible(c, "recipients.id = ?", id)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, recipientReturned(recipient))
+}
+
+// recipientReturned is the profile as shown to a viewer; present the
+// recipient to the viewer first.
+func recipientReturned(recipient models.Recipient) models.RecipientReturned {
+	return models.RecipientReturned{
+		ID:     recipient.ID,
+		UserID: recipient.UserID,
+		Name:   recipient.User.Name,
+
+		Age:       recipient.Age,
+		Condition: recipient.Condition,
+		Likes:     recipient.Likes,
+		Dislikes:  recipient.Dislikes,
+		Phobias:   recipient.Phobias,
+		PetPeeves: recipient.PetPeeves,
+
+		Needs:        recipient.Needs,
+		Languages:    recipient.Languages,
+		Availability: recipient.Availability,
+
+		Discoverable: recipient.Discoverable,
+		PublicFields: recipient.PublicFields,
+
+		ShareEditHistory:         recipient.ShareEditHistory,
+		DefaultJournalVisibility: recipient.DefaultJournalVisibility,
+		ShareWithOrganizations:   recipient.ShareWithOrganizations,
+	}
+}
+
+// findVisible loads one recipient the caller may find and strips the fields
+// they may not see. Hidden recipients are reported as not found.
+func (h RecipientHandler) findVisible(c *gin.Context, query string, args ...any) (models.Recipient, bool) {
+	var recipient models.Recipient
+
+	viewer, err := resolveViewer(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return recipient, false
+	}
+
 	if err := h.DB.
-		Table("recipients").
-		Select(`
-			recipients.id,
-			recipients.user_id,
-			users.name,
-			recipients.age,
-			recipients.condition,
-			recipients.likes,
-			recipients.dislikes,
-			recipients.phobias,
-			recipients.pet_peeves
-		`).
-		Joins("JOIN users ON users.id = recipients.user_id").
-		Where("recipients.id = ?", id).
-		Scan(&recipient).Error; err != nil {
+		Preload("User").
+		Scopes(viewer.scope).
+		Where(query, args...).
+		First(&recipient).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
-		return
+		return recipient, false
 	}
 
-	c.JSON(http.StatusOK, recipient)
+	viewer.present(&recipient)
+	return recipient, true
 }
 
+// Update edits a recipient's profile. The recipient, a guardian allowed to
+// edit it and a caregiver granted edit_profile may change the care profile;
+// privacy settings are left to the recipient and their guardians.
 func (h RecipientHandler) Update(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	id := c.Param("id")
 
 	var recipient models.Recipient
@@ -169,8 +194,43 @@ func (h RecipientHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateAvailability(req.Availability); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	guardian, err := guardianLink(h.DB, userID, recipient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case recipient.UserID == userID:
+		guardian = nil
+	case guardian != nil:
+		if !guardianPermits(*guardian, models.GuardianEditProfile) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "recipient has not granted this permission"})
+			return
+		}
+	default:
+		caregiver, ok := linkedCaregiver(c, h.DB, recipient.ID)
+		if !ok || !requireScope(c, h.DB, caregiver.ID, recipient.ID, models.ScopeEditProfile) {
+			return
+		}
+	}
+	// Guardians and caregivers may edit the profile but not who gets to see it
+	if recipient.UserID != userID && changesPrivacy(req) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient can change privacy settings"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if guardian != nil {
+			if err := recordOnBehalf(tx, c, guardian, "recipient.update", "recipient", recipient.ID); err != nil {
+				return err
+			}
+		}
 
-	err := h.DB.Transaction(func(tx *gorm.DB) error {
 		// Update recipient fields
 		if req.Age != nil {
 			recipient.Age = req.Age
@@ -190,6 +250,30 @@ func (h RecipientHandler) Update(c *gin.Context) {
 		if req.PetPeeves != nil {
 			recipient.PetPeeves = req.PetPeeves
 		}
+		if req.Needs != nil {
+			recipient.Needs = req.Needs
+		}
+		if req.Languages != nil {
+			recipient.Languages = req.Languages
+		}
+		if req.Availability != nil {
+			recipient.Availability = req.Availability
+		}
+		if req.Discoverable != nil {
+			recipient.Discoverable = *req.Discoverable
+		}
+		if req.PublicFields != nil {
+			recipient.PublicFields = req.PublicFields
+		}
+		if req.ShareEditHistory != nil {
+			recipient.ShareEditHistory = *req.ShareEditHistory
+		}
+		if req.DefaultJournalVisibility != nil {
+			recipient.DefaultJournalVisibility = *req.DefaultJournalVisibility
+		}
+		if req.ShareWithOrganizations != nil {
+			recipient.ShareWithOrganizations = *req.ShareWithOrganizations
+		}
 
 		if err := tx.Save(&recipient).Error; err != nil {
 			return err
@@ -213,9 +297,19 @@ func (h RecipientHandler) Update(c *gin.Context) {
 	}
 
 	// Reload with user
-	h.DB.Preload("User").First(&recipient, recipient.ID)
+	if err := h.DB.Preload("User").First(&recipient, recipient.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, recipient)
+	viewer, err := resolveViewer(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	viewer.present(&recipient)
+
+	c.JSON(http.StatusOK, recipientReturned(recipient))
 }
 
 func (h RecipientHandler) GetByUserID(c *gin.Context) {
@@ -226,11 +320,18 @@ func (h RecipientHandler) GetByUserID(c *gin.Context) {
 	}
 	userID := uint(userID64)
 
-	var recipient models.Recipient
-	if err := h.DB.Preload("User").First(&recipient, "user_id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "recipient not found"})
+	recipient, ok := h.findVisible(c, "recipients.user_id = ?", userID)
+	if !ok {
 		return
 	}
 
+	auditTarget(c, recipient.ID, recipient.ID)
 	c.JSON(http.StatusOK, recipient)
 }
+
+// changesPrivacy reports whether req touches any of the recipient's sharing
+// settings.
+func changesPrivacy(req models.RecipientRequest) bool {
+	return req.Discoverable != nil || req.PublicFields != nil || req.ShareEditHistory != nil ||
+		req.DefaultJournalVisibility != nil || req.ShareWithOrganizations != nil
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"hack4good/internal/models"
+)
+
+func TestGuardianCannotChangePrivacy(t *testing.T) {
+	tables := fakeTables{
+		"recipients":          {{"id": int64(2), "user_id": int64(5)}},
+		"guardian_recipients": {{"id": int64(1), "guardian_id": int64(1), "recipient_id": int64(2), "can_edit_profile": true}},
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"discoverable", `{"discoverable":true}`},
+		{"public fields", `{"publicFields":["condition"]}`},
+		{"share with organizations", `{"shareWithOrganizations":true}`},
+		{"share edit history", `{"shareEditHistory":true}`},
+		{"default journal visibility", `{"defaultJournalVisibility":"caregivers"}`},
+		{"alongside a profile edit", `{"likes":"gardening","discoverable":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(9, models.RoleGuardian)
+			c.Request = httptest.NewRequest(http.MethodPut, "/recipients/2", strings.NewReader(tt.body))
+			c.Params = gin.Params{{Key: "id", Value: "2"}}
+			RecipientHandler{DB: fakeDB(t, tables)}.Update(c)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403 (%s)", w.Code, w.Body)
+			}
+		})
+	}
+}
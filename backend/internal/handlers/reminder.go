@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+	"hack4good/internal/reminders"
+)
+
+type ReminderHandler struct {
+	DB *gorm.DB
+}
+
+func (h ReminderHandler) load(userID uint) (models.ReminderSettingsReturned, error) {
+	settings, err := reminders.Settings(h.DB, userID)
+	if err != nil {
+		return models.ReminderSettingsReturned{}, err
+	}
+	result := models.ReminderSettingsReturned{ReminderSettings: settings, Rules: []models.ReminderRule{}}
+
+	if err := h.DB.Where("user_id = ?", userID).Order("minutes_before DESC").Find(&result.Rules).Error; err != nil {
+		return result, err
+	}
+	// Until the user saves their own rules, show the ones that apply
+	if settings.UpdatedAt.IsZero() && len(result.Rules) == 0 {
+		for _, minutes := range models.DefaultReminderMinutes {
+			result.Rules = append(result.Rules, models.ReminderRule{UserID: userID, MinutesBefore: minutes})
+		}
+	}
+	return result, nil
+}
+
+func (h ReminderHandler) GetSettings(c *gin.Context) {
+	result, err := h.load(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type reminderRuleRequest struct {
+	MinutesBefore int                  `json:"minutesBefore" binding:"required,min=1,max=10080"`
+	Priority      *models.TodoPriority `json:"priority" binding:"omitempty,oneof=low medium high"`
+}
+
+// reminderSettingsWithSecret includes the webhook secret, which is only shown
+// when it is generated or rotated.
+type reminderSettingsWithSecret struct {
+	models.ReminderSettingsReturned
+	WebhookSecret string `json:"webhookSecret"`
+}
+
+type updateReminderSettingsRequest struct {
+	Channels     []models.ReminderChannel `json:"channels" binding:"dive,oneof=in_app email webhook"`
+	WebhookURL   string                   `json:"webhookUrl"`
+	RotateSecret bool                     `json:"rotateSecret"`
+	Rules        []reminderRuleRequest    `json:"rules" binding:"max=10,dive"`
+}
+
+// UpdateSettings replaces the caller's channels and default reminder rules.
+// An empty rules list turns reminders off for todos without their own.
+func (h ReminderHandler) UpdateSettings(c *gin.Context) {
+	var req updateReminderSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.WebhookURL != "" {
+		if !validWebhookURL(req.WebhookURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "webhookUrl must be an http or https URL"})
+			return
+		}
+	} else if slices.Contains(req.Channels, models.ChannelWebhook) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "webhookUrl is required for the webhook channel"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	settings, err := reminders.Settings(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	settings.Channels = slices.Compact(slices.Sorted(slices.Values(req.Channels)))
+	if settings.Channels == nil {
+		settings.Channels = []models.ReminderChannel{}
+	}
+	settings.WebhookURL = req.WebhookURL
+	newSecret := false
+	if req.WebhookURL == "" {
+		settings.WebhookSecret = ""
+	} else if settings.WebhookSecret == "" || req.RotateSecret {
+		if settings.WebhookSecret, err = newToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		newSecret = true
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&settings).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ReminderRule{}).Error; err != nil {
+			return err
+		}
+		for _, r := range req.Rules {
+			if err := tx.Create(&models.ReminderRule{
+				UserID:        userID,
+				MinutesBefore: r.MinutesBefore,
+				Priority:      r.Priority,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.load(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if newSecret {
+		c.JSON(http.StatusOK, reminderSettingsWithSecret{result, settings.WebhookSecret})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"hack4good/internal/models"
+)
+
+func TestReminderSettingsHideSecret(t *testing.T) {
+	settings := models.ReminderSettingsReturned{ReminderSettings: models.ReminderSettings{
+		UserID:        7,
+		WebhookURL:    "https://example.com/hook",
+		WebhookSecret: "s3cret",
+	}}
+
+	tests := []struct {
+		name  string
+		value any
+		want  bool
+	}{
+		{"settings", settings, false},
+		{"generated or rotated", reminderSettingsWithSecret{settings, settings.WebhookSecret}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(body), "s3cret"); got != tt.want {
+				t.Errorf("secret shown = %v, want %v: %s", got, tt.want, body)
+			}
+		})
+	}
+}
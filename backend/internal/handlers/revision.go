@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/fieldcrypt"
+	"hack4good/internal/models"
+)
+
+var errHistoryHidden = errors.New("recipient has not shared edit history")
+
+// canViewEditHistory reports whether the given user may see past revisions of
+// content belonging to a recipient. The recipient always may; caregivers only
+// when the recipient has chosen to share edit history.
+func canViewEditHistory(db *gorm.DB, recipientID, viewerID uint) error {
+	var recipient models.Recipient
+	if err := db.First(&recipient, "id = ?", recipientID).Error; err != nil {
+		return err
+	}
+
+	if recipient.UserID == viewerID || recipient.ShareEditHistory {
+		return nil
+	}
+	return errHistoryHidden
+}
+
+// revisionsQuery selects revisions from the given table joined with the editor's name.
+func revisionsQuery(db *gorm.DB, table, parentColumn string, parentID uint) *gorm.DB {
+	return fieldcrypt.FromTable(db, table).
+		Table(table).
+		Select(table+".*, users.name AS editor_name").
+		Joins("JOIN users ON users.id = "+table+".editor_id").
+		Where(table+"."+parentColumn+" = ?", parentID).
+		Order(table + ".created_at DESC")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+func effectiveScopes(link models.CaregiverRecipient) []models.CaregiverScope {
+	if link.Scopes == nil {
+		return models.DefaultCaregiverScopes
+	}
+	return link.Scopes
+}
+
+// requireScope writes a 403 and returns false unless the caregiver is linked
+// to the recipient with the given scope.
+func requireScope(c *gin.Context, db *gorm.DB, caregiverID, recipientID uint, scope models.CaregiverScope) bool {
+	var link models.CaregiverRecipient
+	if err := db.First(&link, "caregiver_id = ? AND recipient_id = ?", caregiverID, recipientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "caregiver is not linked to this recipient"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if !slices.Contains(effectiveScopes(link), scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "recipient has not granted the " + string(scope) + " permission"})
+		return false
+	}
+	return true
+}
+
+// requireCallerScope lets the recipient through and otherwise requires the
+// authenticated caller to be a linked caregiver granted the scope.
+func requireCallerScope(c *gin.Context, db *gorm.DB, recipientID uint, scope models.CaregiverScope) bool {
+	if _, ok := requireUser(c); !ok {
+		return false
+	}
+
+	isRecipient, err := isRecipientUser(c, db, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if isRecipient {
+		return true
+	}
+
+	caregiver, ok := callerCaregiver(c, db)
+	if !ok {
+		return false
+	}
+	return requireScope(c, db, caregiver.ID, recipientID, scope)
+}
+
+// managedBy restricts a todos query to the user's own care plan as the
+// recipient and to recipients who granted them manage_todos as a caregiver.
+func managedBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(
+			todos.recipient_id IN (SELECT id FROM recipients WHERE user_id = ?)
+			OR EXISTS (
+				SELECT 1 FROM caregiver_recipients
+				JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id
+				WHERE caregiver_recipients.recipient_id = todos.recipient_id
+				AND caregivers.user_id = ?
+				AND ?
+			)
+		)`, userID, userID, models.ScopeGranted("caregiver_recipients", models.ScopeManageTodos))
+	}
+}
+
+// requireCommenter lets through the recipient, their guardians who may read
+// the journal and linked caregivers granted the comment scope, and writes a
+// 401 or 403 for everyone else.
+func requireCommenter(c *gin.Context, db *gorm.DB, recipientID uint) bool {
+	userID, ok := requireUser(c)
+	if !ok {
+		return false
+	}
+
+	guardian, err := guardianLink(db, userID, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if guardian != nil && guardianPermits(*guardian, models.GuardianViewJournal) {
+		return true
+	}
+	return requireCallerScope(c, db, recipientID, models.ScopeComment)
+}
+
+type updateScopesRequest struct {
+	Scopes []models.CaregiverScope `json:"scopes" binding:"required,dive,oneof=read_journal comment manage_todos edit_profile view_vitals manage_medications manage_devices"`
+}
+
+// UpdateScopes lets the recipient change what a linked caregiver may do.
+func (h CaregiverHandler) UpdateScopes(c *gin.Context) {
+	recipient, ok := ownRecipient(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var req updateScopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var link models.CaregiverRecipient
+	if err := h.DB.First(&link, "caregiver_id = ? AND recipient_id = ?", c.Param("caregiverId"), recipient.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "caregiver not linked"})
+		return
+	}
+
+	link.Scopes = uniqueScopes(req.Scopes)
+	if err := h.DB.Save(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// GetScopes shows a link's effective scopes to either side of it.
+func (h CaregiverHandler) GetScopes(c *gin.Context) {
+	var link models.CaregiverRecipient
+	if err := h.DB.First(&link, "caregiver_id = ? AND recipient_id = ?", c.Param("caregiverId"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "caregiver not linked"})
+		return
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.User{}).
+		Where("id = ?", auth.UserID(c)).
+		Where("id IN (?) OR id IN (?)",
+			h.DB.Model(&models.Recipient{}).Select("user_id").Where("id = ?", link.RecipientID),
+			h.DB.Model(&models.Caregiver{}).Select("user_id").Where("id = ?", link.CaregiverID)).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the recipient or the caregiver can view these permissions"})
+		return
+	}
+
+	link.Scopes = effectiveScopes(link)
+	c.JSON(http.StatusOK, link)
+}
+
+func uniqueScopes(scopes []models.CaregiverScope) []models.CaregiverScope {
+	out := make([]models.CaregiverScope, 0, len(scopes))
+	for _, s := range scopes {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
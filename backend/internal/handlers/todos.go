@@ -3,11 +3,13 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
 )
 
 type TodoHandler struct {
@@ -21,6 +23,9 @@ type createTodoRequest struct {
 	RecipientID uint                `json:"recipientId" binding:"required"`
 	CaregiverID uint                `json:"caregiverId" binding:"required"`
 	Priority    models.TodoPriority `json:"priority" binding:"required,oneof=low medium high"`
+
+	// Minutes before dueDate to remind the caregiver; omit to use their rules
+	ReminderMinutes []int `json:"reminderMinutes" binding:"omitempty,max=5,dive,min=1,max=10080"`
 }
 
 func (h TodoHandler) Create(c *gin.Context) {
@@ -58,6 +63,14 @@ func (h TodoHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if !requireCallerScope(c, h.DB, recipient.ID, models.ScopeManageTodos) {
+		return
+	}
+	// The assignee must be able to manage the recipient's todos too
+	if !requireScope(c, h.DB, caregiver.ID, recipient.ID, models.ScopeManageTodos) {
+		return
+	}
+
 	todo := models.Todo{
 		Title:       req.Title,
 		Description: req.Description,
@@ -66,6 +79,8 @@ func (h TodoHandler) Create(c *gin.Context) {
 		RecipientID: req.RecipientID,
 		CaregiverID: req.CaregiverID,
 		Priority:    req.Priority,
+
+		ReminderMinutes: req.ReminderMinutes,
 	}
 
 	if err := h.DB.Create(&todo).Error; err != nil {
@@ -73,16 +88,22 @@ func (h TodoHandler) Create(c *gin.Context) {
 		return
 	}
 
+	auditTarget(c, todo.ID, todo.RecipientID)
 	c.JSON(http.StatusCreated, todo)
 }
 
+// List returns the todos the caller manages, optionally filtered.
 func (h TodoHandler) List(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
 	recipientID := c.Query("recipientId")
 	caregiverID := c.Query("caregiverId")
 	priority := c.Query("priority")
 	completed := c.Query("completed")
 
-	q := h.DB.Model(&models.Todo{}).Order("due_date asc")
+	q := h.DB.Model(&models.Todo{}).Scopes(managedBy(userID)).Order("due_date asc")
 
 	if recipientID != "" {
 		q = q.Where("recipient_id = ?", recipientID)
@@ -103,6 +124,7 @@ func (h TodoHandler) List(c *gin.Context) {
 		return
 	}
 
+	auditRecipients(c, todoRecipients(todos)...)
 	c.JSON(http.StatusOK, todos)
 }
 
@@ -119,6 +141,10 @@ func (h TodoHandler) GetByID(c *gin.Context) {
 		return
 	}
 
+	if !requireCallerScope(c, h.DB, todo.RecipientID, models.ScopeManageTodos) {
+		return
+	}
+
 	c.JSON(http.StatusOK, todo)
 }
 
@@ -128,6 +154,9 @@ type updateTodoRequest struct {
 	DueDate     *string              `json:"dueDate"` // RFC3339
 	Completed   *bool                `json:"completed"`
 	Priority    *models.TodoPriority `json:"priority" binding:"omitempty,oneof=low medium high"`
+
+	ReminderMinutes  *[]int `json:"reminderMinutes" binding:"omitempty,max=5,dive,min=1,max=10080"`
+	DefaultReminders bool   `json:"defaultReminders"` // go back to the caregiver's rules
 }
 
 func (h TodoHandler) Update(c *gin.Context) {
@@ -149,6 +178,10 @@ func (h TodoHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if !requireCallerScope(c, h.DB, todo.RecipientID, models.ScopeManageTodos) {
+		return
+	}
+
 	if req.Title != nil {
 		todo.Title = *req.Title
 	}
@@ -163,14 +196,36 @@ func (h TodoHandler) Update(c *gin.Context) {
 		}
 		todo.DueDate = due
 	}
+	completed := false
 	if req.Completed != nil {
+		if *req.Completed && !todo.Completed {
+			completed = true
+			now := time.Now()
+			todo.CompletedAt = &now
+		} else if !*req.Completed {
+			todo.CompletedAt = nil
+		}
 		todo.Completed = *req.Completed
 	}
 	if req.Priority != nil {
 		todo.Priority = *req.Priority
 	}
+	if req.ReminderMinutes != nil {
+		todo.ReminderMinutes = *req.ReminderMinutes
+	} else if req.DefaultReminders {
+		todo.ReminderMinutes = nil
+	}
 
-	if err := h.DB.Save(&todo).Error; err != nil {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&todo).Error; err != nil {
+			return err
+		}
+		if !completed {
+			return nil
+		}
+		return webhooks.Publish(tx, models.EventTodoCompleted, todo.ID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -181,6 +236,20 @@ func (h TodoHandler) Update(c *gin.Context) {
 func (h TodoHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
+	var todo models.Todo
+	if err := h.DB.First(&todo, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireCallerScope(c, h.DB, todo.RecipientID, models.ScopeManageTodos) {
+		return
+	}
+
 	res := h.DB.Delete(&models.Todo{}, "id = ?", id)
 	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
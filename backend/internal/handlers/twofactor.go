@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+	"hack4good/internal/totp"
+)
+
+const recoveryCodeCount = 10
+
+var errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Hack4Good"
+}
+
+// requiresTwoFactor reports whether the user's organization makes 2FA
+// mandatory for them.
+func requiresTwoFactor(db *gorm.DB, u models.User) (bool, error) {
+	if u.Role != models.RoleCaregiver {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.OrganizationMember{}).
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id").
+		Where("organization_members.user_id = ? AND NOT organization_members.pending AND organizations.require_caregiver_2fa", u.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// enabledTwoFactor returns the user's TOTP setup, or nil if it isn't enabled.
+func enabledTwoFactor(db *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	var tf models.TwoFactor
+	if err := db.First(&tf, "user_id = ? AND enabled_at IS NOT NULL", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// checkTOTP accepts a code once; reusing a code or an older one fails.
+func checkTOTP(db *gorm.DB, tf *models.TwoFactor, code string) (bool, error) {
+	step, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok || step <= tf.LastUsedStep {
+		return false, nil
+	}
+	res := db.Model(&models.TwoFactor{}).
+		Where("id = ? AND last_used_step < ?", tf.ID, step).
+		Update("last_used_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+func useRecoveryCode(db *gorm.DB, userID uint, code string) (bool, error) {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	res := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", time.Now())
+	return res.RowsAffected == 1, res.Error
+}
+
+// replaceRecoveryCodes issues a fresh set, invalidating any previous ones.
+// The plain codes are only ever returned here.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// challengeSecondFactor answers Login with a challenge token instead of a
+// session when the account has 2FA or is required to set it up. It reports
+// whether it wrote a response.
+func (h AuthHandler) challengeSecondFactor(c *gin.Context, u models.User) bool {
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	purpose := auth.ChallengeTwoFactor
+	if tf == nil {
+		required, err := requiresTwoFactor(h.DB, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return true
+		}
+		if !required {
+			return false
+		}
+		purpose = auth.ChallengeEnroll
+	}
+
+	token, err := auth.SignChallenge(u.ID, u.TokenVersion, purpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign token"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"twoFactorRequired":      purpose == auth.ChallengeTwoFactor,
+		"twoFactorSetupRequired": purpose == auth.ChallengeEnroll,
+		"challengeToken":         token,
+	})
+	return true
+}
+
+// codeFailed counts a wrong code like a wrong password, so codes can't be
+// brute-forced either.
+func (h AuthHandler) codeFailed(c *gin.Context, u models.User, message string) {
+	locked, err := h.Limiter.Locked(c.Request.Context(), u.Username)
+	if err != nil {
+		log.Printf("recording 2fa failure for %q: %v", u.Username, err)
+	}
+	_ = recordAudit(h.DB, c, models.AuditLog{
+		Action:       "auth.2fa_failed",
+		ResourceType: "user",
+		ResourceID:   &u.ID,
+	})
+	if locked {
+		tooManyAttempts(c, h.Limiter.Username.Lockout)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// throttled counts a code attempt up front and answers 429 if the user is
+// currently locked out. Callers report the outcome with codeFailed or
+// codeAccepted.
+func (h AuthHandler) throttled(c *gin.Context, u models.User) bool {
+	wait, err := h.Limiter.Attempt(c.Request.Context(), u.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return true
+	}
+	return false
+}
+
+// codeAccepted clears the attempt counted by throttled.
+func (h AuthHandler) codeAccepted(c *gin.Context, u models.User) {
+	if err := h.Limiter.Success(c.Request.Context(), u.Username, c.ClientIP()); err != nil {
+		log.Printf("clearing login failures for %q: %v", u.Username, err)
+	}
+}
+
+// challengeUser resolves the user behind a challenge token.
+func (h AuthHandler) challengeUser(c *gin.Context, token string, purpose auth.ChallengePurpose) (models.User, bool) {
+	var u models.User
+	claims, err := auth.ParseChallenge(token, purpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "challenge is invalid or has expired, please log in again"})
+		return u, false
+	}
+	if err := h.DB.First(&u, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return u, false
+	}
+	return u, true
+}
+
+func (h AuthHandler) currentUser(c *gin.Context) (models.User, bool) {
+	var u models.User
+	if err := h.DB.First(&u, auth.UserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return u, false
+	}
+	return u, true
+}
+
+// startEnrollment creates (or replaces) a pending TOTP secret.
+func (h AuthHandler) startEnrollment(c *gin.Context, u models.User) {
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tf != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TwoFactor{UserID: u.ID, Secret: secret}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUri": totp.URI(totpIssuer(), u.Username, secret),
+	})
+}
+
+// finishEnrollment enables a pending secret once the first code checks out
+// and returns the recovery codes. Sessions issued before 2FA was on are
+// revoked; u gets the new token version.
+func (h AuthHandler) finishEnrollment(c *gin.Context, u *models.User, code string) ([]string, bool) {
+	if h.throttled(c, *u) {
+		return nil, false
+	}
+
+	var tf models.TwoFactor
+	if err := h.DB.First(&tf, "user_id = ? AND enabled_at IS NULL", u.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start enrollment first"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	ok, err := checkTOTP(h.DB, &tf, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !ok {
+		h.codeFailed(c, *u, "invalid code")
+		return nil, false
+	}
+	h.codeAccepted(c, *u)
+
+	var codes []string
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&tf).Update("enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(u).Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	u.TokenVersion++
+
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "auth.2fa_enabled", ResourceType: "user", ResourceID: &u.ID})
+	return codes, true
+}
+
+func (h AuthHandler) TwoFactorStatus(c *gin.Context) {
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var status models.TwoFactorStatus
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status.Enabled = tf != nil
+	if status.Required, err = requiresTwoFactor(h.DB, u); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var remaining int64
+	if err := h.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", u.ID).
+		Count(&remaining).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status.RecoveryCodesRemaining = int(remaining)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTwoFactor returns a new secret and otpauth URI to add to an
+// authenticator app. It takes effect after VerifyTwoFactor.
+func (h AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	h.startEnrollment(c, u)
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (h AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	codes, ok := h.finishEnrollment(c, &u, req.Code)
+	if !ok {
+		return
+	}
+
+	// Other sessions were signed out; keep this one logged in
+	token, err := auth.SignToken(u.ID, string(u.Role), u.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes, "token": token})
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+func (h AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req disableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	required, err := requiresTwoFactor(h.DB, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "your organization requires two-factor authentication"})
+		return
+	}
+	if h.throttled(c, u) {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
+		h.codeFailed(c, u, "password is incorrect")
+		return
+	}
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tf == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errTwoFactorNotEnabled.Error()})
+		return
+	}
+	if ok, err := checkTOTP(h.DB, tf, req.Code); err != nil || !ok {
+		h.codeFailed(c, u, "invalid code")
+		return
+	}
+	h.codeAccepted(c, u)
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(tf).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", u.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: "auth.2fa_disabled", ResourceType: "user", ResourceID: &u.ID})
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a fresh TOTP check.
+func (h AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.currentUser(c)
+	if !ok || h.throttled(c, u) {
+		return
+	}
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tf == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errTwoFactorNotEnabled.Error()})
+		return
+	}
+	if ok, err := checkTOTP(h.DB, tf, req.Code); err != nil || !ok {
+		h.codeFailed(c, u, "invalid code")
+		return
+	}
+	h.codeAccepted(c, u)
+
+	var codes []string
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recoveryCode" binding:"required_without=Code"`
+}
+
+// LoginTwoFactor completes a login that was answered with twoFactorRequired.
+func (h AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req loginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.challengeUser(c, req.ChallengeToken, auth.ChallengeTwoFactor)
+	if !ok || h.throttled(c, u) {
+		return
+	}
+
+	tf, err := enabledTwoFactor(h.DB, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tf == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errTwoFactorNotEnabled.Error()})
+		return
+	}
+
+	if req.Code != "" {
+		ok, err = checkTOTP(h.DB, tf, req.Code)
+	} else {
+		ok, err = useRecoveryCode(h.DB, u.ID, req.RecoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		h.codeFailed(c, u, "invalid code")
+		return
+	}
+
+	h.codeAccepted(c, u)
+	if req.RecoveryCode != "" {
+		_ = recordAudit(h.DB, c, models.AuditLog{Action: "auth.recovery_code_used", ResourceType: "user", ResourceID: &u.ID})
+	}
+	h.issueSession(c, u, nil)
+}
+
+type challengeRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+}
+
+// LoginEnroll starts TOTP setup for a user whose organization requires 2FA
+// but who hasn't enabled it yet.
+func (h AuthHandler) LoginEnroll(c *gin.Context) {
+	var req challengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.challengeUser(c, req.ChallengeToken, auth.ChallengeEnroll)
+	if !ok {
+		return
+	}
+	h.startEnrollment(c, u)
+}
+
+type loginEnrollVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// LoginEnrollVerify enables TOTP and completes the login in one go.
+func (h AuthHandler) LoginEnrollVerify(c *gin.Context) {
+	var req loginEnrollVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.challengeUser(c, req.ChallengeToken, auth.ChallengeEnroll)
+	if !ok {
+		return
+	}
+	codes, ok := h.finishEnrollment(c, &u, req.Code)
+	if !ok {
+		return
+	}
+
+	h.issueSession(c, u, codes)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+// UploadsDir is where uploaded files live on disk.
+var UploadsDir = "./uploads"
+
+type UploadHandler struct {
+	DB *gorm.DB
+}
+
+// Create stores a file under a random name and records the caller as its
+// uploader.
+func (h UploadHandler) Create(c *gin.Context) {
+	userID := auth.UserID(c)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	name, err := GenerateUniqueFilename(UploadsDir, uploadExt(file.Filename))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate unique filename"})
+		return
+	}
+
+	if err := c.SaveUploadedFile(file, filepath.Join(UploadsDir, name)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error uploading": err.Error()})
+		return
+	}
+
+	upload := models.Upload{Name: name, UserID: userID, OriginalName: filepath.Base(file.Filename)}
+	if err := h.DB.Create(&upload).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": upload.Url(),
+	})
+}
+
+// Get serves an upload to its uploader, to anyone who may read the journal
+// entry it is attached to, and to the participants of a conversation it was
+// sent in.
+func (h UploadHandler) Get(c *gin.Context) {
+	userID := auth.UserID(c)
+
+	var upload models.Upload
+	if err := h.DB.First(&upload, "name = ?", c.Param("name")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if upload.UserID != userID {
+		ok, err := uploadReadable(h.DB, upload, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Same answer as a missing file so names cannot be probed
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.FileAttachment(upload.Path(UploadsDir), upload.OriginalName)
+}
+
+var errUploadNotOwned = errors.New("files must be uploaded by you through /uploads")
+
+// ownUpload resolves a URL the caller wants to attach to the upload it names,
+// which they must have uploaded themselves.
+func ownUpload(db *gorm.DB, url string, userID uint) (models.Upload, error) {
+	upload, err := models.UploadByURL(db, url)
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && upload.UserID != userID {
+		return upload, errUploadNotOwned
+	}
+	return upload, err
+}
+
+// uploadReadable reports whether the file is attached to something the user
+// may read.
+func uploadReadable(db *gorm.DB, upload models.Upload, userID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.JournalEntry{}).
+		Scopes(readableBy(userID)).
+		Where("journal_entries.audio_url = ?", upload.Url()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	if err := db.Table("message_attachments").
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Joins("JOIN conversation_participants p ON p.conversation_id = messages.conversation_id").
+		Where("message_attachments.url = ? AND p.user_id = ?", upload.Url(), userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// uploadExt keeps a short alphanumeric extension from the client's file name.
+func uploadExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if len(ext) < 2 || len(ext) > 8 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
@@ -1,7 +1,41 @@
 package handlers
 
-import "time"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
 
 func parseDate(s string) (time.Time, error) {
 	return time.Parse(time.RFC3339, s)
-}
\ No newline at end of file
+}
+
+// newToken returns a random URL-safe token for links sent to users.
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is what gets stored for a token; the token itself never is.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// appURL builds a frontend link carrying a token. APP_BASE_URL falls back to
+// the first CORS origin.
+func appURL(path, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = strings.TrimSpace(strings.Split(os.Getenv("CORS_ORIGINS"), ",")[0])
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+)
+
+var (
+	errEntryNotVisible = errors.New("journal entry is not shared with this user")
+	errInvalidShares   = errors.New("invalid sharedWith")
+)
+
+// visibleToCaregiver restricts a journal_entries query to entries the caregiver
+// is linked to with the read_journal scope and allowed to see.
+func visibleToCaregiver(caregiverID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Joins("JOIN caregiver_recipients ON caregiver_recipients.recipient_id = journal_entries.recipient_id").
+			Where("caregiver_recipients.caregiver_id = ?", caregiverID).
+			Where(models.ScopeGranted("caregiver_recipients", models.ScopeReadJournal)).
+			Where(`(journal_entries.visibility = ? OR (journal_entries.visibility = ? AND EXISTS (
+				SELECT 1 FROM journal_entry_shares s
+				WHERE s.journal_entry_id = journal_entries.id AND s.caregiver_id = ?
+			)))`, models.VisibilityCaregivers, models.VisibilitySelected, caregiverID)
+	}
+}
+
+// readableBy restricts a journal_entries query to entries the user may read:
+// all of their own as the recipient, those visibleToCaregiver allows for their
+// caregiver profile, and entries shared with caregivers when a guardian link
+// lets them view the journal. Anonymous callers (user 0) match nothing.
+func readableBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(
+			journal_entries.recipient_id IN (SELECT id FROM recipients WHERE user_id = ?)
+			OR EXISTS (
+				SELECT 1 FROM caregiver_recipients
+				JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id
+				WHERE caregiver_recipients.recipient_id = journal_entries.recipient_id
+				AND caregivers.user_id = ?
+				AND ?
+				AND (journal_entries.visibility = ? OR (journal_entries.visibility = ? AND EXISTS (
+					SELECT 1 FROM journal_entry_shares s
+					WHERE s.journal_entry_id = journal_entries.id AND s.caregiver_id = caregivers.id
+				)))
+			)
+			OR EXISTS (
+				SELECT 1 FROM guardian_recipients
+				JOIN guardians ON guardians.id = guardian_recipients.guardian_id
+				WHERE guardian_recipients.recipient_id = journal_entries.recipient_id
+				AND guardians.user_id = ? AND guardian_recipients.can_view_journal
+				AND journal_entries.visibility = ?
+			)
+		)`, userID, userID, models.ScopeGranted("caregiver_recipients", models.ScopeReadJournal),
+			models.VisibilityCaregivers, models.VisibilitySelected, userID, models.VisibilityCaregivers)
+	}
+}
+
+// checkEntryVisible returns errEntryNotVisible unless the user may read the
+// entry.
+func checkEntryVisible(db *gorm.DB, entry models.JournalEntry, userID uint) error {
+	var count int64
+	if err := db.Model(&models.JournalEntry{}).
+		Scopes(readableBy(userID)).
+		Where("journal_entries.id = ?", entry.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errEntryNotVisible
+	}
+	return nil
+}
+
+// visibleEntry loads a journal entry the caller may read, writing a 404 or
+// 403 and returning false otherwise. notFound is the status for a missing
+// entry, since a bad reference in a request body is a 400.
+func visibleEntry(c *gin.Context, db *gorm.DB, entryID uint, notFound int) (models.JournalEntry, bool) {
+	var entry models.JournalEntry
+	if err := db.First(&entry, "id = ?", entryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(notFound, gin.H{"error": "journal entry not found"})
+			return entry, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entry, false
+	}
+
+	if err := checkEntryVisible(db, entry, auth.UserID(c)); err != nil {
+		if errors.Is(err, errEntryNotVisible) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return entry, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entry, false
+	}
+	return entry, true
+}
+
+// presentEntries strips the embedded recipients down to what the caller may
+// see of their profiles.
+func presentEntries(c *gin.Context, db *gorm.DB, entries []models.JournalEntry) error {
+	viewer, err := resolveViewer(c, db)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		viewer.present(&entries[i].Recipient)
+	}
+	return nil
+}
+
+// validateShares checks that every caregiver an entry is shared with is linked
+// to the recipient.
+func validateShares(db *gorm.DB, recipientID uint, caregiverIDs []uint) error {
+	if len(caregiverIDs) == 0 {
+		return fmt.Errorf("%w: at least one caregiver is required when visibility is selected", errInvalidShares)
+	}
+
+	var count int64
+	if err := db.Model(&models.CaregiverRecipient{}).
+		Where("recipient_id = ? AND caregiver_id IN ?", recipientID, caregiverIDs).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(uniqueIDs(caregiverIDs)) {
+		return fmt.Errorf("%w: caregivers must be linked to the recipient", errInvalidShares)
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func sharesFor(caregiverIDs []uint) []models.JournalEntryShare {
+	shares := make([]models.JournalEntryShare, 0, len(caregiverIDs))
+	for _, id := range uniqueIDs(caregiverIDs) {
+		shares = append(shares, models.JournalEntryShare{CaregiverID: id})
+	}
+	return shares
+}
+
+func respondSharesError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidShares) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"hack4good/internal/auth"
+	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
+)
+
+// WebhookHandler serves both /me/webhooks, for the caller's own
+// subscriptions, and /organizations/:id/webhooks, for organization admins.
+type WebhookHandler struct {
+	DB *gorm.DB
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// webhookOwner is who the subscriptions on the current route belong to.
+type webhookOwner struct {
+	orgID  *uint
+	userID *uint
+}
+
+func (o webhookOwner) scope(db *gorm.DB) *gorm.DB {
+	if o.orgID != nil {
+		return db.Where("organization_id = ?", *o.orgID)
+	}
+	return db.Where("user_id = ?", *o.userID)
+}
+
+func (h WebhookHandler) owner(c *gin.Context) (webhookOwner, bool) {
+	if strings.HasPrefix(c.FullPath(), "/organizations/") {
+		member, ok := OrganizationHandler{DB: h.DB}.orgMember(c, models.OrgRoleAdmin)
+		return webhookOwner{orgID: &member.OrganizationID}, ok
+	}
+	userID := auth.UserID(c)
+	return webhookOwner{userID: &userID}, true
+}
+
+// load resolves the owner and the subscription in :webhookId.
+func (h WebhookHandler) load(c *gin.Context) (models.WebhookSubscription, bool) {
+	var sub models.WebhookSubscription
+	owner, ok := h.owner(c)
+	if !ok {
+		return sub, false
+	}
+	if err := owner.scope(h.DB).First(&sub, "id = ?", c.Param("webhookId")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+			return sub, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return sub, false
+	}
+	return sub, true
+}
+
+func (h WebhookHandler) audit(c *gin.Context, action string, id uint) {
+	_ = recordAudit(h.DB, c, models.AuditLog{Action: action, ResourceType: "webhook_subscription", ResourceID: &id})
+}
+
+func (h WebhookHandler) List(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	var subs []models.WebhookSubscription
+	if err := owner.scope(h.DB).Order("id").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h WebhookHandler) Get(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// validEvents rejects unknown event types and returns the rest sorted and
+// without duplicates.
+func validEvents(c *gin.Context, events []models.WebhookEventType) ([]models.WebhookEventType, bool) {
+	for _, e := range events {
+		if !slices.Contains(models.WebhookEventTypes, e) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type " + strconv.Quote(string(e))})
+			return nil, false
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(events))), true
+}
+
+// webhookWithSecret is a subscription with its signing secret, which is only
+// shown when it is created or rotated.
+type webhookWithSecret struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type createWebhookRequest struct {
+	URL         string                    `json:"url" binding:"required"`
+	Events      []models.WebhookEventType `json:"events" binding:"required,min=1"`
+	Description string                    `json:"description"`
+}
+
+// Create adds a subscription. The response is the only one that includes the
+// signing secret, until it is rotated.
+func (h WebhookHandler) Create(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validWebhookURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+		return
+	}
+	events, ok := validEvents(c, req.Events)
+	if !ok {
+		return
+	}
+	secret, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := models.WebhookSubscription{
+		OrganizationID: owner.orgID,
+		UserID:         owner.userID,
+		URL:            req.URL,
+		Secret:         secret,
+		Events:         events,
+		Description:    req.Description,
+		Active:         true,
+		CreatedByID:    auth.UserID(c),
+	}
+	if err := h.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, "webhook.created", sub.ID)
+
+	c.JSON(http.StatusCreated, webhookWithSecret{sub, sub.Secret})
+}
+
+type updateWebhookRequest struct {
+	URL          *string                    `json:"url"`
+	Events       *[]models.WebhookEventType `json:"events" binding:"omitempty,min=1"`
+	Description  *string                    `json:"description"`
+	Active       *bool                      `json:"active"`
+	RotateSecret bool                       `json:"rotateSecret"`
+}
+
+func (h WebhookHandler) Update(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	var req updateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.URL != nil {
+		if !validWebhookURL(*req.URL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+			return
+		}
+		sub.URL = *req.URL
+	}
+	if req.Events != nil {
+		if sub.Events, ok = validEvents(c, *req.Events); !ok {
+			return
+		}
+	}
+	if req.Description != nil {
+		sub.Description = *req.Description
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if req.RotateSecret {
+		secret, err := newToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sub.Secret = secret
+	}
+
+	columns := []string{"url", "events", "description", "active", "updated_at"}
+	if req.RotateSecret {
+		columns = append(columns, "secret")
+	}
+	if err := h.DB.Select(columns).Updates(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RotateSecret {
+		h.audit(c, "webhook.secret_rotated", sub.ID)
+		c.JSON(http.StatusOK, webhookWithSecret{sub, sub.Secret})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// Delete removes the subscription along with its delivery log.
+func (h WebhookHandler) Delete(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, "webhook.deleted", sub.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// Test sends a ping event to the subscription.
+func (h WebhookHandler) Test(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if !sub.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "webhook is paused"})
+		return
+	}
+
+	delivery, err := webhooks.Ping(h.DB, sub)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// ListDeliveries returns the subscription's delivery log, newest first. It
+// supports status, eventId, limit (max 100) and offset.
+func (h WebhookHandler) ListDeliveries(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	q := h.DB.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", sub.ID)
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if eventID := c.Query("eventId"); eventID != "" {
+		q = q.Where("event_id = ?", eventID)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var deliveries []models.WebhookDelivery
+	if err := q.Order("id DESC").Limit(limit).Offset(max(offset, 0)).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries, "total": total})
+}
+
+// Replay sends a logged delivery again with the same event ID.
+func (h WebhookHandler) Replay(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	var original models.WebhookDelivery
+	if err := h.DB.First(&original, "id = ? AND subscription_id = ?", c.Param("deliveryId"), sub.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !sub.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "webhook is paused"})
+		return
+	}
+
+	delivery, err := webhooks.Replay(h.DB, original.ID)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
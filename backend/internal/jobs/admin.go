@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+// Filter narrows List. Limit defaults to 50 and is capped at 200.
+type Filter struct {
+	Status models.JobStatus
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+// List returns jobs matching f, newest first, with the total match count.
+func List(db *gorm.DB, f Filter) ([]models.Job, int64, error) {
+	q := db.Model(&models.Job{})
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.Kind != "" {
+		q = q.Where("kind = ?", f.Kind)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	var list []models.Job
+	err := q.Order("id DESC").Limit(f.Limit).Offset(f.Offset).Find(&list).Error
+	return list, total, err
+}
+
+func Get(db *gorm.DB, id uint) (models.Job, error) {
+	var job models.Job
+	if err := db.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return job, ErrNotFound
+		}
+		return job, err
+	}
+	return job, nil
+}
+
+// Retry runs a dead job again with a fresh set of attempts, or moves a
+// queued one to the front of the queue.
+func Retry(db *gorm.DB, id uint) (models.Job, error) {
+	job, err := Get(db, id)
+	if err != nil {
+		return job, err
+	}
+	if job.Status != models.JobDead && job.Status != models.JobQueued {
+		return job, ErrNotRetryable
+	}
+
+	res := db.Model(&job).
+		Where("status IN ?", []models.JobStatus{models.JobDead, models.JobQueued}).
+		Updates(map[string]any{
+			"status":      models.JobQueued,
+			"run_at":      time.Now(),
+			"attempts":    0,
+			"finished_at": nil,
+		})
+	if res.Error != nil {
+		return job, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return job, ErrNotRetryable
+	}
+	if err := notify(db); err != nil {
+		return job, err
+	}
+	return Get(db, id)
+}
+
+// Schedules lists the recurring jobs workers have registered.
+func Schedules(db *gorm.DB) ([]models.JobSchedule, error) {
+	var list []models.JobSchedule
+	err := db.Order("name").Find(&list).Error
+	return list, err
+}
+
+// Cleanup deletes jobs that succeeded before the cutoff. Dead jobs are kept
+// for inspection.
+func Cleanup(db *gorm.DB, before time.Time) (int64, error) {
+	res := db.Where("status = ? AND finished_at < ?", models.JobSucceeded, before).Delete(&models.Job{})
+	return res.RowsAffected, res.Error
+}
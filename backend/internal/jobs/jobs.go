@@ -0,0 +1,168 @@
+// Package jobs is a durable background job queue on PostgreSQL. Jobs are rows
+// in the jobs table; workers claim them with FOR UPDATE SKIP LOCKED, retry
+// failures with exponential backoff and move jobs that keep failing to the
+// dead status, where an admin can inspect and retry them.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	defaultTimeout     = 15 * time.Minute
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = time.Hour
+)
+
+var (
+	ErrNotFound     = errors.New("job not found")
+	ErrNotRetryable = errors.New("only queued or dead jobs can be retried")
+)
+
+// Handler runs one job with its raw JSON payload.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type kind struct {
+	handle  Handler
+	timeout time.Duration
+}
+
+type schedule struct {
+	name, spec, kind string
+	cron             Cron
+	payload          json.RawMessage
+}
+
+// Registry maps job kinds to handlers and holds the recurring schedules a
+// worker keeps queueing.
+type Registry struct {
+	kinds     map[string]kind
+	schedules []schedule
+}
+
+func NewRegistry() *Registry {
+	return &Registry{kinds: map[string]kind{}}
+}
+
+// Register adds a handler whose payload is decoded into T. Jobs of a kind no
+// running worker has registered stay queued.
+func Register[T any](r *Registry, name string, fn func(ctx context.Context, payload T) error) {
+	RegisterWithTimeout(r, name, defaultTimeout, fn)
+}
+
+// RegisterWithTimeout is Register with a limit on a single run other than the
+// default 15 minutes.
+func RegisterWithTimeout[T any](r *Registry, name string, timeout time.Duration, fn func(ctx context.Context, payload T) error) {
+	r.kinds[name] = kind{
+		timeout: timeout,
+		handle: func(ctx context.Context, raw json.RawMessage) error {
+			var payload T
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				return Permanent(fmt.Errorf("decoding payload: %w", err))
+			}
+			return fn(ctx, payload)
+		},
+	}
+}
+
+// Schedule queues a job of the given kind every time spec fires. See Cron for
+// the syntax.
+func (r *Registry) Schedule(name, spec, kind string, payload any) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return fmt.Errorf("cron %q never fires", spec)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	r.schedules = append(r.schedules, schedule{name: name, spec: spec, kind: kind, cron: cron, payload: raw})
+	return nil
+}
+
+func (r *Registry) kindNames() []string {
+	names := make([]string, 0, len(r.kinds))
+	for name := range r.kinds {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Option adjusts a job when it is queued.
+type Option func(*models.Job)
+
+// At delays the job until t.
+func At(t time.Time) Option {
+	return func(j *models.Job) { j.RunAt = t }
+}
+
+// MaxAttempts overrides how often the job is tried before it is dead.
+func MaxAttempts(n int) Option {
+	return func(j *models.Job) { j.MaxAttempts = n }
+}
+
+// Enqueue stores a job to run as soon as a worker is free. Pass a transaction
+// to queue work only if the surrounding change commits.
+func Enqueue(db *gorm.DB, kind string, payload any, opts ...Option) (models.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return models.Job{}, err
+	}
+	job := models.Job{
+		Kind:        kind,
+		Payload:     raw,
+		Status:      models.JobQueued,
+		RunAt:       time.Now(),
+		MaxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&job)
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return job, err
+	}
+	return job, notify(db)
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying won't fix, so the job goes straight
+// to dead.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type attemptKey struct{}
+
+type attempt struct{ n, max int }
+
+// FinalAttempt reports whether the running job will be dead if this attempt
+// fails, so handlers can record the failure on their own records.
+func FinalAttempt(ctx context.Context) bool {
+	a, ok := ctx.Value(attemptKey{}).(attempt)
+	return ok && a.n >= a.max
+}
+
+// backoff is the delay before retry n: 30s, 1m, 2m, ... capped at an hour.
+func backoff(n int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,376 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/models"
+)
+
+// notifyChannel is the PostgreSQL channel workers LISTEN on for new jobs.
+const notifyChannel = "jobs"
+
+// notify tells listening workers, in any process, that jobs are queued. A
+// NOTIFY sent in a transaction is only delivered once it commits, so workers
+// never wake for a job they can't see yet.
+func notify(db *gorm.DB) error {
+	return db.Exec("SELECT pg_notify(?, '')", notifyChannel).Error
+}
+
+var errNoListen = errors.New("LISTEN needs the pgx driver")
+
+// listen wakes this worker's goroutines whenever a job is queued, until ctx
+// is cancelled. It reconnects after errors; meanwhile the workers still poll.
+func (w *Worker) listen(ctx context.Context, wake chan<- struct{}) {
+	for ctx.Err() == nil {
+		err := w.listenOnce(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("jobs: listening for new jobs: %v", err)
+		if errors.Is(err, errNoListen) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+func (w *Worker) listenOnce(ctx context.Context, wake chan<- struct{}) error {
+	sqlDB, err := w.DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("%w, not %T", errNoListen, driverConn)
+		}
+		// The connection is only ever used for listening, so it is closed
+		// rather than going back to the pool
+		pc := c.Conn()
+		defer pc.Close(context.Background())
+		if _, err := pc.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		for {
+			if _, err := pc.WaitForNotification(ctx); err != nil {
+				return err
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
+
+// Worker runs a pool of goroutines that claim and execute jobs, and queues
+// recurring jobs from the registry's schedules.
+type Worker struct {
+	DB       *gorm.DB
+	Registry *Registry
+
+	Concurrency  int           // defaults to 4
+	PollInterval time.Duration // defaults to 5s
+	// A job locked for longer than Lease is assumed to belong to a worker
+	// that died and is retried. Defaults to an hour; it must be longer than
+	// any handler's timeout.
+	Lease time.Duration
+	ID    string // defaults to host:pid
+}
+
+func (w *Worker) defaults() {
+	if w.Concurrency <= 0 {
+		w.Concurrency = 4
+	}
+	if w.PollInterval <= 0 {
+		w.PollInterval = 5 * time.Second
+	}
+	if w.Lease <= 0 {
+		w.Lease = time.Hour
+	}
+	if w.ID == "" {
+		host, _ := os.Hostname()
+		w.ID = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+}
+
+// Run blocks until ctx is cancelled and running jobs have finished. Jobs
+// don't see the cancellation: each runs to completion or its own timeout, so
+// a shutdown drains the pool instead of abandoning work half done.
+func (w *Worker) Run(ctx context.Context) error {
+	w.defaults()
+	if err := w.syncSchedules(); err != nil {
+		return err
+	}
+
+	wake := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.listen(ctx, wake)
+	}()
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, wake)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := w.reapStale(); err != nil {
+				log.Printf("jobs: requeueing stale jobs: %v", err)
+			}
+			if err := w.queueDue(); err != nil {
+				log.Printf("jobs: queueing scheduled jobs: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	wg.Wait()
+	return nil
+}
+
+func (w *Worker) loop(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			job, err := w.claim()
+			if err != nil {
+				log.Printf("jobs: claiming: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			w.execute(job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// claim locks the next due job of a kind this worker handles.
+func (w *Worker) claim() (*models.Job, error) {
+	kinds := w.Registry.kindNames()
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	var job models.Job
+	now := time.Now()
+	err := w.DB.Raw(`UPDATE jobs
+		SET status = ?, attempts = attempts + 1, locked_by = ?, locked_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ? AND kind IN ?
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.JobRunning, w.ID, now, now, models.JobQueued, now, kinds).
+		Scan(&job).Error
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (w *Worker) execute(job *models.Job) {
+	k := w.Registry.kinds[job.Kind]
+	jobCtx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+	jobCtx = context.WithValue(jobCtx, attemptKey{}, attempt{n: job.Attempts, max: job.MaxAttempts})
+
+	err := run(jobCtx, k.handle, job)
+	if err := w.finish(job, err); err != nil {
+		log.Printf("jobs: recording result of job %d: %v", job.ID, err)
+	}
+}
+
+// run calls the handler, turning a panic into an error.
+func run(ctx context.Context, handle Handler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return handle(ctx, job.Payload)
+}
+
+func (w *Worker) finish(job *models.Job, runErr error) error {
+	now := time.Now()
+	updates := map[string]any{
+		"locked_by":  nil,
+		"locked_at":  nil,
+		"updated_at": now,
+	}
+
+	var permanent permanentError
+	switch {
+	case runErr == nil:
+		updates["status"] = models.JobSucceeded
+		updates["finished_at"] = now
+		updates["last_error"] = ""
+	case errors.As(runErr, &permanent) || job.Attempts >= job.MaxAttempts:
+		log.Printf("jobs: %s job %d is dead after %d attempts: %v", job.Kind, job.ID, job.Attempts, runErr)
+		updates["status"] = models.JobDead
+		updates["finished_at"] = now
+		updates["last_error"] = runErr.Error()
+	default:
+		log.Printf("jobs: %s job %d failed (attempt %d of %d): %v", job.Kind, job.ID, job.Attempts, job.MaxAttempts, runErr)
+		updates["status"] = models.JobQueued
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+		updates["last_error"] = runErr.Error()
+	}
+
+	// Only if we still hold the lock; a reaped job may be running elsewhere
+	return w.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ?", job.ID, models.JobRunning, w.ID).
+		UpdateColumns(updates).Error
+}
+
+// reapStale gives jobs whose worker stopped responding back to the queue,
+// counting the lost run as a failed attempt.
+func (w *Worker) reapStale() error {
+	cutoff := time.Now().Add(-w.Lease)
+	now := time.Now()
+	if err := w.DB.Model(&models.Job{}).
+		Where("status = ? AND locked_at < ? AND attempts >= max_attempts", models.JobRunning, cutoff).
+		UpdateColumns(map[string]any{
+			"status": models.JobDead, "finished_at": now, "last_error": "worker lease expired",
+			"locked_by": nil, "locked_at": nil, "updated_at": now,
+		}).Error; err != nil {
+		return err
+	}
+	return w.DB.Model(&models.Job{}).
+		Where("status = ? AND locked_at < ?", models.JobRunning, cutoff).
+		UpdateColumns(map[string]any{
+			"status": models.JobQueued, "run_at": now, "last_error": "worker lease expired",
+			"locked_by": nil, "locked_at": nil, "updated_at": now,
+		}).Error
+}
+
+// syncSchedules stores the registry's schedules, recomputing the next run of
+// any whose spec or kind changed since the last start. Workers starting at the
+// same time may race to insert a schedule; the loser keeps the winner's row.
+func (w *Worker) syncSchedules() error {
+	now := time.Now()
+	for _, s := range w.Registry.schedules {
+		row := models.JobSchedule{Name: s.name, Spec: s.spec, Kind: s.kind, NextRunAt: s.cron.Next(now)}
+		if err := w.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return err
+		}
+		if err := w.DB.Model(&models.JobSchedule{}).
+			Where("name = ? AND (spec <> ? OR kind <> ?)", s.name, s.spec, s.kind).
+			Updates(map[string]any{
+				"spec": s.spec, "kind": s.kind, "next_run_at": s.cron.Next(now),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueDue queues a job for every schedule that is due. A run is skipped
+// while the previous one is still queued or running, and runs missed while no
+// worker was up are not caught up.
+func (w *Worker) queueDue() error {
+	byName := map[string]schedule{}
+	names := make([]string, 0, len(w.Registry.schedules))
+	for _, s := range w.Registry.schedules {
+		byName[s.name] = s
+		names = append(names, s.name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return w.DB.Transaction(func(tx *gorm.DB) error {
+		var due []models.JobSchedule
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("name IN ? AND next_run_at <= ?", names, now).
+			Find(&due).Error; err != nil {
+			return err
+		}
+
+		for _, row := range due {
+			s := byName[row.Name]
+			updates := map[string]any{"next_run_at": s.cron.Next(now)}
+
+			busy := false
+			if row.LastJobID != nil {
+				var n int64
+				if err := tx.Model(&models.Job{}).
+					Where("id = ? AND status IN ?", *row.LastJobID, []models.JobStatus{models.JobQueued, models.JobRunning}).
+					Count(&n).Error; err != nil {
+					return err
+				}
+				busy = n > 0
+			}
+			if !busy {
+				name := row.Name
+				job := models.Job{
+					Kind:        s.kind,
+					Payload:     s.payload,
+					Status:      models.JobQueued,
+					RunAt:       now,
+					MaxAttempts: DefaultMaxAttempts,
+					Schedule:    &name,
+				}
+				if err := tx.Create(&job).Error; err != nil {
+					return err
+				}
+				updates["last_run_at"] = now
+				updates["last_job_id"] = job.ID
+			}
+
+			if err := tx.Model(&models.JobSchedule{}).Where("name = ?", row.Name).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if len(due) > 0 {
+			return notify(tx)
+		}
+		return nil
+	})
+}
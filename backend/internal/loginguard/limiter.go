@@ -0,0 +1,170 @@
+// Package loginguard slows down and temporarily locks out repeated failed
+// logins, tracked per username and per client IP.
+package loginguard
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// State is what a store keeps per key.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	// Update atomically replaces the state of key with fn's result.
+	Update(ctx context.Context, key string, fn func(State) State) (State, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy controls how one kind of key is throttled. Every failure blocks the
+// key for BaseDelay doubled per previous failure, capped at MaxDelay; at
+// MaxFailures it's locked out for Lockout. Failures older than Window are
+// forgotten.
+type Policy struct {
+	MaxFailures int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+var (
+	UsernamePolicy = Policy{MaxFailures: 5, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Lockout: 15 * time.Minute, Window: 15 * time.Minute}
+	IPPolicy       = Policy{MaxFailures: 20, Lockout: 15 * time.Minute, Window: 15 * time.Minute}
+
+	// Password reset requests, per login and per IP, successful or not
+	ResetLoginPolicy = Policy{MaxFailures: 3, Lockout: time.Hour, Window: time.Hour}
+	ResetIPPolicy    = Policy{MaxFailures: 10, Lockout: time.Hour, Window: time.Hour}
+
+	// Wrong guesses at one login code or magic link, from any IP
+	LoginCodePolicy = Policy{MaxFailures: 5, Lockout: 15 * time.Minute, Window: 15 * time.Minute}
+
+	// Unknown recipient invite codes, per caller and per IP
+	InviteCodePolicy = Policy{MaxFailures: 10, Lockout: time.Hour, Window: time.Hour}
+)
+
+func (p Policy) next(s State, now time.Time) State {
+	if !s.LastFailureAt.IsZero() && now.Sub(s.LastFailureAt) > p.Window && now.After(s.BlockedUntil) {
+		s = State{}
+	}
+	s.Failures++
+	s.LastFailureAt = now
+
+	if s.Failures >= p.MaxFailures {
+		s.BlockedUntil = now.Add(p.Lockout)
+		return s
+	}
+	if p.BaseDelay > 0 {
+		delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(s.Failures-1)))
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		s.BlockedUntil = now.Add(delay)
+	}
+	return s
+}
+
+type Limiter struct {
+	Store    Store
+	Username Policy
+	IP       Policy
+	now      func() time.Time
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{Store: store, Username: UsernamePolicy, IP: IPPolicy, now: time.Now}
+}
+
+func usernameKey(username string) string { return "user:" + username }
+func ipKey(ip string) string             { return "ip:" + ip }
+
+// Attempt counts a login attempt against the IP and the username before the
+// password is checked, so concurrent guesses can't all pass one check. It
+// returns how long the caller has to wait, or zero if the attempt may
+// proceed; a blocked key doesn't count the attempt. Call Success or Locked
+// once the outcome is known.
+func (l *Limiter) Attempt(ctx context.Context, username, ip string) (time.Duration, error) {
+	if wait, err := l.Throttle(ctx, ipKey(ip), l.IP); err != nil || wait > 0 {
+		return wait, err
+	}
+	return l.Throttle(ctx, usernameKey(username), l.Username)
+}
+
+// Locked reports whether the username's failed attempts have locked it out.
+func (l *Limiter) Locked(ctx context.Context, username string) (bool, error) {
+	s, err := l.Store.Get(ctx, usernameKey(username))
+	if err != nil {
+		return false, err
+	}
+	return s.Failures >= l.Username.MaxFailures && s.BlockedUntil.After(l.now()), nil
+}
+
+// Throttle counts an attempt against key under p and returns zero, or how
+// long the caller has to wait if key was already blocked. Blocked attempts
+// aren't counted. It suits requests that are limited whether or not they
+// succeed, such as password reset emails.
+func (l *Limiter) Throttle(ctx context.Context, key string, p Policy) (time.Duration, error) {
+	now := l.now()
+	var wait time.Duration
+	_, err := l.Store.Update(ctx, key, func(s State) State {
+		if d := s.BlockedUntil.Sub(now); d > 0 {
+			wait = d
+			return s
+		}
+		return p.next(s, now)
+	})
+	return wait, err
+}
+
+// Check returns how long key is still blocked, or zero, without counting an
+// attempt. Record the outcome with Failure.
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	s, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if d := s.BlockedUntil.Sub(l.now()); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+// Failure records a failed attempt against key under p.
+func (l *Limiter) Failure(ctx context.Context, key string, p Policy) error {
+	now := l.now()
+	_, err := l.Store.Update(ctx, key, func(s State) State { return p.next(s, now) })
+	return err
+}
+
+// CheckIP is Check for attempts that aren't tied to a username, such as
+// one-time login codes.
+func (l *Limiter) CheckIP(ctx context.Context, ip string) (time.Duration, error) {
+	return l.Check(ctx, ipKey(ip))
+}
+
+// FailureIP records a failed attempt against the IP only.
+func (l *Limiter) FailureIP(ctx context.Context, ip string) error {
+	return l.Failure(ctx, ipKey(ip), l.IP)
+}
+
+// Success clears the username's failures and takes back the IP's count for
+// this attempt. The rest of the IP counter is left alone so one valid account
+// can't be used to reset it.
+func (l *Limiter) Success(ctx context.Context, username, ip string) error {
+	if err := l.Store.Reset(ctx, usernameKey(username)); err != nil {
+		return err
+	}
+	_, err := l.Store.Update(ctx, ipKey(ip), func(s State) State {
+		if s.Failures > 0 {
+			s.Failures--
+		}
+		return s
+	})
+	return err
+}
@@ -0,0 +1,173 @@
+package loginguard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(now *time.Time) *Limiter {
+	l := New(NewMemoryStore())
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestPolicyNext(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := Policy{MaxFailures: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second, Lockout: time.Hour, Window: time.Minute}
+
+	tests := []struct {
+		name        string
+		state       State
+		now         time.Time
+		wantFails   int
+		wantBlocked time.Time
+	}{
+		{"first failure", State{}, start, 1, start.Add(time.Second)},
+		{"delay doubles", State{Failures: 1, LastFailureAt: start}, start, 2, start.Add(2 * time.Second)},
+		{"delay is capped", State{Failures: 2, LastFailureAt: start}, start, 3, start.Add(3 * time.Second)},
+		{"locks out at the limit", State{Failures: 4, LastFailureAt: start}, start, 5, start.Add(time.Hour)},
+		{"stays locked past the limit", State{Failures: 7, LastFailureAt: start}, start, 8, start.Add(time.Hour)},
+		{"old failures are forgotten", State{Failures: 2, LastFailureAt: start}, start.Add(2 * time.Minute), 1, start.Add(2*time.Minute + time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.next(tt.state, tt.now)
+			if got.Failures != tt.wantFails {
+				t.Errorf("Failures = %d, want %d", got.Failures, tt.wantFails)
+			}
+			if !got.BlockedUntil.Equal(tt.wantBlocked) {
+				t.Errorf("BlockedUntil = %v, want %v", got.BlockedUntil, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestAttemptLocksOut(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+	l.Username = Policy{MaxFailures: 3, Lockout: time.Hour, Window: time.Hour}
+
+	tests := []struct {
+		name       string
+		wantWait   bool
+		wantLocked bool
+	}{
+		{"first attempt", false, false},
+		{"second attempt", false, false},
+		{"third attempt hits the limit", false, true},
+		{"fourth attempt is blocked", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, err := l.Attempt(ctx, "alice", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (wait > 0) != tt.wantWait {
+				t.Errorf("wait = %v, want blocked %v", wait, tt.wantWait)
+			}
+			locked, err := l.Locked(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if locked != tt.wantLocked {
+				t.Errorf("Locked = %v, want %v", locked, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestSuccessRefundsIP(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+
+	for range 3 {
+		if _, err := l.Attempt(ctx, "alice", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Success(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := l.Store.Get(ctx, usernameKey("alice"))
+	ip, _ := l.Store.Get(ctx, ipKey("10.0.0.1"))
+	if user.Failures != 0 {
+		t.Errorf("username failures = %d, want 0", user.Failures)
+	}
+	if ip.Failures != 2 {
+		t.Errorf("ip failures = %d, want 2", ip.Failures)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+	p := Policy{MaxFailures: 2, Lockout: time.Hour, Window: time.Hour}
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		wantWait time.Duration
+	}{
+		{"first request", 0, 0},
+		{"second request locks", 0, 0},
+		{"third request waits", 0, time.Hour},
+		{"still waiting later", 30 * time.Minute, 30 * time.Minute},
+		{"allowed after lockout", 31 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			wait, err := l.Throttle(ctx, "reset:ip:10.0.0.1", p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestCheckAndFailure(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+	key := "login_code:abc"
+
+	tests := []struct {
+		name     string
+		failures int
+		wantWait time.Duration
+	}{
+		{"no failures", 0, 0},
+		{"below the limit", LoginCodePolicy.MaxFailures - 1, 0},
+		{"at the limit", 1, LoginCodePolicy.Lockout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range tt.failures {
+				if err := l.Failure(ctx, key, LoginCodePolicy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wait, err := l.Check(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+
+	// Other keys are unaffected
+	if wait, _ := l.Check(ctx, "login_code:other"); wait != 0 {
+		t.Errorf("other key wait = %v, want 0", wait)
+	}
+}
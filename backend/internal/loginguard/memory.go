@@ -0,0 +1,38 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps state in process. It's only correct for a single
+// instance; use PostgresStore when running several.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]State{}}
+}
+
+func (m *MemoryStore) Get(_ context.Context, key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[key], nil
+}
+
+func (m *MemoryStore) Update(_ context.Context, key string, fn func(State) State) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := fn(m.states[key])
+	m.states[key] = s
+	return s, nil
+}
+
+func (m *MemoryStore) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+	return nil
+}
@@ -0,0 +1,55 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/models"
+)
+
+// PostgresStore shares state between instances through the login_throttles
+// table.
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+func (p PostgresStore) Get(ctx context.Context, key string) (State, error) {
+	var row models.LoginThrottle
+	if err := p.DB.WithContext(ctx).First(&row, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return State{}, nil
+		}
+		return State{}, err
+	}
+	return State{Failures: row.Failures, LastFailureAt: row.LastFailureAt, BlockedUntil: row.BlockedUntil}, nil
+}
+
+func (p PostgresStore) Update(ctx context.Context, key string, fn func(State) State) (State, error) {
+	var s State
+	err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var row models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		s = fn(State{Failures: row.Failures, LastFailureAt: row.LastFailureAt, BlockedUntil: row.BlockedUntil})
+		return tx.Model(&row).Updates(map[string]any{
+			"failures":        s.Failures,
+			"last_failure_at": s.LastFailureAt,
+			"blocked_until":   s.BlockedUntil,
+		}).Error
+	})
+	return s, err
+}
+
+func (p PostgresStore) Reset(ctx context.Context, key string) error {
+	return p.DB.WithContext(ctx).Delete(&models.LoginThrottle{}, "key = ?", key).Error
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLog is an append-only record of an action taken on a recipient's data.
+type AuditLog struct {
+	ID      uint  `gorm:"primaryKey" json:"id"`
+	ActorID *uint `gorm:"index" json:"actorId"` // UserID; nil for anonymous requests
+	// Set when the actor was acting on behalf of someone else, e.g. a guardian
+	OnBehalfOfID *uint `gorm:"index" json:"onBehalfOfId"` // UserID
+
+	Action       string `gorm:"type:varchar(64);not null;index" json:"action"`
+	ResourceType string `gorm:"type:varchar(64);not null" json:"resourceType"`
+	ResourceID   *uint  `json:"resourceId"`
+	RecipientID  *uint  `gorm:"index" json:"recipientId"`
+
+	IP        string    `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string    `gorm:"type:text" json:"userAgent"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+var ErrAuditLogAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+func (AuditLog) BeforeUpdate(*gorm.DB) error { return ErrAuditLogAppendOnly }
+func (AuditLog) BeforeDelete(*gorm.DB) error { return ErrAuditLogAppendOnly }
+
+// EnforceAuditLogAppendOnly installs a trigger that makes the database reject
+// UPDATE, DELETE and TRUNCATE on audit_logs, so entries can't be changed by
+// raw SQL that skips the hooks above. Run it after migrating. Entries written
+// before anonymous actors were stored as NULL are converted once, before the
+// trigger exists.
+func EnforceAuditLogAppendOnly(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var installed bool
+		if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'audit_logs_append_only')").
+			Scan(&installed).Error; err != nil {
+			return err
+		}
+		if installed {
+			return nil
+		}
+		for _, stmt := range []string{
+			"UPDATE audit_logs SET actor_id = NULL WHERE actor_id = 0",
+			`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit log entries cannot be changed or deleted';
+			END;
+			$$ LANGUAGE plpgsql`,
+			`CREATE TRIGGER audit_logs_append_only
+				BEFORE UPDATE OR DELETE ON audit_logs
+				FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+			`CREATE TRIGGER audit_logs_no_truncate
+				BEFORE TRUNCATE ON audit_logs
+				FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type AuditResource string
+
+const (
+	AuditResourceRecipient    AuditResource = "recipient"
+	AuditResourceJournalEntry AuditResource = "journal_entry"
+	AuditResourceTodo         AuditResource = "todo"
+	AuditResourceCareRequest  AuditResource = "care_request"
+	AuditResourceComment      AuditResource = "comment"
+	AuditResourceCaregiver    AuditResource = "caregiver"
+	AuditResourceOrganization AuditResource = "organization"
+)
+
+// AuditLogEntry is an AuditLog with the actor's name, as shown to readers.
+type AuditLogEntry struct {
+	AuditLog
+	ActorUsername string `json:"actorUsername"`
+	ActorName     string `json:"actorName"`
+}
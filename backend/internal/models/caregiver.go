@@ -5,4 +5,39 @@ type Caregiver struct {
 	UserID uint `gorm:"uniqueIndex;not null" json:"userId"`
 
 	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"user"`
+
+	Bio               *string            `gorm:"type:text" json:"bio"`
+	Languages         []string           `gorm:"type:jsonb;serializer:json" json:"languages"`
+	Certifications    []string           `gorm:"type:jsonb;serializer:json" json:"certifications"`
+	Skills            []string           `gorm:"type:jsonb;serializer:json" json:"skills"`
+	YearsOfExperience *int               `json:"yearsOfExperience"`
+	Availability      []AvailabilitySlot `gorm:"type:jsonb;serializer:json" json:"availability"`
+}
+
+type Weekday string
+
+const (
+	Monday    Weekday = "monday"
+	Tuesday   Weekday = "tuesday"
+	Wednesday Weekday = "wednesday"
+	Thursday  Weekday = "thursday"
+	Friday    Weekday = "friday"
+	Saturday  Weekday = "saturday"
+	Sunday    Weekday = "sunday"
+)
+
+// AvailabilitySlot is a recurring weekly window, in 24h "HH:MM" local time.
+type AvailabilitySlot struct {
+	Day   Weekday `json:"day" binding:"required,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	Start string  `json:"start" binding:"required,datetime=15:04"`
+	End   string  `json:"end" binding:"required,datetime=15:04"`
+}
+
+type CaregiverProfileRequest struct {
+	Bio               *string            `json:"bio"`
+	Languages         []string           `json:"languages" binding:"omitempty,dive,required"`
+	Certifications    []string           `json:"certifications" binding:"omitempty,dive,required"`
+	Skills            []string           `json:"skills" binding:"omitempty,dive,required"`
+	YearsOfExperience *int               `json:"yearsOfExperience" binding:"omitempty,min=0,max=80"`
+	Availability      []AvailabilitySlot `json:"availability" binding:"omitempty,dive"`
 }
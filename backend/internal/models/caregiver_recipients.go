@@ -1,6 +1,28 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CaregiverScope string
+
+const (
+	ScopeReadJournal       CaregiverScope = "read_journal"
+	ScopeComment           CaregiverScope = "comment"
+	ScopeManageTodos       CaregiverScope = "manage_todos"
+	ScopeEditProfile       CaregiverScope = "edit_profile"
+	ScopeViewVitals        CaregiverScope = "view_vitals"
+	ScopeManageMedications CaregiverScope = "manage_medications"
+	ScopeManageDevices     CaregiverScope = "manage_devices" // sign the recipient in on devices
+)
+
+// DefaultCaregiverScopes apply to links where the recipient hasn't chosen,
+// including every link made before scopes existed.
+var DefaultCaregiverScopes = []CaregiverScope{ScopeReadJournal, ScopeComment, ScopeManageTodos}
 
 type CaregiverRecipient struct {
 	ID uint `gorm:"primaryKey" json:"id"`
@@ -8,4 +30,17 @@ type CaregiverRecipient struct {
 	CaregiverID uint      `gorm:"not null;index;uniqueIndex:uniq_caregiver_recipient" json:"caregiverId"`
 	RecipientID uint      `gorm:"not null;index;uniqueIndex:uniq_caregiver_recipient" json:"recipientId"`
 	CreatedAt   time.Time `json:"createdAt"`
+
+	// What the caregiver may do for this recipient; nil means DefaultCaregiverScopes
+	Scopes []CaregiverScope `gorm:"type:jsonb;serializer:json" json:"scopes"`
+}
+
+// ScopeGranted is a condition on a caregiver_recipients table (or alias) that
+// holds when the link grants the scope. Links that never chose their scopes
+// get DefaultCaregiverScopes.
+func ScopeGranted(table string, scope CaregiverScope) clause.Expr {
+	defaults, _ := json.Marshal(DefaultCaregiverScopes)
+	wanted, _ := json.Marshal([]CaregiverScope{scope})
+	return gorm.Expr("COALESCE(NULLIF("+table+".scopes, 'null'::jsonb), ?::jsonb) @> ?::jsonb",
+		string(defaults), string(wanted))
 }
@@ -5,9 +5,15 @@ import "time"
 type Comment struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	JournalEntryID uint      `gorm:"not null;index" json:"journalEntryId"`
-	AuthorID       uint      `gorm:"not null;index" json:"authorId"`
-	Content        string    `gorm:"type:text;not null" json:"content"`
+	AuthorID       uint      `gorm:"not null;index" json:"authorId"` // UserID
+	Content        string    `gorm:"type:text;not null;serializer:encrypted" json:"content"`
 	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Edited         bool      `gorm:"not null;default:false" json:"edited"`
+
+	// Set when this comment is a reply to another comment on the same entry
+	ParentID *uint    `gorm:"index" json:"parentId"`
+	Parent   *Comment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ParentID;references:ID" json:"-"`
 }
 
 type CommentReturned struct {
@@ -15,7 +21,13 @@ type CommentReturned struct {
 	JournalEntryID uint      `gorm:"not null;index" json:"journalEntryId"`
 	AuthorID       uint      `gorm:"not null;index" json:"authorId"`
 	AuthorName     string    `json:"authorName"`
-	Content        string    `gorm:"type:text;not null" json:"content"`
+	Content        string    `gorm:"type:text;not null;serializer:encrypted" json:"content"`
 	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Edited         bool      `json:"edited"`
 	AuthorRole     string    `json:"authorRole"` // "caregiver" or "recipient"
+	ParentID       *uint     `json:"parentId"`
+
+	Replies   []CommentReturned `gorm:"-" json:"replies"`
+	Reactions []ReactionSummary `gorm:"-" json:"reactions"`
 }
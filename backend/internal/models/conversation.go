@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Conversation is a direct message thread around a single recipient. A 1:1
+// thread pairs the recipient with one linked caregiver; group threads may add
+// any other caregivers linked to the same recipient.
+type Conversation struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RecipientID uint      `gorm:"not null;index" json:"recipientId"`
+	Recipient   Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"-"`
+	Title       *string   `json:"title"`
+	IsGroup     bool      `gorm:"not null;default:false" json:"isGroup"`
+	CreatedByID uint      `gorm:"not null" json:"createdById"` // UserID
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"` // bumped on every new message
+
+	Participants []ConversationParticipant `gorm:"foreignKey:ConversationID" json:"participants"`
+}
+
+type ConversationParticipant struct {
+	ID             uint `gorm:"primaryKey" json:"id"`
+	ConversationID uint `gorm:"not null;index;uniqueIndex:uniq_conversation_participant" json:"conversationId"`
+	UserID         uint `gorm:"not null;index;uniqueIndex:uniq_conversation_participant" json:"userId"`
+	User           User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"user"`
+
+	// Read receipt: the newest message this participant has seen
+	LastReadMessageID uint       `gorm:"not null;default:0" json:"lastReadMessageId"`
+	LastReadAt        *time.Time `json:"lastReadAt"`
+
+	JoinedAt time.Time `gorm:"autoCreateTime" json:"joinedAt"`
+
+	Conversation *Conversation `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ConversationID;references:ID" json:"-"`
+}
+
+type Message struct {
+	ID             uint          `gorm:"primaryKey" json:"id"`
+	ConversationID uint          `gorm:"not null;index" json:"conversationId"`
+	Conversation   *Conversation `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ConversationID;references:ID" json:"-"`
+	SenderID       uint          `gorm:"not null;index" json:"senderId"` // UserID
+	Content        string        `gorm:"type:text;not null" json:"content"`
+	CreatedAt      time.Time     `json:"createdAt"`
+
+	Attachments []MessageAttachment `gorm:"foreignKey:MessageID" json:"attachments"`
+}
+
+// MessageAttachment points at a file previously stored through POST /uploads.
+type MessageAttachment struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	MessageID uint     `gorm:"not null;index" json:"messageId"`
+	Message   *Message `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:MessageID;references:ID" json:"-"`
+	Url       string   `gorm:"not null" json:"url"`
+	FileName  string   `json:"fileName"`
+}
+
+type ConversationSummary struct {
+	Conversation
+	UnreadCount int64    `json:"unreadCount"`
+	LastMessage *Message `json:"lastMessage"`
+}
+
+type MessageReturned struct {
+	Message
+	SenderName string `json:"senderName"`
+	ReadBy     []uint `json:"readBy"` // UserIDs of other participants who have seen it
+}
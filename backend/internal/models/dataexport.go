@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type DataExportStatus string
+
+const (
+	ExportPending DataExportStatus = "pending"
+	ExportRunning DataExportStatus = "running"
+	ExportReady   DataExportStatus = "ready"
+	ExportFailed  DataExportStatus = "failed"
+	ExportExpired DataExportStatus = "expired" // file removed after ExpiresAt
+)
+
+// DataExport is a user's request for a copy of their personal data. The ZIP
+// is built in the background and can be downloaded until ExpiresAt.
+type DataExport struct {
+	ID       uint             `gorm:"primaryKey" json:"id"`
+	UserID   uint             `gorm:"not null;index" json:"userId"`
+	User     User             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	Status   DataExportStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	FilePath string           `json:"-"`
+	Size     int64            `json:"size"`
+	Error    string           `gorm:"type:text" json:"error,omitempty"`
+
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+
+	// Signed link, filled in when the export is ready
+	DownloadURL string `gorm:"-" json:"downloadUrl,omitempty"`
+}
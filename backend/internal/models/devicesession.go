@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// LoginCode lets a recipient sign in on a device without a password. A linked
+// guardian or a caregiver granted manage_devices creates it and the recipient either types the numeric
+// code or opens the link. Only hashes are stored.
+type LoginCode struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RecipientID uint      `gorm:"not null;index" json:"recipientId"`
+	Recipient   Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"-"`
+	CreatedByID uint      `gorm:"not null" json:"createdById"` // UserID
+
+	CodeHash  string `gorm:"not null;index" json:"-"`
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"` // magic link
+	// Name given to the device session the code creates
+	DeviceName string `gorm:"type:varchar(100)" json:"deviceName"`
+
+	ExpiresAt       time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt          *time.Time `json:"usedAt"`
+	DeviceSessionID *uint      `json:"deviceSessionId"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// LoginCodeIssued is returned once, when the code is created.
+type LoginCodeIssued struct {
+	LoginCode
+	Code string `json:"code"`
+	Url  string `json:"url"`
+}
+
+// DeviceSession is a long-lived login on one of a recipient's devices. Tokens
+// issued for it stop working once it is revoked.
+type DeviceSession struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"userId"`
+	User        User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	RecipientID uint   `gorm:"not null;index" json:"recipientId"`
+	Name        string `gorm:"type:varchar(100)" json:"name"`
+	CreatedByID uint   `gorm:"not null" json:"createdById"` // UserID of whoever issued the code
+	UserAgent   string `gorm:"type:text" json:"userAgent"`
+
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  time.Time  `json:"lastUsedAt"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+	RevokedByID *uint      `json:"revokedById"` // UserID
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type Guardian struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"uniqueIndex;not null" json:"userId"`
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"user"`
+}
+
+// GuardianRecipient delegates parts of a recipient's account to a guardian.
+// The recipient decides which permissions are granted.
+type GuardianRecipient struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	GuardianID  uint      `gorm:"not null;index;uniqueIndex:uniq_guardian_recipient" json:"guardianId"`
+	Guardian    Guardian  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:GuardianID;references:ID" json:"guardian"`
+	RecipientID uint      `gorm:"not null;index;uniqueIndex:uniq_guardian_recipient" json:"recipientId"`
+	Recipient   Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"recipient"`
+
+	CanRespondToRequests bool `gorm:"not null;default:false" json:"canRespondToRequests"`
+	CanEditProfile       bool `gorm:"not null;default:false" json:"canEditProfile"`
+	CanViewJournal       bool `gorm:"not null;default:false" json:"canViewJournal"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type GuardianPermission string
+
+const (
+	GuardianRespondToRequests GuardianPermission = "respond_to_requests"
+	GuardianEditProfile       GuardianPermission = "edit_profile"
+	GuardianViewJournal       GuardianPermission = "view_journal"
+)
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// HandoverNote is shared context between the caregivers of one recipient,
+// e.g. what happened during a shift.
+type HandoverNote struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RecipientID uint      `gorm:"not null;index" json:"recipientId"`
+	Recipient   Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"-"`
+	AuthorID    uint      `gorm:"not null;index" json:"authorId"` // CaregiverID
+	Author      Caregiver `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:AuthorID;references:ID" json:"author"`
+
+	Content            string `gorm:"type:text;not null" json:"content"`
+	Pinned             bool   `gorm:"not null;default:false;index" json:"pinned"`
+	VisibleToRecipient bool   `gorm:"not null;default:false" json:"visibleToRecipient"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Acknowledgements []HandoverAcknowledgement `gorm:"foreignKey:NoteID" json:"acknowledgements"`
+}
+
+// HandoverAcknowledgement records that a caregiver has read a note.
+type HandoverAcknowledgement struct {
+	ID             uint          `gorm:"primaryKey" json:"id"`
+	NoteID         uint          `gorm:"not null;index;uniqueIndex:uniq_note_ack" json:"noteId"`
+	Note           *HandoverNote `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:NoteID;references:ID" json:"-"`
+	CaregiverID    uint          `gorm:"not null;index;uniqueIndex:uniq_note_ack" json:"caregiverId"`
+	Caregiver      Caregiver     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:CaregiverID;references:ID" json:"caregiver"`
+	AcknowledgedAt time.Time     `gorm:"autoCreateTime" json:"acknowledgedAt"`
+}
+
+type MoodLog struct {
+	JournalEntryID uint      `json:"journalEntryId"`
+	Mood           MoodType  `json:"mood"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// HandoverDigest summarizes the last day of activity around a recipient.
+type HandoverDigest struct {
+	RecipientID    uint             `json:"recipientId"`
+	Since          time.Time        `json:"since"`
+	Until          time.Time        `json:"until"`
+	CompletedTodos []Todo           `json:"completedTodos"`
+	Moods          []MoodLog        `json:"moods"`
+	MoodCounts     map[MoodType]int `json:"moodCounts"`
+	Notes          []HandoverNote   `json:"notes"`
+}
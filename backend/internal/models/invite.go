@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Invite is a single-use, expiring token that connects a caregiver and a
+// recipient who already know each other. Exactly one of RecipientID and
+// CaregiverID is set: the side that created it. The other side redeems it.
+type Invite struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	TokenHash   string `gorm:"uniqueIndex;not null" json:"-"`     // sha256 of the token; the token itself is never stored
+	CreatedByID uint   `gorm:"not null;index" json:"createdById"` // UserID
+
+	RecipientID *uint      `gorm:"index" json:"recipientId"`
+	Recipient   *Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"-"`
+	CaregiverID *uint      `gorm:"index" json:"caregiverId"`
+	Caregiver   *Caregiver `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:CaregiverID;references:ID" json:"-"`
+
+	// AutoAccept links the pair immediately on redemption; otherwise a pending
+	// CareRequest is opened for the recipient to answer.
+	AutoAccept bool `gorm:"not null;default:true" json:"autoAccept"`
+
+	ExpiresAt     time.Time  `gorm:"not null" json:"expiresAt"`
+	RedeemedAt    *time.Time `json:"redeemedAt"`
+	RedeemedByID  *uint      `json:"redeemedById"` // UserID
+	CareRequestID *uint      `json:"careRequestId"`
+	RevokedAt     *time.Time `json:"revokedAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+type InviteAction string
+
+const (
+	InviteCreated  InviteAction = "created"
+	InviteRedeemed InviteAction = "redeemed"
+	InviteRevoked  InviteAction = "revoked"
+	InviteRejected InviteAction = "rejected" // redemption attempt that failed
+)
+
+// InviteEvent is the audit trail of everything that happened to an invite.
+type InviteEvent struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	InviteID  uint         `gorm:"not null;index" json:"inviteId"`
+	Invite    *Invite      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:InviteID;references:ID" json:"-"`
+	Action    InviteAction `gorm:"type:varchar(20);not null" json:"action"`
+	ActorID   uint         `gorm:"not null" json:"actorId"` // UserID
+	Detail    string       `json:"detail"`
+	IP        string       `gorm:"type:varchar(64)" json:"ip"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type InviteWithToken struct {
+	Invite Invite `json:"invite"`
+	Token  string `json:"token"`
+	Url    string `json:"url"`
+	QRCode string `json:"qrCode"` // base64 PNG of Url
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued" // waiting for RunAt, including retries
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobDead      JobStatus = "dead" // out of attempts or failed permanently
+)
+
+// Job is a unit of background work. Workers claim queued jobs whose RunAt has
+// passed with SELECT ... FOR UPDATE SKIP LOCKED, so any number of them can
+// share the table.
+type Job struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Kind        string          `gorm:"type:varchar(100);not null;index" json:"kind"`
+	Payload     json.RawMessage `gorm:"type:jsonb;not null;serializer:json" json:"payload"`
+	Status      JobStatus       `gorm:"type:varchar(20);not null;default:'queued';index:idx_jobs_claim,priority:1" json:"status"`
+	RunAt       time.Time       `gorm:"not null;index:idx_jobs_claim,priority:2" json:"runAt"`
+	Attempts    int             `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int             `gorm:"not null" json:"maxAttempts"`
+	LastError   string          `gorm:"type:text" json:"lastError,omitempty"`
+
+	// Set while a worker holds the job; a stale lock means the worker died
+	LockedBy *string    `gorm:"type:varchar(100)" json:"lockedBy,omitempty"`
+	LockedAt *time.Time `json:"lockedAt,omitempty"`
+
+	// Name of the recurring schedule that queued the job, if any
+	Schedule *string `gorm:"type:varchar(100);index" json:"schedule,omitempty"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobSchedule is the persisted state of a recurring job, so only one worker
+// queues each run and a restart doesn't skip or repeat one.
+type JobSchedule struct {
+	Name      string     `gorm:"primaryKey;type:varchar(100)" json:"name"`
+	Spec      string     `gorm:"type:varchar(100);not null" json:"spec"`
+	Kind      string     `gorm:"type:varchar(100);not null" json:"kind"`
+	NextRunAt time.Time  `gorm:"not null" json:"nextRunAt"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastJobID *uint      `json:"lastJobId,omitempty"`
+}
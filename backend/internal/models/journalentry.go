@@ -11,12 +11,55 @@ const (
 	MoodAnxious MoodType = "anxious"
 )
 
+// TranscriptStatus tracks an audio entry through the transcription queue. It
+// is empty for entries without audio.
+type TranscriptStatus string
+
+const (
+	TranscriptPending TranscriptStatus = "pending"
+	TranscriptRunning TranscriptStatus = "running"
+	TranscriptDone    TranscriptStatus = "done"
+	TranscriptFailed  TranscriptStatus = "failed"
+)
+
+type JournalVisibility string
+
+const (
+	VisibilityPrivate    JournalVisibility = "private"    // only the recipient
+	VisibilityCaregivers JournalVisibility = "caregivers" // every linked caregiver
+	VisibilitySelected   JournalVisibility = "selected"   // only caregivers listed in Shares
+)
+
 type JournalEntry struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	RecipientID uint      `gorm:"not null;index" json:"recipientId"`
 	Recipient   Recipient `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:RecipientID;references:ID" json:"recipient"`
-	Content     string    `gorm:"type:text;not null" json:"content"`
+	Content     string    `gorm:"type:text;not null;serializer:encrypted" json:"content"`
 	Mood        MoodType  `gorm:"type:varchar(20);not null" json:"mood"`
 	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Edited      bool      `gorm:"not null;default:false" json:"edited"`
 	AudioUrl    string    `json:"audioUrl"`
+
+	// Speech-to-text of the audio, filled in by the transcription worker and
+	// correctable by the recipient
+	Transcript         *string          `gorm:"type:text;serializer:encrypted" json:"transcript"`
+	TranscriptLanguage string           `gorm:"type:varchar(16)" json:"transcriptLanguage,omitempty"`
+	TranscriptStatus   TranscriptStatus `gorm:"type:varchar(20);index" json:"transcriptStatus,omitempty"`
+	TranscriptEdited   bool             `gorm:"not null;default:false" json:"transcriptEdited"`
+	TranscribedAt      *time.Time       `json:"transcribedAt,omitempty"`
+	TranscriptError    string           `gorm:"type:text" json:"-"`
+
+	Visibility JournalVisibility   `gorm:"type:varchar(20);not null;default:'caregivers';index" json:"visibility"`
+	Shares     []JournalEntryShare `gorm:"foreignKey:JournalEntryID" json:"shares,omitempty"`
+}
+
+// JournalEntryShare grants a single caregiver access to an entry with selected visibility.
+type JournalEntryShare struct {
+	ID             uint `gorm:"primaryKey" json:"id"`
+	JournalEntryID uint `gorm:"not null;index;uniqueIndex:uniq_entry_share" json:"journalEntryId"`
+	CaregiverID    uint `gorm:"not null;index;uniqueIndex:uniq_entry_share" json:"caregiverId"`
+
+	JournalEntry *JournalEntry `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:JournalEntryID;references:ID" json:"-"`
+	Caregiver    *Caregiver    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:CaregiverID;references:ID" json:"-"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks failed logins for one username or IP address.
+type LoginThrottle struct {
+	Key           string    `gorm:"primaryKey;type:varchar(255)" json:"key"` // "user:<username>" or "ip:<address>"
+	Failures      int       `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+	BlockedUntil  time.Time `gorm:"index" json:"blockedUntil"`
+}
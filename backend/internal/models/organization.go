@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Organization is a care agency. Everything an organization's staff can see
+// is derived from its members, so data never crosses organizations.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Caregiver members can't log in without TOTP when set
+	RequireCaregiver2FA bool `gorm:"column:require_caregiver_2fa;not null;default:false" json:"requireCaregiver2fa"`
+}
+
+type OrgRole string
+
+const (
+	OrgRoleAdmin       OrgRole = "admin"       // manages membership
+	OrgRoleCoordinator OrgRole = "coordinator" // oversees caseloads
+	OrgRoleCaregiver   OrgRole = "caregiver"
+)
+
+// OrganizationMember places a user in an organization. A user belongs to at
+// most one organization. Members added by an admin stay pending, with no
+// access either way, until the user accepts.
+type OrganizationMember struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	OrganizationID uint         `gorm:"not null;index" json:"organizationId"`
+	Organization   Organization `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:OrganizationID;references:ID" json:"-"`
+	UserID         uint         `gorm:"not null;uniqueIndex" json:"userId"`
+	User           User         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"user"`
+	Role           OrgRole      `gorm:"type:varchar(20);not null" json:"role"`
+	Pending        bool         `gorm:"not null;default:false" json:"pending"`
+	CreatedAt      time.Time    `json:"createdAt"`
+}
+
+type CaregiverCaseload struct {
+	CaregiverID  uint   `json:"caregiverId"`
+	UserID       uint   `json:"userId"`
+	Name         string `json:"name"`
+	Recipients   int64  `json:"recipients"`
+	OpenTodos    int64  `json:"openTodos"`
+	OverdueTodos int64  `json:"overdueTodos"`
+}
+
+type CoordinatorDashboard struct {
+	OrganizationID uint                `json:"organizationId"`
+	Caseloads      []CaregiverCaseload `json:"caseloads"`
+	OverdueTodos   []Todo              `json:"overdueTodos"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use, expiring token emailed to a user who
+// forgot their password. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"not null;index" json:"userId"`
+	User      User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
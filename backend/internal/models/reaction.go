@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Reaction is a lightweight emoji response to either a journal entry or a
+// comment; exactly one of JournalEntryID and CommentID is set.
+type Reaction struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null;index;uniqueIndex:uniq_entry_reaction;uniqueIndex:uniq_comment_reaction" json:"userId"`
+	User   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+
+	JournalEntryID *uint         `gorm:"index;uniqueIndex:uniq_entry_reaction" json:"journalEntryId"`
+	JournalEntry   *JournalEntry `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:JournalEntryID;references:ID" json:"-"`
+	CommentID      *uint         `gorm:"index;uniqueIndex:uniq_comment_reaction" json:"commentId"`
+	Comment        *Comment      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:CommentID;references:ID" json:"-"`
+
+	Emoji     string    `gorm:"type:varchar(32);not null;uniqueIndex:uniq_entry_reaction;uniqueIndex:uniq_comment_reaction" json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ReactionUser struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// ReactionSummary aggregates all reactions with the same emoji on one target.
+type ReactionSummary struct {
+	Emoji string         `json:"emoji"`
+	Count int            `json:"count"`
+	Users []ReactionUser `json:"users"`
+}
@@ -7,11 +7,32 @@ type Recipient struct {
 	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"user"`
 
 	Age       *int    `json:"age"`
-	Condition *string `gorm:"type:text" json:"condition"`
+	Condition *string `gorm:"type:text;serializer:encrypted" json:"condition"`
 	Likes     *string `gorm:"type:text" json:"likes"`
 	Dislikes  *string `gorm:"type:text" json:"dislikes"`
-	Phobias   *string `gorm:"type:text" json:"phobias"`
+	Phobias   *string `gorm:"type:text;serializer:encrypted" json:"phobias"`
 	PetPeeves *string `gorm:"type:text" json:"petPeeves"`
+
+	// Used to match recipients with suitable caregivers
+	Needs        []string           `gorm:"type:jsonb;serializer:json" json:"needs"`
+	Languages    []string           `gorm:"type:jsonb;serializer:json" json:"languages"`
+	Availability []AvailabilitySlot `gorm:"type:jsonb;serializer:json" json:"availability"` // when care is wanted
+
+	// Discovery: whether caregivers who aren't linked can find this recipient,
+	// and which profile fields they see before linking. Name is always shown.
+	Discoverable bool     `gorm:"not null;default:true;index" json:"discoverable"`
+	PublicFields []string `gorm:"type:jsonb;serializer:json" json:"publicFields"`
+	InviteCode   *string  `gorm:"uniqueIndex" json:"inviteCode,omitempty"`
+
+	// Whether linked caregivers may view past revisions of journal entries and comments
+	ShareEditHistory bool `gorm:"not null;default:true" json:"shareEditHistory"`
+
+	// Visibility applied to new journal entries that don't specify one
+	DefaultJournalVisibility JournalVisibility `gorm:"type:varchar(20);not null;default:'caregivers'" json:"defaultJournalVisibility"`
+
+	// Whether the organizations of linked caregivers may see this recipient
+	// and their todos
+	ShareWithOrganizations bool `gorm:"not null;default:false" json:"shareWithOrganizations"`
 }
 
 type RecipientRequest struct {
@@ -22,6 +43,17 @@ type RecipientRequest struct {
 	Dislikes  *string `json:"dislikes"`
 	Phobias   *string `json:"phobias"`
 	PetPeeves *string `json:"petPeeves"`
+
+	Needs        []string           `json:"needs" binding:"omitempty,dive,required"`
+	Languages    []string           `json:"languages" binding:"omitempty,dive,required"`
+	Availability []AvailabilitySlot `json:"availability" binding:"omitempty,dive"`
+
+	Discoverable *bool    `json:"discoverable"`
+	PublicFields []string `json:"publicFields" binding:"omitempty,dive,oneof=age condition likes dislikes phobias petPeeves needs languages availability"`
+
+	ShareEditHistory         *bool              `json:"shareEditHistory"`
+	DefaultJournalVisibility *JournalVisibility `json:"defaultJournalVisibility" binding:"omitempty,oneof=private caregivers"`
+	ShareWithOrganizations   *bool              `json:"shareWithOrganizations"`
 }
 
 type RecipientReturned struct {
@@ -35,9 +67,27 @@ type RecipientReturned struct {
 	Dislikes  *string `json:"dislikes"`
 	Phobias   *string `json:"phobias"`
 	PetPeeves *string `json:"petPeeves"`
+
+	Needs        []string           `gorm:"serializer:json" json:"needs"`
+	Languages    []string           `gorm:"serializer:json" json:"languages"`
+	Availability []AvailabilitySlot `gorm:"serializer:json" json:"availability"`
+
+	Discoverable bool     `json:"discoverable"`
+	PublicFields []string `gorm:"serializer:json" json:"publicFields"`
+
+	ShareEditHistory         bool              `json:"shareEditHistory"`
+	DefaultJournalVisibility JournalVisibility `json:"defaultJournalVisibility"`
+	ShareWithOrganizations   bool              `json:"shareWithOrganizations"`
 }
 type RecipientWithRequest struct {
 	Recipient
 	RequestStatus *CareRequestStatus `json:"requestStatus"`
 	RequestID     *uint              `json:"requestId"`
 }
+
+// RecipientMatch is a recipient ranked for a particular caregiver.
+type RecipientMatch struct {
+	Recipient Recipient `json:"recipient"`
+	Score     int       `json:"score"`
+	Reasons   []string  `json:"reasons"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+type ReminderChannel string
+
+const (
+	ChannelInApp   ReminderChannel = "in_app"
+	ChannelEmail   ReminderChannel = "email"
+	ChannelWebhook ReminderChannel = "webhook"
+)
+
+type ReminderKind string
+
+const (
+	ReminderDueSoon    ReminderKind = "due_soon"   // MinutesBefore the due date, to the assigned caregiver
+	ReminderEscalation ReminderKind = "escalation" // high priority todo still open past due, to other linked caregivers
+
+	// Markers for webhook events about a todo, recorded once per due date and
+	// never delivered as reminders
+	ReminderOverdue ReminderKind = "overdue" // todo.overdue
+	ReminderAlert   ReminderKind = "alert"   // alert.raised, when an escalation starts
+)
+
+// ReminderSettings are a user's delivery preferences. Users without a row get
+// in-app reminders using DefaultReminderMinutes.
+type ReminderSettings struct {
+	UserID        uint              `gorm:"primaryKey" json:"userId"`
+	User          User              `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	Channels      []ReminderChannel `gorm:"type:jsonb;serializer:json" json:"channels"`
+	WebhookURL    string            `json:"webhookUrl"`
+	WebhookSecret string            `gorm:"serializer:encrypted" json:"-"` // signs webhook bodies, HMAC-SHA256
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+// DefaultReminderMinutes applies to users who haven't set rules: one day and
+// one hour before the due date.
+var DefaultReminderMinutes = []int{24 * 60, 60}
+
+// ReminderRule is one of a user's default reminders for todos that don't set
+// their own. Priority limits the rule to todos of that priority.
+type ReminderRule struct {
+	ID            uint          `gorm:"primaryKey" json:"id"`
+	UserID        uint          `gorm:"not null;index" json:"userId"`
+	User          User          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	MinutesBefore int           `gorm:"not null" json:"minutesBefore"`
+	Priority      *TodoPriority `gorm:"type:varchar(10)" json:"priority"`
+	CreatedAt     time.Time     `json:"createdAt"`
+}
+
+// TodoReminder records a reminder that fired, so it goes out once per due
+// date even across restarts. Moving the due date arms the reminders again.
+type TodoReminder struct {
+	ID            uint         `gorm:"primaryKey" json:"id"`
+	TodoID        uint         `gorm:"not null;uniqueIndex:uniq_todo_reminder" json:"todoId"`
+	Todo          Todo         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:TodoID;references:ID" json:"-"`
+	UserID        uint         `gorm:"not null;index;uniqueIndex:uniq_todo_reminder" json:"userId"`
+	Kind          ReminderKind `gorm:"type:varchar(20);not null;uniqueIndex:uniq_todo_reminder" json:"kind"`
+	MinutesBefore int          `gorm:"not null;uniqueIndex:uniq_todo_reminder" json:"minutesBefore"`
+	DueDate       time.Time    `gorm:"not null;uniqueIndex:uniq_todo_reminder" json:"dueDate"`
+
+	// Channels already delivered, so a retry doesn't repeat them
+	Delivered []ReminderChannel `gorm:"type:jsonb;serializer:json" json:"delivered"`
+	LastError string            `gorm:"type:text" json:"lastError,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	SentAt    *time.Time        `json:"sentAt"`
+}
+
+// Notification is an in-app message shown to a user.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"userId"`
+	User      User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	Kind      string     `gorm:"type:varchar(50);not null" json:"kind"`
+	Title     string     `gorm:"not null" json:"title"`
+	Body      string     `gorm:"type:text" json:"body"`
+	TodoID    *uint      `gorm:"index" json:"todoId,omitempty"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `gorm:"index" json:"createdAt"`
+}
+
+type ReminderSettingsReturned struct {
+	ReminderSettings
+	Rules []ReminderRule `json:"rules"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// JournalEntryRevision stores the state of a journal entry before an edit.
+type JournalEntryRevision struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	JournalEntryID uint         `gorm:"not null;index" json:"journalEntryId"`
+	JournalEntry   JournalEntry `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:JournalEntryID;references:ID" json:"-"`
+	Content        string       `gorm:"type:text;not null;serializer:encrypted" json:"content"`
+	Mood           MoodType     `gorm:"type:varchar(20);not null" json:"mood"`
+	EditorID       uint         `gorm:"not null;index" json:"editorId"` // UserID
+	CreatedAt      time.Time    `json:"createdAt"`
+}
+
+// CommentRevision stores the content of a comment before an edit.
+type CommentRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CommentID uint      `gorm:"not null;index" json:"commentId"`
+	Comment   Comment   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:CommentID;references:ID" json:"-"`
+	Content   string    `gorm:"type:text;not null;serializer:encrypted" json:"content"`
+	EditorID  uint      `gorm:"not null;index" json:"editorId"` // UserID
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RevisionReturned struct {
+	ID         uint      `json:"id"`
+	Content    string    `gorm:"serializer:encrypted" json:"content"`
+	Mood       *MoodType `json:"mood,omitempty"`
+	EditorID   uint      `json:"editorId"`
+	EditorName string    `json:"editorName"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
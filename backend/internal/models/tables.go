@@ -0,0 +1,46 @@
+package models
+
+// Tables lists every model stored in its own table, in migration order.
+var Tables = []any{
+	&User{},
+	&Caregiver{},
+	&Recipient{},
+	&CaregiverRecipient{},
+	&CareRequest{},
+	&JournalEntry{},
+	&Comment{},
+	&Todo{},
+	&JournalEntryRevision{},
+	&CommentRevision{},
+	&JournalEntryShare{},
+	&Reaction{},
+	&Conversation{},
+	&ConversationParticipant{},
+	&Message{},
+	&MessageAttachment{},
+	&HandoverNote{},
+	&HandoverAcknowledgement{},
+	&Invite{},
+	&InviteEvent{},
+	&Guardian{},
+	&GuardianRecipient{},
+	&AuditLog{},
+	&Organization{},
+	&OrganizationMember{},
+	&PasswordResetToken{},
+	&LoginThrottle{},
+	&TwoFactor{},
+	&RecoveryCode{},
+	&LoginCode{},
+	&DeviceSession{},
+	&DataExport{},
+	&Job{},
+	&JobSchedule{},
+	&ReminderSettings{},
+	&ReminderRule{},
+	&TodoReminder{},
+	&Notification{},
+	&WebhookSubscription{},
+	&WebhookDelivery{},
+	&Upload{},
+}
@@ -16,12 +16,16 @@ type Todo struct {
 	Description string       `gorm:"type:text;not null" json:"description"`
 	DueDate     time.Time    `gorm:"not null;index" json:"dueDate"`
 	Completed   bool         `gorm:"not null;default:false" json:"completed"`
+	CompletedAt *time.Time   `gorm:"index" json:"completedAt"`
 
 	RecipientID uint `gorm:"not null;index" json:"recipientId"` // FK -> recipients.id
 	CaregiverID uint `gorm:"not null;index" json:"caregiverId"` // FK -> caregivers.id
 
 	Priority TodoPriority `gorm:"type:varchar(10);not null" json:"priority"`
 
+	// Minutes before DueDate to remind the caregiver; nil uses their rules
+	ReminderMinutes []int `gorm:"type:jsonb;serializer:json" json:"reminderMinutes"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
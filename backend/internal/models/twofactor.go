@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// TwoFactor holds a user's TOTP secret. It exists from enrollment on but only
+// protects logins once EnabledAt is set, i.e. after the first code verified.
+type TwoFactor struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"uniqueIndex;not null" json:"userId"`
+	User   User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	Secret string `gorm:"type:text;not null;serializer:encrypted" json:"-"`
+
+	EnabledAt *time.Time `json:"enabledAt"`
+	// Last accepted TOTP time step; codes from it or earlier are rejected
+	LastUsedStep int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// RecoveryCode is a single-use fallback for a lost authenticator. Only its
+// hash is stored.
+type RecoveryCode struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	UserID   uint       `gorm:"not null;index" json:"userId"`
+	User     User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	CodeHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
+
+// TwoFactorStatus is what a user sees about their own 2FA setup.
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"` // by the user's organization
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Upload records a file stored through POST /uploads. Name is the random file
+// name on disk; the file is served at /uploads/<Name>.
+type Upload struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"not null;uniqueIndex" json:"name"`
+	UserID       uint      `gorm:"not null;index" json:"userId"` // uploader
+	User         User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	OriginalName string    `json:"originalName"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Url is the path the file is served from.
+func (u Upload) Url() string {
+	return "/uploads/" + u.Name
+}
+
+// Path is where the file is stored under dir.
+func (u Upload) Path(dir string) string {
+	return filepath.Join(dir, u.Name)
+}
+
+// UploadByURL finds the upload a /uploads/<name> URL points at. URLs that
+// aren't uploads, or aren't recorded, give gorm.ErrRecordNotFound.
+func UploadByURL(db *gorm.DB, url string) (Upload, error) {
+	var upload Upload
+	name, ok := strings.CutPrefix(url, "/uploads/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+		return upload, gorm.ErrRecordNotFound
+	}
+	err := db.First(&upload, "name = ?", name).Error
+	return upload, err
+}
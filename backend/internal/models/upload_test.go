@@ -0,0 +1,26 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestUploadByURLRejectsOtherPaths(t *testing.T) {
+	tests := []string{
+		"",
+		"/uploads/",
+		"/uploads/../../etc/passwd",
+		"/uploads/a/b.mp3",
+		`/uploads/..\secret`,
+		"https://example.com/uploads/a.mp3",
+		"uploads/a.mp3",
+	}
+	for _, url := range tests {
+		// None of these reach the database
+		if _, err := UploadByURL(nil, url); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("UploadByURL(%q) err = %v, want ErrRecordNotFound", url, err)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package models
 
+import "time"
+
 type UserRole string
 
 const (
 	RoleCaregiver UserRole = "caregiver"
 	RoleRecipient UserRole = "recipient"
+	RoleGuardian  UserRole = "guardian" // family member managing a recipient's care
+	RoleAdmin     UserRole = "admin"    // platform operator; created via the CLI, never through signup
 )
 
 type User struct {
@@ -13,6 +17,23 @@ type User struct {
 	PasswordHash string   `gorm:"not null" json:"-"`
 	Name         string   `gorm:"not null" json:"name"`
 	Role         UserRole `gorm:"type:varchar(20);not null" json:"role"`
+	// Optional; needed to receive password reset links
+	Email *string `gorm:"uniqueIndex" json:"email,omitempty"`
+
+	Active bool `gorm:"not null;default:true" json:"active"`
+	// Bumped to invalidate every token issued before it
+	TokenVersion      int        `gorm:"not null;default:0" json:"-"`
+	MustResetPassword bool       `gorm:"not null;default:false" json:"mustResetPassword"`
+	DeactivatedAt     *time.Time `json:"deactivatedAt,omitempty"`
+	// Set on accounts that were merged into another; they stay deactivated
+	MergedIntoID *uint `gorm:"index" json:"mergedIntoId,omitempty"`
+
+	// Self-service deletion: the account is erased at DeletionScheduledFor
+	// unless the user cancels first. DeletedAt marks the anonymized remains.
+	DeletionScheduledFor *time.Time `gorm:"index" json:"deletionScheduledFor,omitempty"`
+	DeletedAt            *time.Time `json:"deletedAt,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type UpdateUserNameRequest struct {
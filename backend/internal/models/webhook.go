@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookEventType string
+
+const (
+	EventCareRequestCreated   WebhookEventType = "care_request.created"
+	EventCareRequestResponded WebhookEventType = "care_request.responded"
+	EventJournalEntryCreated  WebhookEventType = "journal_entry.created"
+	EventTodoCompleted        WebhookEventType = "todo.completed"
+	EventTodoOverdue          WebhookEventType = "todo.overdue"
+	EventAlertRaised          WebhookEventType = "alert.raised"
+	EventPing                 WebhookEventType = "ping" // sent on request to test an endpoint
+)
+
+// WebhookEventTypes are the events a subscription can choose.
+var WebhookEventTypes = []WebhookEventType{
+	EventCareRequestCreated,
+	EventCareRequestResponded,
+	EventJournalEntryCreated,
+	EventTodoCompleted,
+	EventTodoOverdue,
+	EventAlertRaised,
+}
+
+// WebhookSubscription sends events to a URL. It belongs to either an
+// organization, receiving events involving its caregivers, or a single user,
+// receiving events involving them.
+type WebhookSubscription struct {
+	ID             uint               `gorm:"primaryKey" json:"id"`
+	OrganizationID *uint              `gorm:"index" json:"organizationId,omitempty"`
+	Organization   *Organization      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:OrganizationID;references:ID" json:"-"`
+	UserID         *uint              `gorm:"index" json:"userId,omitempty"`
+	User           *User              `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:UserID;references:ID" json:"-"`
+	URL            string             `gorm:"not null" json:"url"`
+	Secret         string             `gorm:"not null;serializer:encrypted" json:"-"` // HMAC-SHA256 key for the signature header
+	Events         []WebhookEventType `gorm:"type:jsonb;serializer:json" json:"events"`
+	Description    string             `json:"description"`
+	Active         bool               `gorm:"not null;default:true" json:"active"`
+	CreatedByID    uint               `gorm:"not null" json:"createdById"` // UserID
+	CreatedAt      time.Time          `json:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending" // queued or waiting to retry
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed" // out of retries
+)
+
+// WebhookDelivery is one event sent to one subscription, with the outcome of
+// the latest attempt.
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint                  `gorm:"not null;index" json:"subscriptionId"`
+	Subscription   WebhookSubscription   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:SubscriptionID;references:ID" json:"-"`
+	EventID        string                `gorm:"type:varchar(64);not null;index" json:"eventId"`
+	EventType      WebhookEventType      `gorm:"type:varchar(50);not null" json:"eventType"`
+	Payload        json.RawMessage       `gorm:"type:jsonb;not null;serializer:json" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Attempts       int                   `gorm:"not null;default:0" json:"attempts"`
+	ResponseStatus int                   `json:"responseStatus,omitempty"` // the body is never stored
+	Error          string                `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64                 `json:"durationMs,omitempty"`
+	ReplayOfID     *uint                 `json:"replayOfId,omitempty"`
+	CreatedAt      time.Time             `gorm:"index" json:"createdAt"`
+	DeliveredAt    *time.Time            `json:"deliveredAt,omitempty"`
+}
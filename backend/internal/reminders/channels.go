@@ -0,0 +1,128 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/mailer"
+	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
+)
+
+// InApp stores the notice as a notification the user sees in the app.
+type InApp struct {
+	DB *gorm.DB
+}
+
+func (c InApp) Deliver(_ context.Context, n Notice, _ models.ReminderSettings) error {
+	return c.DB.Create(&models.Notification{
+		UserID: n.User.ID,
+		Kind:   "todo." + string(n.Kind),
+		Title:  n.Title,
+		Body:   n.Body,
+		TodoID: &n.Todo.ID,
+	}).Error
+}
+
+// Email sends the notice to the user's address. Users without one are
+// skipped.
+type Email struct {
+	Mailer mailer.Mailer
+}
+
+func (c Email) Deliver(ctx context.Context, n Notice, _ models.ReminderSettings) error {
+	if n.User.Email == nil || *n.User.Email == "" {
+		return nil
+	}
+	return c.Mailer.Send(ctx, mailer.Message{
+		To:      *n.User.Email,
+		Subject: n.Title,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s\n", n.User.Name, n.Body),
+	})
+}
+
+// SignatureHeader carries "sha256=<hex HMAC of the body>" when the user has a
+// webhook secret.
+const SignatureHeader = webhooks.SignatureHeader
+
+// Webhook posts the notice as JSON to the user's webhook URL. Client
+// defaults to webhooks.NewClient(false), which only reaches public addresses.
+type Webhook struct {
+	Client *http.Client
+}
+
+type webhookTodo struct {
+	ID          uint                `json:"id"`
+	Title       string              `json:"title"`
+	DueDate     time.Time           `json:"dueDate"`
+	Priority    models.TodoPriority `json:"priority"`
+	RecipientID uint                `json:"recipientId"`
+	CaregiverID uint                `json:"caregiverId"`
+}
+
+type webhookBody struct {
+	Event     string      `json:"event"`
+	UserID    uint        `json:"userId"`
+	Title     string      `json:"title"`
+	Body      string      `json:"body"`
+	Todo      webhookTodo `json:"todo"`
+	Recipient string      `json:"recipient"`
+	SentAt    time.Time   `json:"sentAt"`
+}
+
+func (c Webhook) Deliver(ctx context.Context, n Notice, settings models.ReminderSettings) error {
+	if settings.WebhookURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(webhookBody{
+		Event:  "todo." + string(n.Kind),
+		UserID: n.User.ID,
+		Title:  n.Title,
+		Body:   n.Body,
+		Todo: webhookTodo{
+			ID:          n.Todo.ID,
+			Title:       n.Todo.Title,
+			DueDate:     n.Todo.DueDate,
+			Priority:    n.Todo.Priority,
+			RecipientID: n.Todo.RecipientID,
+			CaregiverID: n.Todo.CaregiverID,
+		},
+		Recipient: n.RecipientName,
+		SentAt:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if settings.WebhookSecret != "" {
+		req.Header.Set(SignatureHeader, webhooks.Sign(settings.WebhookSecret, body))
+	}
+
+	client := c.Client
+	if client == nil {
+		client = webhooks.NewClient(false)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
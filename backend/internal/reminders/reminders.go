@@ -0,0 +1,449 @@
+// Package reminders tells caregivers when their todos are about to fall due
+// and escalates high priority todos left open past due to the other
+// caregivers of the same recipient. Scan runs every minute as a background
+// job and queues one delivery job per reminder, which sends it through each
+// channel the user chose. It also publishes the todo.overdue and alert.raised
+// webhook events.
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+	"hack4good/internal/webhooks"
+)
+
+const (
+	ScanJobKind    = "reminders.scan"
+	DeliverJobKind = "reminders.deliver"
+
+	// MaxMinutesBefore is the earliest a reminder can fire: one week ahead.
+	MaxMinutesBefore = 7 * 24 * 60
+
+	// Overdue todos older than this are not escalated, so turning reminders
+	// on doesn't flood caregivers with old work.
+	escalationWindow = 7 * 24 * time.Hour
+)
+
+type DeliverPayload struct {
+	ReminderID uint `json:"reminderId"`
+}
+
+// Notice is a reminder ready to be sent.
+type Notice struct {
+	Kind          models.ReminderKind
+	User          models.User
+	Todo          models.Todo
+	RecipientName string
+	AssigneeName  string
+	Title         string
+	Body          string
+}
+
+// Channel delivers notices one way, e.g. by email.
+type Channel interface {
+	Deliver(ctx context.Context, n Notice, settings models.ReminderSettings) error
+}
+
+type Service struct {
+	DB       *gorm.DB
+	Channels map[models.ReminderChannel]Channel
+
+	// How long a high priority todo may stay open past due before the
+	// recipient's other caregivers are told
+	EscalateAfter time.Duration
+}
+
+// userRules resolves the reminder offsets for each user. Users who never
+// saved settings get DefaultReminderMinutes.
+type userRules struct {
+	configured bool
+	rules      []models.ReminderRule
+}
+
+func (u userRules) minutesFor(todo models.Todo) []int {
+	if todo.ReminderMinutes != nil {
+		return todo.ReminderMinutes
+	}
+	if !u.configured {
+		return models.DefaultReminderMinutes
+	}
+	var minutes []int
+	for _, rule := range u.rules {
+		if rule.Priority == nil || *rule.Priority == todo.Priority {
+			minutes = append(minutes, rule.MinutesBefore)
+		}
+	}
+	return minutes
+}
+
+// Scan records every reminder that has become due and queues its delivery.
+func (s Service) Scan(ctx context.Context, now time.Time) error {
+	if err := s.scanDueSoon(now); err != nil {
+		return err
+	}
+	if err := s.scanPastDue(now); err != nil {
+		return err
+	}
+	return s.scanOverdue(now)
+}
+
+type todoWithAssignee struct {
+	models.Todo
+	AssigneeUserID uint
+}
+
+type dueSoonTodo struct {
+	models.Todo
+	AssigneeUserID uint
+	// The offset closest to the due date already recorded for the assignee;
+	// offsets further out passed before it and were recorded with it.
+	RemindedMinutes *int
+}
+
+// scanDueSoon records the reminders whose offsets have passed. Todos already
+// reminded at their due date are left out, and for the rest only offsets
+// closer than the last recorded one are considered, so a todo costs no writes
+// until its next reminder is due.
+func (s Service) scanDueSoon(now time.Time) error {
+	var todos []dueSoonTodo
+	if err := s.DB.Model(&models.Todo{}).
+		Select("todos.*, caregivers.user_id AS assignee_user_id, reminded.minutes AS reminded_minutes").
+		Joins("JOIN caregivers ON caregivers.id = todos.caregiver_id").
+		Joins(`LEFT JOIN LATERAL (
+			SELECT MIN(r.minutes_before) AS minutes FROM todo_reminders r
+			WHERE r.todo_id = todos.id AND r.user_id = caregivers.user_id AND r.kind = ? AND r.due_date = todos.due_date
+		) reminded ON true`, models.ReminderDueSoon).
+		Where("todos.completed = ? AND todos.due_date > ? AND todos.due_date <= ?",
+			false, now, now.Add(MaxMinutesBefore*time.Minute)).
+		Where("reminded.minutes IS NULL OR reminded.minutes > 0").
+		Scan(&todos).Error; err != nil {
+		return err
+	}
+	if len(todos) == 0 {
+		return nil
+	}
+
+	userIDs := make([]uint, 0, len(todos))
+	for _, t := range todos {
+		userIDs = append(userIDs, t.AssigneeUserID)
+	}
+	rules, err := loadRules(s.DB, userIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range todos {
+		// Every offset that has passed is recorded, but only the one closest
+		// to the due date is sent: a todo created an hour before it is due
+		// shouldn't also announce that it is due in a day.
+		var passed []int
+		for _, minutes := range rules[t.AssigneeUserID].minutesFor(t.Todo) {
+			if t.RemindedMinutes != nil && minutes >= *t.RemindedMinutes {
+				continue
+			}
+			if !t.DueDate.Add(-time.Duration(minutes) * time.Minute).After(now) {
+				passed = append(passed, minutes)
+			}
+		}
+		if len(passed) == 0 {
+			continue
+		}
+		slices.Sort(passed)
+		for i, minutes := range slices.Compact(passed) {
+			if err := s.record(t.Todo, t.AssigneeUserID, models.ReminderDueSoon, minutes, i == 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notRecorded leaves out todos for which the assignee already has a reminder
+// of kind for the current due date, so a scan only touches new ones.
+func notRecorded(kind models.ReminderKind) clause.Expr {
+	return gorm.Expr(`NOT EXISTS (
+		SELECT 1 FROM todo_reminders r
+		WHERE r.todo_id = todos.id AND r.user_id = caregivers.user_id AND r.kind = ? AND r.due_date = todos.due_date
+	)`, kind)
+}
+
+// scanPastDue publishes todo.overdue for open todos whose due date has just
+// passed.
+func (s Service) scanPastDue(now time.Time) error {
+	var todos []todoWithAssignee
+	if err := s.DB.Model(&models.Todo{}).
+		Select("todos.*, caregivers.user_id AS assignee_user_id").
+		Joins("JOIN caregivers ON caregivers.id = todos.caregiver_id").
+		Where("todos.completed = ? AND todos.due_date <= ? AND todos.due_date > ?",
+			false, now, now.Add(-escalationWindow)).
+		Where(notRecorded(models.ReminderOverdue)).
+		Scan(&todos).Error; err != nil {
+		return err
+	}
+	for _, t := range todos {
+		if err := s.mark(t.Todo, t.AssigneeUserID, models.ReminderOverdue, models.EventTodoOverdue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Service) scanOverdue(now time.Time) error {
+	if s.EscalateAfter <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-s.EscalateAfter)
+	var todos []todoWithAssignee
+	if err := s.DB.Model(&models.Todo{}).
+		Select("todos.*, caregivers.user_id AS assignee_user_id").
+		Joins("JOIN caregivers ON caregivers.id = todos.caregiver_id").
+		Where("todos.completed = ? AND todos.priority = ? AND todos.due_date <= ? AND todos.due_date > ?",
+			false, models.PriorityHigh, cutoff, cutoff.Add(-escalationWindow)).
+		Where(notRecorded(models.ReminderAlert)).
+		Scan(&todos).Error; err != nil {
+		return err
+	}
+
+	for _, t := range todos {
+		todo := t.Todo
+
+		// Other caregivers who can act on the recipient's todos
+		var userIDs []uint
+		if err := s.DB.Table("caregiver_recipients").
+			Joins("JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id").
+			Where("caregiver_recipients.recipient_id = ? AND caregiver_recipients.caregiver_id <> ?", todo.RecipientID, todo.CaregiverID).
+			Where(models.ScopeGranted("caregiver_recipients", models.ScopeManageTodos)).
+			Pluck("caregivers.user_id", &userIDs).Error; err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if err := s.record(todo, userID, models.ReminderEscalation, 0, true); err != nil {
+				return err
+			}
+		}
+
+		// Marked last: once it is recorded the todo isn't scanned again, so
+		// escalations interrupted before this point are retried
+		if err := s.mark(todo, t.AssigneeUserID, models.ReminderAlert, models.EventAlertRaised); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record stores a reminder once per todo, user, offset and due date, queueing
+// its delivery when send is set.
+func (s Service) record(todo models.Todo, userID uint, kind models.ReminderKind, minutes int, send bool) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		reminder := models.TodoReminder{
+			TodoID:        todo.ID,
+			UserID:        userID,
+			Kind:          kind,
+			MinutesBefore: minutes,
+			DueDate:       todo.DueDate,
+		}
+		if !send {
+			reminder.LastError = "skipped: a reminder closer to the due date was sent instead"
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+		if res.Error != nil || res.RowsAffected == 0 || !send {
+			return res.Error
+		}
+		_, err := jobs.Enqueue(tx, DeliverJobKind, DeliverPayload{ReminderID: reminder.ID})
+		return err
+	})
+}
+
+// mark publishes a webhook event about a todo the first time it is seen for
+// the todo's current due date.
+func (s Service) mark(todo models.Todo, userID uint, kind models.ReminderKind, event models.WebhookEventType) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.TodoReminder{
+			TodoID:  todo.ID,
+			UserID:  userID,
+			Kind:    kind,
+			DueDate: todo.DueDate,
+			SentAt:  &now,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return webhooks.Publish(tx, event, todo.ID)
+	})
+}
+
+func loadRules(db *gorm.DB, userIDs []uint) (map[uint]userRules, error) {
+	var settings []models.ReminderSettings
+	if err := db.Where("user_id IN ?", userIDs).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	var rules []models.ReminderRule
+	if err := db.Where("user_id IN ?", userIDs).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	byUser := map[uint]userRules{}
+	for _, s := range settings {
+		byUser[s.UserID] = userRules{configured: true}
+	}
+	for _, r := range rules {
+		u := byUser[r.UserID]
+		u.configured = true
+		u.rules = append(u.rules, r)
+		byUser[r.UserID] = u
+	}
+	return byUser, nil
+}
+
+// Settings returns the user's delivery preferences, or the defaults.
+func Settings(db *gorm.DB, userID uint) (models.ReminderSettings, error) {
+	settings := models.ReminderSettings{UserID: userID}
+	err := db.Where("user_id = ?", userID).
+		Attrs(models.ReminderSettings{Channels: []models.ReminderChannel{models.ChannelInApp}}).
+		FirstOrInit(&settings).Error
+	return settings, err
+}
+
+// Deliver sends a recorded reminder through each of the user's channels. A
+// channel that fails makes the job retry; channels that already succeeded
+// aren't repeated.
+func (s Service) Deliver(ctx context.Context, reminderID uint) error {
+	var reminder models.TodoReminder
+	if err := s.DB.First(&reminder, reminderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // the todo was deleted
+		}
+		return err
+	}
+	if reminder.SentAt != nil {
+		return nil
+	}
+
+	notice, ok, err := s.notice(reminder)
+	if err != nil || !ok {
+		return err
+	}
+	settings, err := Settings(s.DB, reminder.UserID)
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, name := range settings.Channels {
+		if slices.Contains(reminder.Delivered, name) {
+			continue
+		}
+		channel, ok := s.Channels[name]
+		if !ok {
+			log.Printf("reminders: channel %q is not configured", name)
+			continue
+		}
+		if err := channel.Deliver(ctx, notice, settings); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		reminder.Delivered = append(reminder.Delivered, name)
+		if err := s.DB.Model(&reminder).Select("delivered").Updates(&reminder).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := errors.Join(failed...); err != nil {
+		s.DB.Model(&reminder).Update("last_error", err.Error())
+		return err
+	}
+	now := time.Now()
+	return s.DB.Model(&reminder).Updates(map[string]any{"sent_at": now, "last_error": ""}).Error
+}
+
+// notice loads what a reminder is about. It reports false when the reminder
+// no longer applies: the todo was completed or moved, or the user can't be
+// reached.
+func (s Service) notice(reminder models.TodoReminder) (Notice, bool, error) {
+	var n Notice
+	if err := s.DB.First(&n.Todo, reminder.TodoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return n, false, nil
+		}
+		return n, false, err
+	}
+	if n.Todo.Completed || !n.Todo.DueDate.Equal(reminder.DueDate) {
+		return n, false, nil
+	}
+	if err := s.DB.First(&n.User, reminder.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return n, false, nil
+		}
+		return n, false, err
+	}
+	if !n.User.Active || n.User.DeletedAt != nil {
+		return n, false, nil
+	}
+
+	var err error
+	if n.RecipientName, err = profileName(s.DB, "recipients", n.Todo.RecipientID); err != nil {
+		return n, false, err
+	}
+	if n.AssigneeName, err = profileName(s.DB, "caregivers", n.Todo.CaregiverID); err != nil {
+		return n, false, err
+	}
+
+	n.Kind = reminder.Kind
+	n.Title, n.Body = compose(n, time.Now())
+	return n, true, nil
+}
+
+// profileName is the user name behind a caregiver or recipient profile.
+func profileName(db *gorm.DB, table string, id uint) (string, error) {
+	var names []string
+	err := db.Table("users").
+		Joins("JOIN "+table+" ON "+table+".user_id = users.id").
+		Where(table+".id = ?", id).
+		Pluck("users.name", &names).Error
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
+func compose(n Notice, now time.Time) (string, string) {
+	due := n.Todo.DueDate.Local().Format("Mon 2 Jan 15:04")
+	if n.Kind == models.ReminderEscalation {
+		return "Overdue: " + n.Todo.Title,
+			fmt.Sprintf("The high priority todo %q for %s, assigned to %s, was due %s and is still open.",
+				n.Todo.Title, n.RecipientName, n.AssigneeName, due)
+	}
+	return fmt.Sprintf("Due in %s: %s", humanize(n.Todo.DueDate.Sub(now)), n.Todo.Title),
+		fmt.Sprintf("%q for %s is due %s.", n.Todo.Title, n.RecipientName, due)
+}
+
+// humanize renders a positive duration as "45 minutes", "3 hours" or "2 days".
+func humanize(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return plural(int(d.Round(time.Minute)/time.Minute), "minute")
+	case d < 48*time.Hour:
+		return plural(int(d.Round(time.Hour)/time.Hour), "hour")
+	}
+	return plural(int(d.Round(24*time.Hour)/(24*time.Hour)), "day")
+}
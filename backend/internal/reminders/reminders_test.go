@@ -0,0 +1,96 @@
+package reminders
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"hack4good/internal/models"
+)
+
+// recorder is a database that has no rows and remembers every query.
+type recorder struct{ queries []captured }
+
+type captured struct {
+	sql  string
+	args []driver.NamedValue
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct{ r *recorder }
+
+func (recorderConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (recorderConn) Close() error                        { return nil }
+func (recorderConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c recorderConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.r.queries = append(c.r.queries, captured{query, args})
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func recordingDB(t *testing.T) (*gorm.DB, *recorder) {
+	t.Helper()
+	r := &recorder{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(r)}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, r
+}
+
+func TestScansSkipRecordedTodos(t *testing.T) {
+	tests := []struct {
+		name string
+		scan func(Service, time.Time) error
+		kind models.ReminderKind
+	}{
+		{"past due", Service.scanPastDue, models.ReminderOverdue},
+		{"overdue", Service.scanOverdue, models.ReminderAlert},
+		{"due soon", Service.scanDueSoon, models.ReminderDueSoon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, r := recordingDB(t)
+			if err := tt.scan(Service{DB: db, EscalateAfter: time.Hour}, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.queries) != 1 {
+				t.Fatalf("got %d queries, want 1", len(r.queries))
+			}
+			q := r.queries[0]
+			if !strings.Contains(q.sql, "FROM todo_reminders r") ||
+				!strings.Contains(q.sql, "r.todo_id = todos.id AND r.user_id = caregivers.user_id AND r.kind = $") ||
+				!strings.Contains(q.sql, "r.due_date = todos.due_date") {
+				t.Errorf("scan doesn't check recorded reminders: %s", q.sql)
+			}
+			found := false
+			for _, arg := range q.args {
+				found = found || fmt.Sprint(arg.Value) == string(tt.kind)
+			}
+			if !found {
+				t.Errorf("kind %s not bound in %v", tt.kind, q.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+)
+
+// JobKind is the background job that transcribes one journal entry.
+const JobKind = "transcribe.entry"
+
+type JobPayload struct {
+	EntryID uint `json:"entryId"`
+}
+
+// UploadsDir is where journal audio lives on disk.
+var UploadsDir = "./uploads"
+
+// Process transcribes a queued entry and stores the result on it. Errors are
+// returned so the job queue retries; the entry is marked failed once the job
+// runs out of attempts.
+func Process(ctx context.Context, db *gorm.DB, t Transcriber, entryID uint) error {
+	var entry models.JournalEntry
+	if err := db.First(&entry, entryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // deleted since it was queued
+		}
+		return err
+	}
+	if entry.AudioUrl == "" || entry.TranscriptEdited || entry.TranscriptStatus == models.TranscriptDone {
+		return nil
+	}
+	upload, err := models.UploadByURL(db, entry.AudioUrl)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Nothing to retry: the audio isn't a recorded upload
+		return db.Model(&entry).UpdateColumns(map[string]any{
+			"transcript_status": models.TranscriptFailed,
+			"transcript_error":  "audio file not found",
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.Model(&entry).UpdateColumn("transcript_status", models.TranscriptRunning).Error; err != nil {
+		return err
+	}
+
+	result, err := t.Transcribe(ctx, upload.Path(UploadsDir))
+
+	// The recipient may have typed a transcript while this was running;
+	// theirs wins.
+	q := db.Model(&entry).
+		Where("transcript_status = ? AND transcript_edited = ?", models.TranscriptRunning, false)
+	if err != nil {
+		log.Printf("transcribing journal entry %d: %v", entry.ID, err)
+		status := models.TranscriptPending
+		if jobs.FinalAttempt(ctx) {
+			status = models.TranscriptFailed
+		}
+		if updateErr := q.UpdateColumns(map[string]any{
+			"transcript_status": status,
+			"transcript_error":  err.Error(),
+		}).Error; updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	now := time.Now()
+	// A struct update so the transcript goes through the encrypted serializer
+	return q.Select("transcript", "transcript_language", "transcript_status", "transcribed_at", "transcript_error").
+		UpdateColumns(models.JournalEntry{
+			ID:                 entry.ID, // the transcript is bound to the row
+			Transcript:         &result.Text,
+			TranscriptLanguage: result.Language,
+			TranscriptStatus:   models.TranscriptDone,
+			TranscribedAt:      &now,
+		}).Error
+}
@@ -0,0 +1,30 @@
+package transcribe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Stub returns a fixed transcript without running any model. An empty Text is
+// replaced with one naming the file, so entries are still easy to tell apart.
+type Stub struct {
+	Text     string
+	Language string
+	Err      error
+}
+
+func (s Stub) Transcribe(_ context.Context, audioPath string) (Result, error) {
+	if s.Err != nil {
+		return Result{}, s.Err
+	}
+	if _, err := os.Stat(audioPath); err != nil {
+		return Result{}, err
+	}
+	text := s.Text
+	if text == "" {
+		text = fmt.Sprintf("Transcript of %s", filepath.Base(audioPath))
+	}
+	return Result{Text: text, Language: s.Language}, nil
+}
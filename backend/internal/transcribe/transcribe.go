@@ -0,0 +1,37 @@
+// Package transcribe turns journal audio into text. Transcribers run behind
+// an interface so the offline whisper.cpp backend can be swapped for a stub in
+// development and tests.
+package transcribe
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Result is the text spoken in a recording and the language it was
+// detected in, as an ISO 639-1 code such as "en".
+type Result struct {
+	Text     string
+	Language string
+}
+
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioPath string) (Result, error)
+}
+
+// FromEnv picks the transcriber named by TRANSCRIBER: "whisper" for the local
+// whisper.cpp binary or "stub" for a canned result. It returns nil when
+// TRANSCRIBER is unset, which leaves audio entries queued.
+func FromEnv() (Transcriber, error) {
+	switch kind := os.Getenv("TRANSCRIBER"); kind {
+	case "":
+		return nil, nil
+	case "whisper":
+		return WhisperFromEnv()
+	case "stub":
+		return Stub{Text: os.Getenv("TRANSCRIBER_STUB_TEXT"), Language: "en"}, nil
+	default:
+		return nil, fmt.Errorf("unknown TRANSCRIBER %q", kind)
+	}
+}
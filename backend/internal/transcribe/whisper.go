@@ -0,0 +1,117 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Whisper transcribes offline with a whisper.cpp build. Browser recordings
+// are converted to the 16 kHz mono WAV whisper.cpp expects with ffmpeg first.
+type Whisper struct {
+	Binary   string // whisper.cpp CLI, e.g. whisper-cli
+	Model    string // path to a ggml model file
+	FFmpeg   string
+	Language string // "auto" to detect
+	Threads  int
+}
+
+// WhisperFromEnv configures Whisper from WHISPER_MODEL (required),
+// WHISPER_BIN, WHISPER_LANGUAGE, WHISPER_THREADS and FFMPEG_BIN.
+func WhisperFromEnv() (*Whisper, error) {
+	w := &Whisper{
+		Binary:   envOr("WHISPER_BIN", "whisper-cli"),
+		Model:    os.Getenv("WHISPER_MODEL"),
+		FFmpeg:   envOr("FFMPEG_BIN", "ffmpeg"),
+		Language: envOr("WHISPER_LANGUAGE", "auto"),
+	}
+	if w.Model == "" {
+		return nil, fmt.Errorf("WHISPER_MODEL is required")
+	}
+	if s := os.Getenv("WHISPER_THREADS"); s != "" {
+		if _, err := fmt.Sscan(s, &w.Threads); err != nil {
+			return nil, fmt.Errorf("invalid WHISPER_THREADS: %w", err)
+		}
+	}
+	return w, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// whisperOutput is the part of whisper.cpp's --output-json file we use.
+type whisperOutput struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, audioPath string) (Result, error) {
+	dir, err := os.MkdirTemp("", "transcribe-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	wav := filepath.Join(dir, "audio.wav")
+	if err := run(ctx, w.FFmpeg, "-nostdin", "-loglevel", "error", "-i", audioPath,
+		"-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav); err != nil {
+		return Result{}, fmt.Errorf("converting audio: %w", err)
+	}
+
+	out := filepath.Join(dir, "transcript")
+	args := []string{"-m", w.Model, "-f", wav, "-l", w.Language, "-oj", "-of", out, "-np"}
+	if w.Threads > 0 {
+		args = append(args, "-t", fmt.Sprint(w.Threads))
+	}
+	if err := run(ctx, w.Binary, args...); err != nil {
+		return Result{}, fmt.Errorf("running whisper: %w", err)
+	}
+
+	data, err := os.ReadFile(out + ".json")
+	if err != nil {
+		return Result{}, err
+	}
+	var parsed whisperOutput
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return Result{}, fmt.Errorf("reading whisper output: %w", err)
+	}
+
+	segments := make([]string, 0, len(parsed.Transcription))
+	for _, seg := range parsed.Transcription {
+		if text := strings.TrimSpace(seg.Text); text != "" {
+			segments = append(segments, text)
+		}
+	}
+	return Result{Text: strings.Join(segments, " "), Language: parsed.Result.Language}, nil
+}
+
+// run executes a command, folding the tail of its stderr into the error.
+func run(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = msg[len(msg)-500:]
+		}
+		if msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
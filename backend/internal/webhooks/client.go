@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrInternalAddress is returned for a connection to an address that isn't on
+// the public internet.
+var ErrInternalAddress = errors.New("address is not public")
+
+// sharedAddressSpace is carrier-grade NAT, private in practice though not in
+// netip's sense.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr reports whether ip is an address webhooks may be sent to: not
+// loopback, private, link-local, multicast or unspecified.
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// NewClient returns the HTTP client for calling subscribers' endpoints. Every
+// connection is checked at dial time, after DNS resolution, so a hostname
+// can't point a webhook at the internal network; allowInternal lifts that for
+// local development. Redirects aren't followed, since the check can't vouch
+// for where they lead without repeating it for every hop.
+func NewClient(allowInternal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowInternal {
+		dialer.Control = refuseInternal
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			// No proxy: it would make the connection on our behalf
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refuseInternal(_, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !PublicAddr(addr.Addr()) {
+		return ErrInternalAddress
+	}
+	return nil
+}
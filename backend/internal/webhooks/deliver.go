@@ -0,0 +1,110 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+)
+
+// Deliver posts a delivery's payload to its subscription's URL and records
+// the outcome. Anything but a 2xx answer returns an error so the job is
+// retried; the delivery is marked failed once the retries run out. Only the
+// status code of the answer is kept, never its body. client defaults to
+// NewClient(false).
+func Deliver(ctx context.Context, db *gorm.DB, client *http.Client, deliveryID uint) error {
+	var delivery models.WebhookDelivery
+	if err := db.Preload("Subscription").First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // the subscription was deleted
+		}
+		return err
+	}
+	if delivery.Status != models.DeliveryPending {
+		return nil
+	}
+	if !delivery.Subscription.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "subscription is paused"
+		return save(db, &delivery)
+	}
+
+	req, err := newRequest(ctx, delivery)
+	if err != nil {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+		return errors.Join(jobs.Permanent(err), save(db, &delivery))
+	}
+	if client == nil {
+		client = NewClient(false)
+	}
+
+	delivery.Attempts++
+	started := time.Now()
+	status, err := send(client, req)
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.ResponseStatus = status
+	if err == nil && (status < 200 || status >= 300) {
+		err = fmt.Errorf("endpoint answered %d", status)
+	}
+	if errors.Is(err, ErrInternalAddress) {
+		// Don't log where the name resolved to; retrying won't help
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "url resolves to an address that is not public"
+		return errors.Join(jobs.Permanent(err), save(db, &delivery))
+	}
+
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.DeliverySucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		return save(db, &delivery)
+	}
+
+	delivery.Error = err.Error()
+	if jobs.FinalAttempt(ctx) {
+		delivery.Status = models.DeliveryFailed
+	}
+	if saveErr := save(db, &delivery); saveErr != nil {
+		return errors.Join(err, saveErr)
+	}
+	return err
+}
+
+func newRequest(ctx context.Context, delivery models.WebhookDelivery) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CareConnect-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(delivery.Subscription.Secret, delivery.Payload))
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, delivery.EventID)
+	return req, nil
+}
+
+func send(client *http.Client, req *http.Request) (int, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	return res.StatusCode, nil
+}
+
+func save(db *gorm.DB, delivery *models.WebhookDelivery) error {
+	return db.Model(delivery).
+		Select("status", "attempts", "response_status", "error", "duration_ms", "delivered_at").
+		Updates(delivery).Error
+}
@@ -0,0 +1,220 @@
+package webhooks
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/models"
+)
+
+type careRequestData struct {
+	ID            uint                     `json:"id"`
+	Status        models.CareRequestStatus `json:"status"`
+	CaregiverID   uint                     `json:"caregiverId"`
+	CaregiverName string                   `json:"caregiverName"`
+	RecipientID   uint                     `json:"recipientId"`
+	RecipientName string                   `json:"recipientName"`
+	RequestedAt   time.Time                `json:"requestedAt"`
+	RespondedAt   *time.Time               `json:"respondedAt"`
+}
+
+// journalEntryData leaves out the entry's content, which integrations can
+// fetch through the API with the recipient's consent.
+type journalEntryData struct {
+	ID            uint                     `json:"id"`
+	RecipientID   uint                     `json:"recipientId"`
+	RecipientName string                   `json:"recipientName"`
+	Mood          models.MoodType          `json:"mood"`
+	Visibility    models.JournalVisibility `json:"visibility"`
+	HasAudio      bool                     `json:"hasAudio"`
+	CreatedAt     time.Time                `json:"createdAt"`
+}
+
+type todoData struct {
+	ID            uint                `json:"id"`
+	Title         string              `json:"title"`
+	Priority      models.TodoPriority `json:"priority"`
+	DueDate       time.Time           `json:"dueDate"`
+	Completed     bool                `json:"completed"`
+	CompletedAt   *time.Time          `json:"completedAt"`
+	CaregiverID   uint                `json:"caregiverId"`
+	CaregiverName string              `json:"caregiverName"`
+	RecipientID   uint                `json:"recipientId"`
+	RecipientName string              `json:"recipientName"`
+}
+
+type alertData struct {
+	Kind     string   `json:"kind"`
+	Message  string   `json:"message"`
+	Todo     todoData `json:"todo"`
+	Notified []uint   `json:"notifiedUserIds"`
+}
+
+type party struct {
+	UserID uint
+	Name   string
+}
+
+// profile resolves the user behind a caregiver or recipient profile.
+func profile(db *gorm.DB, table string, id uint) (party, error) {
+	var p party
+	err := db.Table(table).
+		Select("users.id AS user_id, users.name").
+		Joins("JOIN users ON users.id = "+table+".user_id").
+		Where(table+".id = ?", id).
+		Take(&p).Error
+	return p, err
+}
+
+// event is the body of a webhook event; every event is about one recipient.
+type event interface {
+	recipient() uint
+}
+
+func (d careRequestData) recipient() uint  { return d.RecipientID }
+func (d journalEntryData) recipient() uint { return d.RecipientID }
+func (d todoData) recipient() uint         { return d.RecipientID }
+func (d alertData) recipient() uint        { return d.Todo.RecipientID }
+
+// buildEvent loads the resource an event is about and returns its body along
+// with the users allowed to receive it. Organizations receive events that
+// involve their caregivers when the recipient shares with organizations.
+func buildEvent(db *gorm.DB, eventType models.WebhookEventType, id uint) (event, []uint, error) {
+	switch eventType {
+	case models.EventCareRequestCreated, models.EventCareRequestResponded:
+		var req models.CareRequest
+		if err := db.First(&req, id).Error; err != nil {
+			return nil, nil, err
+		}
+		caregiver, recipient, err := parties(db, req.CaregiverID, req.RecipientID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return careRequestData{
+			ID:            req.ID,
+			Status:        req.Status,
+			CaregiverID:   req.CaregiverID,
+			CaregiverName: caregiver.Name,
+			RecipientID:   req.RecipientID,
+			RecipientName: recipient.Name,
+			RequestedAt:   req.RequestedAt,
+			RespondedAt:   req.RespondedAt,
+		}, []uint{caregiver.UserID, recipient.UserID}, nil
+
+	case models.EventJournalEntryCreated:
+		var entry models.JournalEntry
+		if err := db.Preload("Shares").First(&entry, id).Error; err != nil {
+			return nil, nil, err
+		}
+		recipient, err := profile(db, "recipients", entry.RecipientID)
+		if err != nil {
+			return nil, nil, err
+		}
+		users, err := journalReaders(db, entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		return journalEntryData{
+			ID:            entry.ID,
+			RecipientID:   entry.RecipientID,
+			RecipientName: recipient.Name,
+			Mood:          entry.Mood,
+			Visibility:    entry.Visibility,
+			HasAudio:      entry.AudioUrl != "",
+			CreatedAt:     entry.CreatedAt,
+		}, append(users, recipient.UserID), nil
+
+	case models.EventTodoCompleted, models.EventTodoOverdue:
+		data, users, err := todoEvent(db, id)
+		return data, users, err
+
+	case models.EventAlertRaised:
+		todo, users, err := todoEvent(db, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		notified, err := otherTodoCaregivers(db, todo.RecipientID, todo.CaregiverID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return alertData{
+			Kind:     "todo_overdue",
+			Message:  fmt.Sprintf("High priority todo %q is still open past its due date", todo.Title),
+			Todo:     todo,
+			Notified: notified,
+		}, append(users, notified...), nil
+	}
+	return nil, nil, fmt.Errorf("unknown event type %q", eventType)
+}
+
+func parties(db *gorm.DB, caregiverID, recipientID uint) (party, party, error) {
+	caregiver, err := profile(db, "caregivers", caregiverID)
+	if err != nil {
+		return caregiver, party{}, err
+	}
+	recipient, err := profile(db, "recipients", recipientID)
+	return caregiver, recipient, err
+}
+
+func todoEvent(db *gorm.DB, id uint) (todoData, []uint, error) {
+	var todo models.Todo
+	if err := db.First(&todo, id).Error; err != nil {
+		return todoData{}, nil, err
+	}
+	caregiver, recipient, err := parties(db, todo.CaregiverID, todo.RecipientID)
+	if err != nil {
+		return todoData{}, nil, err
+	}
+	return todoData{
+		ID:            todo.ID,
+		Title:         todo.Title,
+		Priority:      todo.Priority,
+		DueDate:       todo.DueDate,
+		Completed:     todo.Completed,
+		CompletedAt:   todo.CompletedAt,
+		CaregiverID:   todo.CaregiverID,
+		CaregiverName: caregiver.Name,
+		RecipientID:   todo.RecipientID,
+		RecipientName: recipient.Name,
+	}, []uint{caregiver.UserID, recipient.UserID}, nil
+}
+
+// journalReaders are the users of caregivers who can read the entry.
+func journalReaders(db *gorm.DB, entry models.JournalEntry) ([]uint, error) {
+	q := db.Table("caregiver_recipients").
+		Joins("JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id").
+		Where("caregiver_recipients.recipient_id = ?", entry.RecipientID).
+		Where(models.ScopeGranted("caregiver_recipients", models.ScopeReadJournal))
+
+	switch entry.Visibility {
+	case models.VisibilityPrivate:
+		return nil, nil
+	case models.VisibilitySelected:
+		shared := make([]uint, len(entry.Shares))
+		for i, s := range entry.Shares {
+			shared[i] = s.CaregiverID
+		}
+		if len(shared) == 0 {
+			return nil, nil
+		}
+		q = q.Where("caregiver_recipients.caregiver_id IN ?", shared)
+	}
+
+	var users []uint
+	err := q.Pluck("caregivers.user_id", &users).Error
+	return users, err
+}
+
+// otherTodoCaregivers are the users of the recipient's other caregivers who
+// can manage todos, i.e. the ones told about an overdue todo.
+func otherTodoCaregivers(db *gorm.DB, recipientID, caregiverID uint) ([]uint, error) {
+	users := []uint{}
+	err := db.Table("caregiver_recipients").
+		Joins("JOIN caregivers ON caregivers.id = caregiver_recipients.caregiver_id").
+		Where("caregiver_recipients.recipient_id = ? AND caregiver_recipients.caregiver_id <> ?", recipientID, caregiverID).
+		Where(models.ScopeGranted("caregiver_recipients", models.ScopeManageTodos)).
+		Pluck("caregivers.user_id", &users).Error
+	return users, err
+}
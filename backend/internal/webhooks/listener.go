@@ -0,0 +1,70 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Listener is a stand-in receiver for trying subscriptions locally. It
+// prints each delivery, checks its signature when it knows the secret, and
+// can fail the first deliveries to exercise retries.
+type Listener struct {
+	Secret string
+	Out    io.Writer
+
+	// FailFirst answers this many deliveries with 500 before accepting any
+	FailFirst int
+
+	mu       sync.Mutex
+	received int
+}
+
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l.mu.Lock()
+	l.received++
+	n := l.received
+	l.mu.Unlock()
+
+	signature := "not checked"
+	if l.Secret != "" {
+		signature = "valid"
+		if !Verify(l.Secret, body, r.Header.Get(SignatureHeader)) {
+			signature = "INVALID"
+		}
+	}
+	fmt.Fprintf(l.Out, "#%d %s %s event=%s delivery=%s signature=%s\n",
+		n, time.Now().Format(time.TimeOnly), r.URL.Path,
+		r.Header.Get(EventHeader), r.Header.Get(DeliveryHeader), signature)
+
+	var pretty any
+	if json.Unmarshal(body, &pretty) == nil {
+		out, _ := json.MarshalIndent(pretty, "  ", "  ")
+		fmt.Fprintf(l.Out, "  %s\n", out)
+	} else {
+		fmt.Fprintf(l.Out, "  %s\n", body)
+	}
+
+	switch {
+	case signature == "INVALID":
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+	case n <= l.FailFirst:
+		fmt.Fprintf(l.Out, "  answering 500 (%d of %d failures)\n", n, l.FailFirst)
+		http.Error(w, "simulated failure", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
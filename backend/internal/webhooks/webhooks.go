@@ -0,0 +1,231 @@
+// Package webhooks sends events to subscribers' HTTP endpoints. Publishing
+// only queues a job; the job works out who may see the event, records one
+// delivery per matching subscription and queues each delivery, which the job
+// queue retries with backoff until the endpoint answers 2xx.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"hack4good/internal/jobs"
+	"hack4good/internal/models"
+)
+
+const (
+	PublishJobKind = "webhooks.publish"
+	DeliverJobKind = "webhooks.deliver"
+
+	// deliveryAttempts spreads retries over about an hour.
+	deliveryAttempts = 8
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=<hex HMAC-SHA256 of the body keyed with the subscription secret>".
+const (
+	SignatureHeader = "X-CareConnect-Signature"
+	EventHeader     = "X-CareConnect-Event"
+	DeliveryHeader  = "X-CareConnect-Delivery" // the event ID, the same for retries and replays
+)
+
+var ErrNotFound = errors.New("delivery not found")
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches body, for receivers.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Envelope is the JSON body of every delivery.
+type Envelope struct {
+	ID        string                  `json:"id"`
+	Type      models.WebhookEventType `json:"type"`
+	CreatedAt time.Time               `json:"createdAt"`
+	Data      any                     `json:"data"`
+}
+
+type PublishPayload struct {
+	EventID    string                  `json:"eventId"`
+	Type       models.WebhookEventType `json:"type"`
+	ResourceID uint                    `json:"resourceId"`
+	OccurredAt time.Time               `json:"occurredAt"`
+}
+
+func newEventID() (string, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(raw), nil
+}
+
+// Publish queues an event about a resource (a care request, journal entry or
+// todo, depending on the type). The event body is built when the job runs.
+func Publish(db *gorm.DB, eventType models.WebhookEventType, resourceID uint) error {
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+	_, err = jobs.Enqueue(db, PublishJobKind, PublishPayload{
+		EventID:    id,
+		Type:       eventType,
+		ResourceID: resourceID,
+		OccurredAt: time.Now(),
+	})
+	return err
+}
+
+// PublishOrLog is Publish for callers that have already done their work and
+// shouldn't fail because of webhooks.
+func PublishOrLog(db *gorm.DB, eventType models.WebhookEventType, resourceID uint) {
+	if err := Publish(db, eventType, resourceID); err != nil {
+		log.Printf("webhooks: publishing %s %d: %v", eventType, resourceID, err)
+	}
+}
+
+// Fanout records a delivery for every active subscription that asked for the
+// event and may see it, and queues them.
+func Fanout(ctx context.Context, db *gorm.DB, p PublishPayload) error {
+	data, users, err := buildEvent(db, p.Type, p.ResourceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil // deleted before the event went out
+	}
+	if err != nil {
+		return err
+	}
+
+	var orgs []uint
+	if len(users) > 0 {
+		if err := db.Model(&models.OrganizationMember{}).
+			Where("user_id IN ? AND role = ? AND NOT pending", users, models.OrgRoleCaregiver).
+			Where("EXISTS (SELECT 1 FROM recipients WHERE id = ? AND share_with_organizations)", data.recipient()).
+			Distinct().
+			Pluck("organization_id", &orgs).Error; err != nil {
+			return err
+		}
+	}
+	if len(users) == 0 && len(orgs) == 0 {
+		return nil
+	}
+
+	wanted, _ := json.Marshal([]models.WebhookEventType{p.Type})
+	owners := db.Where("user_id IN ?", users)
+	if len(orgs) > 0 {
+		owners = owners.Or("organization_id IN ?", orgs)
+	}
+	var subs []models.WebhookSubscription
+	if err := db.Where("active = ? AND events @> ?", true, string(wanted)).
+		Where(owners).
+		Find(&subs).Error; err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Envelope{ID: p.EventID, Type: p.Type, CreatedAt: p.OccurredAt, Data: data})
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// A retried fanout skips subscriptions it already reached
+		var done []uint
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("event_id = ? AND replay_of_id IS NULL", p.EventID).
+			Pluck("subscription_id", &done).Error; err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if slices.Contains(done, sub.ID) {
+				continue
+			}
+			if err := queueDelivery(tx, &models.WebhookDelivery{
+				SubscriptionID: sub.ID,
+				EventID:        p.EventID,
+				EventType:      p.Type,
+				Payload:        payload,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type DeliverPayload struct {
+	DeliveryID uint `json:"deliveryId"`
+}
+
+func queueDelivery(tx *gorm.DB, delivery *models.WebhookDelivery) error {
+	delivery.Status = models.DeliveryPending
+	if err := tx.Create(delivery).Error; err != nil {
+		return err
+	}
+	_, err := jobs.Enqueue(tx, DeliverJobKind, DeliverPayload{DeliveryID: delivery.ID}, jobs.MaxAttempts(deliveryAttempts))
+	return err
+}
+
+// Replay sends a past delivery's payload again as a new delivery, keeping
+// the event ID so receivers can tell it is the same event.
+func Replay(db *gorm.DB, deliveryID uint) (models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := db.First(&original, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return original, ErrNotFound
+		}
+		return original, err
+	}
+
+	replay := models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		ReplayOfID:     &original.ID,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return queueDelivery(tx, &replay)
+	})
+	return replay, err
+}
+
+// Ping queues a test event for one subscription, whatever events it chose.
+func Ping(db *gorm.DB, sub models.WebhookSubscription) (models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{SubscriptionID: sub.ID, EventType: models.EventPing}
+	id, err := newEventID()
+	if err != nil {
+		return delivery, err
+	}
+	payload, err := json.Marshal(Envelope{
+		ID:        id,
+		Type:      models.EventPing,
+		CreatedAt: time.Now(),
+		Data:      map[string]any{"subscriptionId": sub.ID, "message": "Webhook test from CareConnect"},
+	})
+	if err != nil {
+		return delivery, err
+	}
+	delivery.EventID = id
+	delivery.Payload = payload
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return queueDelivery(tx, &delivery)
+	})
+	return delivery, err
+}
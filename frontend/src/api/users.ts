@@ -107,7 +107,7 @@ export const useSendRequest = () => {
   const queryClient = useQueryClient()
 
   return useMutation({
-    mutationFn: (data: { caregiverId: string; recipientId: string }) =>
+    mutationFn: (data: { recipientId: string }) =>
       apiFetch<CareRequest>(`/requests`, {
         method: 'POST',
         body: JSON.stringify(data),
@@ -49,7 +49,7 @@ export function Recipients() {
 
   const handleSendRequest = (recipientId: string) => {
     assignRecipient.mutate(
-      { recipientId, caregiverId: currentCaregiver?.id || "" },
+      { recipientId },
       {
         onSuccess: () => {
           toast.success("Care request sent! Waiting for recipient to accept.");